@@ -104,6 +104,9 @@ class Collector(object):
         self.load_config(config if config else {})
 
     def _connect(self):
+        if self.config.get('fulleriteSocket'):
+            return self._connect_unix(self.config['fulleriteSocket'])
+
         fullerite_addr = FULLERITE_ADDR
         try:
             if 'fulleritePort' in self.config:
@@ -120,6 +123,17 @@ class Collector(object):
             sys.exit(1)
         return sock
 
+    def _connect_unix(self, path):
+        self.log.debug("Connecting to fullerite at %s", path)
+        sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        try:
+            sock.connect(path)
+        except socket.error, msg:
+            self.log.warn("Error connecting to fullerite socket %s: %s",
+                          path, msg)
+            sys.exit(1)
+        return sock
+
     def load_config(self, config):
         """
         Process a configfile, or reload if previously given one.
@@ -135,9 +149,12 @@ class Collector(object):
         # check if they are enabled.
         #
         # We use "fulleritePort" in collectors to connect
-        # to the running fullerite instance.
+        # to the running fullerite instance, or "fulleriteSocket"
+        # when it listens on a unix socket.
         self.config['enabled'] = True
         self.config['fulleritePort'] = config['fulleritePort']
+        if config.get('fulleriteSocket'):
+            self.config['fulleriteSocket'] = config['fulleriteSocket']
         self.config['interval'] = self.configfile.get('interval', config['interval'])
 
         self.config.update(config.get('defaultConfig', {}))
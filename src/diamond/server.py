@@ -45,12 +45,15 @@ class Server(object):
     Server class loads and starts Handlers and Collectors
     """
 
-    def __init__(self, configfile):
+    def __init__(self, configfile, collectors_path=None, collectors=None):
         # Initialize Logging
         self.log = logging.getLogger('diamond')
         # Initialize Members
         self.configfile = configfile
         self.config = None
+        # Overrides of the configuration, used when fullerite runs the server
+        self.collectors_path = collectors_path
+        self.collectors = collectors
 
         # We do this weird process title swap around to get the sync manager
         # title correct for ps
@@ -60,6 +63,13 @@ class Server(object):
         if setproctitle:
             setproctitle(oldproctitle)
 
+    def load_config(self):
+        self.config = load_config(self.configfile)
+        if self.collectors_path is not None:
+            self.config['diamondCollectorsPath'] = self.collectors_path
+        if self.collectors is not None:
+            self.config['diamondCollectors'] = self.collectors
+
     def run(self):
         """
         Load handler and collector classes and then start collectors
@@ -68,7 +78,7 @@ class Server(object):
         ########################################################################
         # Config
         ########################################################################
-        self.config = load_config(self.configfile)
+        self.load_config()
 
         collectors = load_collectors(self.config['diamondCollectorsPath'])
 
@@ -92,8 +102,13 @@ class Server(object):
                 # Collectors
                 ##############################################################
 
+                # Collectors listed in nativeDiamondCollectors are run by
+                # fullerite itself
+                native_collectors = self.config.get('nativeDiamondCollectors') or []
                 running_collectors = []
                 for collector in self.config['diamondCollectors']:
+                    if collector in native_collectors:
+                        continue
                     running_collectors.append(collector)
                 running_collectors = set(running_collectors)
                 self.log.debug("Running collectors: %s" % running_collectors)
@@ -161,7 +176,7 @@ class Server(object):
 
             except SIGHUPException:
                 self.log.info('Reloading state due to HUP')
-                self.config = load_config(self.configfile)
+                self.load_config()
                 collectors = load_collectors(
                     self.config['diamondCollectorsPath'])
 
@@ -181,6 +196,13 @@ def main():
     parser.add_option("-f",
                       "--log_config",
                       help="Configure logging with the specified file")
+    parser.add_option("-p",
+                      "--collectors_path",
+                      help="Load collectors from this directory instead of "
+                           "diamondCollectorsPath")
+    parser.add_option("--collectors",
+                      help="Comma separated collectors to run instead of "
+                           "diamondCollectors")
     (options, args) = parser.parse_args()
 
     logging.basicConfig(level=logging.getLevelName(options.log_level or 'INFO'),
@@ -188,7 +210,14 @@ def main():
     if options.log_config:
         logging.config.fileConfig(options.log_config)
 
-    Server(options.config_file).run()
+    collectors = None
+    if options.collectors is not None:
+        collectors = [c.strip() for c in options.collectors.split(',')
+                      if c.strip()]
+
+    Server(options.config_file,
+           collectors_path=options.collectors_path,
+           collectors=collectors).run()
 
 if __name__ == "__main__":
     main()
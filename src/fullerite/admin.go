@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fullerite/collector"
+	"fullerite/config"
+	"fullerite/handler"
+	"fullerite/internalserver"
+	"fullerite/metric"
+
+	"errors"
+	"sort"
+	"time"
+)
+
+// flushTimeout is how long a handler has to take a flush request
+const flushTimeout = 5 * time.Second
+
+// fulleriteAdmin lets the admin API of the internal server control the
+// running collectors and handlers
+type fulleriteAdmin struct {
+	config         config.Config
+	handlers       []handler.Handler
+	collectorStats internalserver.InternalStatFunc
+}
+
+// Collectors returns the running collectors, with their configuration
+// without its secrets
+func (a fulleriteAdmin) Collectors() []internalserver.ComponentState {
+	collectorControls.Lock()
+	controls := make([]*collectorControl, 0, len(collectorControls.controls))
+	for _, control := range collectorControls.controls {
+		controls = append(controls, control)
+	}
+	collectorControls.Unlock()
+	sort.Slice(controls, func(i, j int) bool {
+		return controls[i].collector.CanonicalName() < controls[j].collector.CanonicalName()
+	})
+
+	stats := map[string]metric.InternalMetrics{}
+	if a.collectorStats != nil {
+		stats = a.collectorStats()
+	}
+	states := make([]internalserver.ComponentState, 0, len(controls))
+	for _, control := range controls {
+		name := control.collector.CanonicalName()
+		schema, _ := collector.Schema(name)
+		states = append(states, internalserver.ComponentState{
+			Name:     name,
+			Type:     control.collector.CollectorType(),
+			Interval: control.collector.Interval(),
+			Paused:   control.isPaused(),
+			Config:   schema.Redact(control.config),
+			Stats:    stats[name],
+		})
+	}
+	return states
+}
+
+// Handlers returns the handlers, with their configuration without its
+// secrets
+func (a fulleriteAdmin) Handlers() []internalserver.ComponentState {
+	states := make([]internalserver.ComponentState, 0, len(a.handlers))
+	for _, h := range a.handlers {
+		schema, _ := handler.Schema(h.CanonicalName())
+		states = append(states, internalserver.ComponentState{
+			Name:     h.CanonicalName(),
+			Type:     h.Name(),
+			Interval: h.Interval(),
+			Config:   schema.Redact(a.config.Handlers[h.CanonicalName()]),
+			Stats:    h.InternalMetrics(),
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// PauseCollector skips the scheduled collections of a collector until it
+// is resumed. Listeners, which collect continuously, can't be paused.
+func (a fulleriteAdmin) PauseCollector(name string) error {
+	control := collectorControlFor(name)
+	if control == nil {
+		return internalserver.ErrNotFound
+	}
+	if control.collector.CollectorType() == "listener" {
+		return errors.New("listeners collect continuously")
+	}
+	control.setPaused(true)
+	return nil
+}
+
+// ResumeCollector resumes a paused collector
+func (a fulleriteAdmin) ResumeCollector(name string) error {
+	control := collectorControlFor(name)
+	if control == nil {
+		return internalserver.ErrNotFound
+	}
+	control.setPaused(false)
+	return nil
+}
+
+// Collect makes a collector collect now, even when it is paused
+func (a fulleriteAdmin) Collect(name string) error {
+	control := collectorControlFor(name)
+	if control == nil {
+		return internalserver.ErrNotFound
+	}
+	if control.collector.CollectorType() == "listener" {
+		return errors.New("listeners collect continuously")
+	}
+	select {
+	case control.collectNow <- struct{}{}:
+		return nil
+	default:
+		return errors.New("a collection is already pending")
+	}
+}
+
+// FlushHandler makes a handler emit the metrics it buffered from every
+// collector, as a sentinel metric does
+func (a fulleriteAdmin) FlushHandler(name string) error {
+	for _, h := range a.handlers {
+		if h.CanonicalName() != name {
+			continue
+		}
+		channels := []chan metric.Metric{h.Channel()}
+		for _, endpoint := range h.CollectorEndpoints() {
+			channels = append(channels, endpoint.Channel)
+		}
+		for _, channel := range channels {
+			select {
+			case channel <- metric.Sentinel():
+			case <-time.After(flushTimeout):
+				return errors.New("the handler didn't take the flush request")
+			}
+		}
+		return nil
+	}
+	return internalserver.ErrNotFound
+}
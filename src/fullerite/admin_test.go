@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fullerite/config"
+	"fullerite/handler"
+	"fullerite/internalserver"
+	"fullerite/metric"
+
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminCollectPausedCollector(t *testing.T) {
+	c := startCollector("Test admin", config.Config{}, map[string]interface{}{"interval": 3600, "metricName": "admin"})
+	require.NotNil(t, c)
+	admin := fulleriteAdmin{}
+
+	endpoint := handler.CollectorEnd{Channel: make(chan metric.Metric), BufferSize: 1}
+	h := handler.New("Log")
+	h.SetCollectorEndpoints(map[string]handler.CollectorEnd{"Test admin": endpoint})
+	done := make(chan struct{})
+	go func() {
+		readFromCollector(c, []handler.Handler{h})
+		close(done)
+	}()
+	defer func() {
+		stopCollector("Test admin")
+		close(c.Channel())
+		<-done
+	}()
+
+	assert.Nil(t, admin.PauseCollector("Test admin"))
+	assert.Nil(t, admin.Collect("Test admin"))
+	select {
+	case m := <-endpoint.Channel:
+		assert.Equal(t, "admin", m.Name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The paused collector didn't emit what it collected")
+	}
+
+	var state internalserver.ComponentState
+	for _, s := range admin.Collectors() {
+		if s.Name == "Test admin" {
+			state = s
+		}
+	}
+	assert.True(t, state.Paused)
+	assert.Equal(t, 3600, state.Interval)
+	assert.Equal(t, "admin", state.Config["metricName"])
+
+	assert.Nil(t, admin.ResumeCollector("Test admin"))
+	assert.False(t, collectorControlFor("Test admin").isPaused())
+
+	assert.Equal(t, internalserver.ErrNotFound, admin.PauseCollector("Missing"))
+	assert.Equal(t, internalserver.ErrNotFound, admin.Collect("Missing"))
+}
+
+func TestAdminHandlers(t *testing.T) {
+	h := handler.New("SignalFx")
+	conf := config.Config{Handlers: map[string]map[string]interface{}{
+		"SignalFx": {"authToken": "s3cr3t", "endpoint": "https://ingest.signalfx.com"},
+	}}
+	h.Configure(conf.Handlers["SignalFx"])
+	admin := fulleriteAdmin{config: conf, handlers: []handler.Handler{h}}
+
+	states := admin.Handlers()
+	require.Len(t, states, 1)
+	assert.Equal(t, "SignalFx", states[0].Name)
+	assert.Equal(t, map[string]interface{}{
+		"authToken": "<redacted>",
+		"endpoint":  "https://ingest.signalfx.com",
+	}, states[0].Config)
+}
+
+func TestAdminFlushHandler(t *testing.T) {
+	h := handler.NewTest(make(chan metric.Metric), 10, 10, time.Second, log)
+	admin := fulleriteAdmin{handlers: []handler.Handler{h}}
+
+	flushed := make(chan metric.Metric, 1)
+	go func() { flushed <- <-h.Channel() }()
+
+	assert.Nil(t, admin.FlushHandler(h.CanonicalName()))
+	m := <-flushed
+	assert.True(t, m.Sentinel())
+
+	assert.Equal(t, internalserver.ErrNotFound, admin.FlushHandler("Missing"))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fullerite/collector"
+	"fullerite/config"
+	"fullerite/handler"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// checkConfig loads the configuration and the configurations of its
+// collectors, prints their problems and exits with 1 when there are
+// errors. With --describe it prints the schema of a collector or handler
+// instead.
+func checkConfig(ctx *cli.Context) {
+	initLogrus(ctx)
+
+	if name := ctx.String("describe"); name != "" {
+		if !describeSchema(os.Stdout, name) {
+			fmt.Printf("There is no collector or handler named %s\n", name)
+			os.Exit(1)
+		}
+		return
+	}
+
+	configFile := ctx.String("config")
+	c, err := config.ReadConfig(configFile)
+	if err != nil {
+		fmt.Println(config.Problem{File: configFile, Message: err.Error()})
+		os.Exit(1)
+	}
+
+	errors, warnings := 0, 0
+	for _, problem := range validateConfig(c) {
+		fmt.Println(problem)
+		if problem.Warning {
+			warnings++
+		} else {
+			errors++
+		}
+	}
+	fmt.Printf("%s: %d errors, %d warnings\n", configFile, errors, warnings)
+	if errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// validateConfig returns the problems of the configuration, of its
+// handlers and routes, and of the configurations of its collectors
+func validateConfig(c config.Config) []config.Problem {
+	problems := []config.Problem{}
+	add := func(file, prefix string, found []config.Problem) {
+		for _, problem := range found {
+			problem.File = file
+			if problem.Key != "" {
+				problem.Key = prefix + problem.Key
+			} else {
+				problem.Key = strings.TrimSuffix(prefix, ".")
+			}
+			problems = append(problems, problem)
+		}
+	}
+
+	if c.Interval != nil {
+		add(c.File, "", config.Schema{{Key: "interval", Type: config.Int}}.Validate(map[string]interface{}{"interval": c.Interval}))
+	}
+
+	names := []string{}
+	for name := range c.Handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(c.File, "handlers."+name+".", handler.ValidateConfig(name, c.Handlers[name]))
+	}
+
+	for i, r := range c.Routes {
+		key := fmt.Sprintf("routes.%d", i)
+		if _, err := parseRoute(r); err != nil {
+			add(c.File, key, []config.Problem{{Message: err.Error()}})
+		}
+		for _, name := range r.Handlers {
+			if _, exists := c.Handlers[name]; !exists {
+				add(c.File, key, []config.Problem{{Message: name + " isn't a configured handler"}})
+			}
+		}
+	}
+
+	for _, name := range c.Collectors {
+		if _, exists := collector.Schema(name); !exists {
+			add(c.File, "collectors", []config.Problem{{Message: "unknown collector " + name}})
+			continue
+		}
+		problems = append(problems, validateCollectorConfig(c, name)...)
+	}
+
+	for _, name := range c.DiamondCollectors {
+		if isNativeDiamondCollector(name, c) {
+			if !collector.IsNativeDiamondCollector(name) {
+				add(c.File, "nativeDiamondCollectors", []config.Problem{{Message: "there is no native version of diamond collector " + name}})
+				continue
+			}
+			problems = append(problems, validateCollectorConfig(c, name)...)
+			continue
+		}
+
+		// the Python Diamond server only reads JSON .conf files
+		configFile := strings.Replace(c.CollectorsConfigPath+"/"+name, " ", "_", -1) + ".conf"
+		contents, err := ioutil.ReadFile(configFile)
+		if err == nil {
+			var conf map[string]interface{}
+			err = json.Unmarshal(contents, &conf)
+		}
+		if err != nil {
+			add(configFile, "", []config.Problem{{Message: err.Error()}})
+		}
+	}
+	return problems
+}
+
+func validateCollectorConfig(c config.Config, name string) []config.Problem {
+	configFile := c.CollectorConfigFile(name)
+	conf, err := config.ReadCollectorConfig(configFile)
+	if err != nil {
+		return []config.Problem{{File: configFile, Message: err.Error()}}
+	}
+	problems := collector.ValidateConfig(name, conf)
+	for i := range problems {
+		problems[i].File = configFile
+	}
+	return problems
+}
+
+// logConfigProblems logs the problems of the configuration of a collector
+// or handler being started
+func logConfigProblems(problems []config.Problem, owner string) {
+	for _, problem := range problems {
+		if problem.Warning {
+			log.Warn(owner, " configuration: ", problem)
+		} else {
+			log.Error(owner, " configuration: ", problem)
+		}
+	}
+}
+
+// describeSchema prints the configuration keys of a collector or handler,
+// and returns false when there is none with that name
+func describeSchema(w io.Writer, name string) bool {
+	schema, exists := handler.Schema(name)
+	if !exists {
+		if schema, exists = collector.Schema(name); !exists {
+			return false
+		}
+	}
+
+	for _, field := range schema {
+		fmt.Fprintf(w, "%s (%s", field.Key, field.Type)
+		if field.Required {
+			fmt.Fprint(w, ", required")
+		}
+		if field.Secret {
+			fmt.Fprint(w, ", secret")
+		}
+		if field.Default != nil {
+			fmt.Fprintf(w, ", default %v", field.Default)
+		}
+		if len(field.Choices) > 0 {
+			fmt.Fprintf(w, ", one of %s", strings.Join(field.Choices, ", "))
+		}
+		fmt.Fprintf(w, ")\n    %s\n", field.Description)
+	}
+	return true
+}
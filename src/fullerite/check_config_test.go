@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fullerite/config"
+
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite-check-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "Test.yaml"), []byte("metricName: x\ntypo: 1\n"), 0644))
+
+	c := config.Config{
+		File:                 "fullerite.conf",
+		CollectorsConfigPath: dir,
+		Collectors:           []string{"Test", "NoSuchCollector"},
+		Handlers: map[string]map[string]interface{}{
+			"Graphite": {"server": "example.com", "port": "2003"},
+			"Bogus":    {},
+		},
+		Routes: []config.Route{{Name: "(", Handlers: []string{"Graphite", "Missing"}}},
+	}
+
+	assert.Equal(t, []config.Problem{
+		{File: "fullerite.conf", Key: "handlers.Bogus", Message: "unknown handler Bogus"},
+		{File: "fullerite.conf", Key: "routes.0", Message: "error parsing regexp: missing closing ): `(`"},
+		{File: "fullerite.conf", Key: "routes.0", Message: "Missing isn't a configured handler"},
+		{File: filepath.Join(dir, "Test.yaml"), Key: "typo", Message: "unknown key", Warning: true},
+		{File: "fullerite.conf", Key: "collectors", Message: "unknown collector NoSuchCollector"},
+	}, validateConfig(c))
+}
+
+func TestDescribeSchema(t *testing.T) {
+	var out bytes.Buffer
+	assert.True(t, describeSchema(&out, "Graphite"))
+	assert.Contains(t, out.String(), "server (string, required)\n")
+	assert.Contains(t, out.String(), "cumulativeCounterMode (string, default raw, one of raw, delta, rate)\n")
+
+	assert.False(t, describeSchema(&out, "NoSuchHandler"))
+}
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bytes"
+	"fullerite/config"
 	"os"
 	"os/exec"
 	"os/user"
@@ -21,6 +22,9 @@ type AdHoc struct {
 
 func init() {
 	RegisterCollector("AdHoc", newAdHoc)
+	RegisterSchema("AdHoc", config.Schema{
+		{Key: "collectorFile", Type: config.String, Required: true, Description: "Executable printing the metrics as JSON"},
+	})
 }
 
 // newAdHoc Simple constructor for an AdHoc collector
@@ -36,6 +36,10 @@ type ChronosStats struct {
 
 func init() {
 	RegisterCollector("ChronosStats", newChronosStats)
+	RegisterSchema("ChronosStats", config.Schema{
+		{Key: "chronosHost", Type: config.String, Required: true, Description: "Chronos host the stats are read from"},
+		{Key: "extraDimensions", Type: config.StringMap, Description: "Dimensions added to every metric"},
+	})
 }
 
 func newChronosStats(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
@@ -38,6 +38,22 @@ type Collector interface {
 	DimensionsBlacklist() map[string]string
 	SetDimensionsBlacklist(map[string]string)
 	ContainsBlacklistedDimension(map[string]string) bool
+	CardinalityConfig() metric.CardinalityConfig
+	AggregationConfig() *metric.AggregationConfig
+}
+
+// InternalMetricsCollector is implemented by collectors that keep
+// internal metrics of their own. They are keyed by the canonical name of
+// the collector they are about, which for the Diamond collector is that
+// of the Python collectors.
+type InternalMetricsCollector interface {
+	InternalMetrics() map[string]metric.InternalMetrics
+}
+
+// StoppableCollector is implemented by collectors that run something of
+// their own, such as a server, to be stopped along with them
+type StoppableCollector interface {
+	Stop()
 }
 
 var collectorConstructs map[string]func(chan metric.Metric, int, *l.Entry) Collector
@@ -85,6 +101,8 @@ type baseCollector struct {
 	prefix              string
 	blacklist           []string
 	dimensionsBlacklist map[string]string
+	cardinality         metric.CardinalityConfig
+	aggregation         *metric.AggregationConfig
 
 	// intentionally exported
 	log *l.Entry
@@ -108,6 +126,28 @@ func (col *baseCollector) configureCommonParams(configMap map[string]interface{}
 	if asInterface, exists := configMap["dimensions_blacklist"]; exists {
 		col.dimensionsBlacklist = config.GetAsMap(asInterface)
 	}
+
+	col.cardinality = metric.ParseCardinalityConfig(configMap)
+
+	if asInterface, exists := configMap["aggregation"]; exists {
+		aggregation, err := metric.ParseAggregationConfig(asInterface)
+		if err != nil {
+			col.log.Error("Ignoring the aggregation: ", err)
+		} else {
+			col.aggregation = &aggregation
+		}
+	}
+}
+
+// CardinalityConfig : the limit on the unique series of the collector
+func (col *baseCollector) CardinalityConfig() metric.CardinalityConfig {
+	return col.cardinality
+}
+
+// AggregationConfig : how the metrics of the collector are aggregated, nil
+// when they aren't
+func (col *baseCollector) AggregationConfig() *metric.AggregationConfig {
+	return col.aggregation
 }
 
 // SetInterval : set the interval to collect on
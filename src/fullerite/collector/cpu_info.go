@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"fullerite/config"
 	"fullerite/metric"
 
 	"bufio"
@@ -28,6 +29,9 @@ type CPUInfo struct {
 
 func init() {
 	RegisterCollector("CPUInfo", newCPUInfo)
+	RegisterSchema("CPUInfo", config.Schema{
+		{Key: "procPath", Type: config.String, Default: defaultProcPath, Description: "Path of cpuinfo"},
+	})
 }
 
 // newCPUInfo Simple constructor for CPUInfo collector
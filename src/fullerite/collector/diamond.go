@@ -1,12 +1,18 @@
 package collector
 
 import (
+	"fullerite/config"
 	"fullerite/metric"
 
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	l "github.com/Sirupsen/logrus"
@@ -16,18 +22,72 @@ const (
 	// DefaultDiamondCollectorPort is the TCP port that diamond
 	// collectors write to and we read off of.
 	DefaultDiamondCollectorPort = "19191"
+
+	// DefaultDiamondQueueSize is how many lines read from diamond
+	// collectors wait to be published before readers block or, with the
+	// dropOldest queue behaviour, the oldest lines are dropped.
+	DefaultDiamondQueueSize = 1000
+
+	diamondAcceptRetry = 100 * time.Millisecond
 )
 
-// Diamond collector type
+// lines that can't be parsed are still accounted to their collector
+var diamondCanonicalNameRE = regexp.MustCompile(`"collectorCanonicalName"\s*:\s*"([^"]*)"`)
+
+// diamondLine is a line read from a diamond collector
+type diamondLine struct {
+	metrics    []metric.Metric
+	collector  string
+	connection string
+}
+
+// Diamond collector type. It reads the metrics of the Python diamond
+// collectors on a TCP port or, with socketPath set, on a unix socket.
+// With superviseServer set it also runs the Python Diamond server
+// (src/diamond/server.py) and restarts it when it exits, or when nothing
+// was received from it for serverHangTimeout seconds.
 type Diamond struct {
 	baseCollector
 	port          string
+	socketPath    string
 	serverStarted bool
-	incoming      chan []byte
+	incoming      chan diamondLine
+	dropOldest    bool
+	stats         *diamondStats
+
+	// the Diamond server and its collectors, from the global config
+	fulleriteConfig   string
+	collectorsPath    string
+	diamondCollectors []string
+
+	supervise        bool
+	serverCommand    []string
+	serverMinBackoff time.Duration
+	serverMaxBackoff time.Duration
+	serverHangTime   time.Duration
+	server           *diamondServer
+	// quit stops the supervisor of the server once closed by Stop
+	quit     chan struct{}
+	stopOnce sync.Once
+
+	lastLineMu sync.Mutex
+	lastLine   map[string]time.Time
+	lastAny    time.Time
 }
 
 func init() {
 	RegisterCollector("Diamond", newDiamond)
+	RegisterSchema("Diamond", config.Schema{
+		{Key: "port", Type: config.Scalar, Default: DefaultDiamondCollectorPort, Description: "TCP port the Python collectors send their metrics to"},
+		{Key: "socketPath", Type: config.String, Description: "Unix socket the Python collectors send their metrics to, instead of the port"},
+		{Key: "queueSize", Type: config.Int, Default: DefaultDiamondQueueSize, Description: "Lines received from the Python collectors held until they are parsed"},
+		{Key: "queueFullBehaviour", Type: config.String, Default: "block", Choices: []string{"block", "dropOldest"}, Description: "What happens when the queue is full"},
+		{Key: "superviseServer", Type: config.Bool, Default: false, Description: "Runs and restarts the Python Diamond server"},
+		{Key: "serverCommand", Type: config.StringList, Description: "Command running the Diamond server, python server.py next to the collectors by default"},
+		{Key: "serverMinBackoff", Type: config.Int, Default: 1, Description: "Seconds before the first restart of the server"},
+		{Key: "serverMaxBackoff", Type: config.Int, Default: 60, Description: "Most seconds between restarts of the server"},
+		{Key: "serverHangTimeout", Type: config.Int, Default: 0, Description: "Seconds without metrics after which the server is restarted, 0 to never"},
+	})
 }
 
 // newDiamond creates a new Diamond collector.
@@ -39,9 +99,14 @@ func newDiamond(channel chan metric.Metric, initialInterval int, log *l.Entry) C
 	d.interval = initialInterval
 
 	d.name = "Diamond"
-	d.incoming = make(chan []byte)
+	d.incoming = make(chan diamondLine, DefaultDiamondQueueSize)
+	d.stats = newDiamondStats()
 	d.port = DefaultDiamondCollectorPort
 	d.serverStarted = false
+	d.serverMinBackoff = time.Second
+	d.serverMaxBackoff = time.Minute
+	d.quit = make(chan struct{})
+	d.lastLine = map[string]time.Time{}
 	d.SetCollectorType("listener")
 	return d
 }
@@ -49,53 +114,151 @@ func newDiamond(channel chan metric.Metric, initialInterval int, log *l.Entry) C
 // Configure the collector
 func (d *Diamond) Configure(configMap map[string]interface{}) {
 	if port, exists := configMap["port"]; exists {
-		d.port = port.(string)
+		d.port = fmt.Sprint(port)
+	}
+	if socketPath, exists := configMap["socketPath"]; exists {
+		d.socketPath = socketPath.(string)
+	}
+	if size, exists := configMap["queueSize"]; exists {
+		d.incoming = make(chan diamondLine, config.GetAsInt(size, DefaultDiamondQueueSize))
+	}
+	if behaviour, exists := configMap["queueFullBehaviour"]; exists {
+		switch behaviour {
+		case "block":
+			d.dropOldest = false
+		case "dropOldest":
+			d.dropOldest = true
+		default:
+			d.log.Error("Unknown queueFullBehaviour ", behaviour, ", blocking when the queue is full")
+			d.dropOldest = false
+		}
+	}
+	if supervise, exists := configMap["superviseServer"]; exists {
+		d.supervise = config.GetAsBool(supervise, false)
+	}
+	if command, exists := configMap["serverCommand"]; exists {
+		d.serverCommand = config.GetAsSlice(command)
+	}
+	if backoff, exists := configMap["serverMinBackoff"]; exists {
+		d.serverMinBackoff = time.Duration(config.GetAsInt(backoff, 1)) * time.Second
+	}
+	if backoff, exists := configMap["serverMaxBackoff"]; exists {
+		d.serverMaxBackoff = time.Duration(config.GetAsInt(backoff, 60)) * time.Second
+	}
+	if hangTime, exists := configMap["serverHangTimeout"]; exists {
+		d.serverHangTime = time.Duration(config.GetAsInt(hangTime, 0)) * time.Second
 	}
 	d.configureCommonParams(configMap)
 }
 
+// SetServerConfig passes the parts of the global configuration the
+// Diamond server needs: the fullerite configuration file it reads, where
+// the Python collectors live and which of them to run.
+func (d *Diamond) SetServerConfig(fulleriteConfig, collectorsPath string, collectors []string) {
+	d.fulleriteConfig = fulleriteConfig
+	d.collectorsPath = collectorsPath
+	d.diamondCollectors = collectors
+}
+
+// serverArgs returns the command line of the Diamond server. Unless
+// serverCommand says otherwise server.py is expected next to the
+// collectors directory.
+func (d *Diamond) serverArgs() []string {
+	command := d.serverCommand
+	if len(command) == 0 {
+		command = []string{"python", filepath.Join(filepath.Dir(d.collectorsPath), "server.py")}
+	}
+	args := append([]string{}, command...)
+	args = append(args,
+		"-c", d.fulleriteConfig,
+		"--collectors_path", d.collectorsPath,
+		"--collectors", strings.Join(d.diamondCollectors, ","),
+	)
+	return args
+}
+
 // Port returns Diamond collectors listen port
 func (d *Diamond) Port() string {
 	return d.port
 }
 
-// collectDiamond opens up and reads from the a TCP socket and
-// writes what it's read to a local channel. Diamond handler (running in
-// separate processes) write to the same port.
+// collectDiamond opens up the unix socket when configured, or else the
+// TCP port, and reads from the connections made to it. Diamond handlers
+// (running in separate processes) write to it.
 //
-// When Collect() is called it reads from the local channel converts
-// strings to metrics and publishes metrics to handlers.
+// Parsed lines are queued on a local channel. When Collect() is called it
+// reads from that channel and publishes the metrics to handlers.
 func (d *Diamond) collectDiamond() {
-	addr, err := net.ResolveTCPAddr("tcp", ":"+d.port)
+	if d.socketPath != "" {
+		// a socket left behind by an earlier run would make Listen fail
+		os.Remove(d.socketPath)
+		unix, err := net.Listen("unix", d.socketPath)
+		if err != nil {
+			d.log.Error("Cannot listen on diamond unix socket ", d.socketPath, ": ", err)
+			return
+		}
+		d.acceptConnections(unix)
+		return
+	}
 
+	addr, err := net.ResolveTCPAddr("tcp", ":"+d.port)
 	if err != nil {
-		panic(err)
+		d.log.Error("Cannot resolve diamond port ", d.port, ": ", err)
+		return
 	}
-
 	l, err := net.ListenTCP("tcp4", addr)
 	if err != nil {
-		d.log.Fatal("Cannot listen on diamond socket", err)
+		d.log.Error("Cannot listen on diamond port ", d.port, ": ", err)
+		return
 	}
 
 	// figure out the port bind for Port()
 	d.port = strings.Split(l.Addr().String(), ":")[1]
 
+	d.acceptConnections(l)
+}
+
+// acceptConnections reads from every connection made to the listener
+// until the listener fails
+func (d *Diamond) acceptConnections(l net.Listener) {
 	for {
-		conn, err := l.AcceptTCP()
+		conn, err := l.Accept()
 		if err != nil {
-			d.log.Fatal(err)
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				d.log.Warn("Error accepting diamond connection, retrying: ", err)
+				time.Sleep(diamondAcceptRetry)
+				continue
+			}
+			d.log.Error("Stopped accepting diamond connections on ", l.Addr(), ": ", err)
+			return
 		}
 		go d.readDiamondMetrics(conn)
 	}
 }
 
+// connectionName names a connection for the logs and stats. Unix socket
+// connections have no remote address so they are numbered.
+func (d *Diamond) connectionName(conn net.Conn) string {
+	id := d.stats.nextConnectionID()
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" && addr.String() != "@" {
+		return addr.Network() + " " + addr.String()
+	}
+	return fmt.Sprintf("%s #%d", conn.LocalAddr().Network(), id)
+}
+
 // readDiamondMetrics reads from the connection
-func (d *Diamond) readDiamondMetrics(conn *net.TCPConn) {
+func (d *Diamond) readDiamondMetrics(conn net.Conn) {
 	defer conn.Close()
-	conn.SetKeepAlive(true)
-	conn.SetKeepAlivePeriod(time.Second)
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(time.Second)
+	}
+	name := d.connectionName(conn)
+	d.stats.openConnection(name)
+	defer d.stats.closeConnection(name)
+
 	reader := bufio.NewReader(conn)
-	d.log.Info("Connection started: ", conn.RemoteAddr())
+	d.log.Info("Connection started: ", name)
 	for {
 		line, err := reader.ReadBytes('\n')
 		if err != nil {
@@ -103,9 +266,54 @@ func (d *Diamond) readDiamondMetrics(conn *net.TCPConn) {
 			break
 		}
 		d.log.Debug("Read: ", string(line))
+
+		metrics, ok := d.parseMetrics(line)
+		collector := d.lineCollector(line, metrics)
+		d.stats.received(name, collector)
+		if !ok {
+			d.stats.parseFailed(name, collector)
+			continue
+		}
+		d.markReceived(metrics)
+		d.enqueue(diamondLine{metrics: metrics, collector: collector, connection: name})
+	}
+	d.log.Info("Connection closed: ", name)
+}
+
+// lineCollector returns the canonical name of the collector that sent the
+// line, or the Diamond collector's own if it didn't say
+func (d *Diamond) lineCollector(line []byte, metrics []metric.Metric) string {
+	for _, m := range metrics {
+		if name, ok := m.GetDimensionValue("collectorCanonicalName"); ok {
+			return name
+		}
+	}
+	if match := diamondCanonicalNameRE.FindSubmatch(line); match != nil {
+		return string(match[1])
+	}
+	return d.CanonicalName()
+}
+
+// enqueue queues a line for Collect. When the queue is full it either
+// waits or, with the dropOldest behaviour, makes room by dropping the
+// oldest line.
+func (d *Diamond) enqueue(line diamondLine) {
+	if !d.dropOldest {
 		d.incoming <- line
+		return
+	}
+	for {
+		select {
+		case d.incoming <- line:
+			return
+		default:
+		}
+		select {
+		case old := <-d.incoming:
+			d.stats.dropped(old.connection, old.collector)
+		default:
+		}
 	}
-	d.log.Info("Connection closed: ", conn.RemoteAddr())
 }
 
 // Collect reads metrics collected from Diamond collectors, converts
@@ -114,21 +322,121 @@ func (d *Diamond) Collect() {
 	if !d.serverStarted {
 		d.serverStarted = true
 		go d.collectDiamond()
+		if d.supervise {
+			d.startServer()
+		}
+		go d.reportServerStats()
 	}
 
 	for line := range d.incoming {
-		if metrics, ok := d.parseMetrics(line); ok {
-			for _, metric := range metrics {
-				d.Channel() <- metric
-			}
+		for _, metric := range line.metrics {
+			d.Channel() <- metric
 		}
 	}
 }
 
+// InternalMetrics returns the lines received, lines that failed to parse
+// and lines dropped per diamond collector and per connection, along with
+// the queue length of the Diamond collector
+func (d *Diamond) InternalMetrics() map[string]metric.InternalMetrics {
+	stats := d.stats.internalMetrics()
+	own, exists := stats[d.CanonicalName()]
+	if !exists {
+		own = metric.InternalMetrics{Counters: map[string]float64{}, Gauges: map[string]float64{}}
+	}
+	own.Gauges["fullerite.diamond_queue_length"] = float64(len(d.incoming))
+	own.Gauges["fullerite.diamond_queue_capacity"] = float64(cap(d.incoming))
+	stats[d.CanonicalName()] = own
+	return stats
+}
+
+func (d *Diamond) startServer() {
+	d.server = &diamondServer{
+		command:      d.serverArgs(),
+		minBackoff:   d.serverMinBackoff,
+		maxBackoff:   d.serverMaxBackoff,
+		hangTimeout:  d.serverHangTime,
+		lastActivity: d.lastReceived,
+		log:          d.log.WithField("diamondServer", true),
+	}
+	go d.server.supervise(d.quit)
+}
+
+// Stop stops the Diamond server, when it is supervised
+func (d *Diamond) Stop() {
+	d.stopOnce.Do(func() { close(d.quit) })
+}
+
+// markReceived records when the Diamond collectors that sent metrics
+// were last heard from
+func (d *Diamond) markReceived(metrics []metric.Metric) {
+	now := time.Now()
+	d.lastLineMu.Lock()
+	defer d.lastLineMu.Unlock()
+	d.lastAny = now
+	for _, m := range metrics {
+		if name, ok := m.GetDimensionValue("collectorCanonicalName"); ok {
+			d.lastLine[name] = now
+		}
+	}
+}
+
+func (d *Diamond) lastReceived() time.Time {
+	d.lastLineMu.Lock()
+	defer d.lastLineMu.Unlock()
+	return d.lastAny
+}
+
+// reportServerStats publishes every interval how long ago a line was
+// received from each Diamond collector and, when the server is
+// supervised, its restarts and uptime
+func (d *Diamond) reportServerStats() {
+	interval := d.Interval()
+	if interval <= 0 {
+		interval = DefaultCollectionInterval
+	}
+	started := time.Now()
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, m := range d.serverStats(started) {
+			d.Channel() <- m
+		}
+	}
+}
+
+func (d *Diamond) serverStats(started time.Time) []metric.Metric {
+	metrics := []metric.Metric{}
+
+	d.lastLineMu.Lock()
+	for _, name := range d.diamondCollectors {
+		last, seen := d.lastLine[name]
+		if !seen {
+			last = started
+		}
+		m := metric.WithValue("fullerite.diamond_server.seconds_since_last_line", time.Since(last).Seconds())
+		m.AddDimension("diamondCollector", name)
+		metrics = append(metrics, m)
+	}
+	d.lastLineMu.Unlock()
+
+	if d.server != nil {
+		metrics = append(metrics,
+			metric.WithValue("fullerite.diamond_server.restarts", float64(d.server.Restarts())),
+			metric.WithValue("fullerite.diamond_server.uptime", d.server.Uptime().Seconds()),
+		)
+	}
+	return metrics
+}
+
 func (d *Diamond) parseMetrics(line []byte) ([]metric.Metric, bool) {
 	var metrics []metric.Metric
 	if err := json.Unmarshal(line, &metrics); err != nil {
-		d.log.Error("Cannot unmarshal metric line from diamond:", line)
+		sample := string(line)
+		if len(sample) > 200 {
+			sample = sample[:200] + "..."
+		}
+		d.log.Error("Cannot unmarshal metric line from diamond (", err, "): ", sample)
 		return metrics, false
 	}
 	// All diamond metric_types are reported in uppercase, lets make them
@@ -0,0 +1,204 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+// Fields of a cpu line in /proc/stat, in order
+var diamondCPUFields = []string{
+	"user", "nice", "system", "idle", "iowait",
+	"irq", "softirq", "steal", "guest", "guest_nice",
+}
+
+// DiamondCPU is the native port of Diamond's CPUCollector. It reports the
+// cumulative time spent in each state from /proc/stat, as cpu.total.<state>
+// for the machine and as cpu.<state> with a core dimension for each core.
+//
+// It accepts the same options as the Python collector: percore, simple
+// and enableAggregation. normalize is accepted but, as in the Python
+// collector, has no effect when /proc/stat is readable.
+type DiamondCPU struct {
+	diamondCompat
+
+	percore           bool
+	simple            bool
+	enableAggregation bool
+}
+
+func init() {
+	registerNativeDiamondCollector("CPUCollector", newDiamondCPU)
+	RegisterSchema("CPUCollector", config.Schema{
+		{Key: "percore", Type: config.Bool, Default: true, Description: "Reports each core"},
+		{Key: "simple", Type: config.Bool, Default: false, Description: "Only reports the total percentage"},
+		{Key: "enableAggregation", Type: config.Bool, Default: false, Description: "Reports the total across cores"},
+	})
+}
+
+func newDiamondCPU(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	c := new(DiamondCPU)
+	c.initDiamondCompat(channel, initialInterval, log, "CPUCollector", "cpu")
+
+	c.percore = true
+	return c
+}
+
+// Configure the collector
+func (c *DiamondCPU) Configure(configMap map[string]interface{}) {
+	c.configureDiamondParams(configMap)
+
+	if val, exists := configMap["percore"]; exists {
+		c.percore = diamondBool(val, true)
+	}
+	if val, exists := configMap["simple"]; exists {
+		c.simple = diamondBool(val, false)
+	}
+	if val, exists := configMap["enableAggregation"]; exists {
+		c.enableAggregation = diamondBool(val, false)
+	}
+}
+
+// Collect publishes the cpu times
+func (c *DiamondCPU) Collect() {
+	var metrics []metric.Metric
+	var err error
+	if c.simple {
+		metrics, err = c.collectPercent(time.Second)
+	} else {
+		metrics, err = c.collectTimes()
+	}
+	if err != nil {
+		c.log.Error("Failed to collect cpu metrics: ", err)
+		return
+	}
+	for _, m := range metrics {
+		c.Channel() <- m
+	}
+}
+
+func (c *DiamondCPU) collectTimes() ([]metric.Metric, error) {
+	file, err := os.Open(c.proc("stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metrics := []metric.Metric{}
+	add := func(name string, value float64, dims map[string]string) {
+		if m, ok := c.diamondMetric(name, value, metric.CumulativeCounter, dims); ok {
+			metrics = append(metrics, m)
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		elements := strings.Fields(scanner.Text())
+		if len(elements) == 0 || !strings.HasPrefix(elements[0], "cpu") {
+			continue
+		}
+
+		prefix := "cpu.total."
+		var dims map[string]string
+		if elements[0] != "cpu" {
+			if !c.percore {
+				continue
+			}
+			prefix = "cpu."
+			dims = map[string]string{"core": strings.TrimPrefix(elements[0], "cpu")}
+		}
+
+		values := map[string]float64{}
+		for i, field := range diamondCPUFields {
+			if i+1 >= len(elements) {
+				break
+			}
+			value, err := strconv.ParseFloat(elements[i+1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s value in %q: %s", field, scanner.Text(), err)
+			}
+			values[field] = value
+			add(prefix+field, value, dims)
+		}
+
+		if c.enableAggregation {
+			add(prefix+"user_mode", values["user"]+values["nice"], dims)
+			add(prefix+"irq_softirq", values["irq"]+values["softirq"], dims)
+		}
+	}
+	return metrics, scanner.Err()
+}
+
+// collectPercent reports the share of non idle time over interval. Like
+// the Python collector the value is rounded to a whole percent.
+func (c *DiamondCPU) collectPercent(interval time.Duration) ([]metric.Metric, error) {
+	before, err := c.readTotalTimes()
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(interval)
+	after, err := c.readTotalTimes()
+	if err != nil {
+		return nil, err
+	}
+
+	sum, idle := 0.0, 0.0
+	for i := range after {
+		idle = after[i] - before[i]
+		sum += idle
+	}
+	if sum == 0 {
+		return nil, nil
+	}
+	percent := 100 - (idle * 100 / sum)
+
+	m, ok := c.diamondMetric("percent", diamondRound(percent), metric.Gauge, nil)
+	if !ok {
+		return nil, nil
+	}
+	return []metric.Metric{m}, nil
+}
+
+// readTotalTimes returns the user, nice, system and idle times of the
+// first line of /proc/stat
+func (c *DiamondCPU) readTotalTimes() ([]float64, error) {
+	file, err := os.Open(c.proc("stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, err
+	}
+	elements := strings.Fields(line)
+	if len(elements) < 5 {
+		return nil, fmt.Errorf("unexpected /proc/stat line %q", line)
+	}
+
+	times := make([]float64, 4)
+	for i := range times {
+		if times[i], err = strconv.ParseFloat(elements[i+1], 64); err != nil {
+			return nil, err
+		}
+	}
+	return times, nil
+}
+
+// diamondRound rounds half away from zero like Python 2's round()
+func diamondRound(value float64) float64 {
+	if value < 0 {
+		return -math.Floor(-value + 0.5)
+	}
+	return math.Floor(value + 0.5)
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"fullerite/metric"
+
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiamondCPUCollect(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"stat": diamondFixture("cpu", "proc_stat_2")})
+	defer os.RemoveAll(procPath)
+
+	c := newDiamondCPU(nil, 10, defaultLog).(*DiamondCPU)
+	c.SetCanonicalName("CPUCollector")
+	c.Configure(map[string]interface{}{"procPath": procPath, "enableAggregation": "True"})
+
+	metrics, err := c.collectTimes()
+	assert.Nil(t, err)
+	assertDiamondPayload(t, "CPUCollector", metrics)
+}
+
+func TestDiamondCPUNoPerCore(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"stat": diamondFixture("cpu", "proc_stat_2")})
+	defer os.RemoveAll(procPath)
+
+	c := newDiamondCPU(nil, 10, defaultLog).(*DiamondCPU)
+	c.Configure(map[string]interface{}{"procPath": procPath, "percore": "False"})
+
+	metrics, err := c.collectTimes()
+	assert.Nil(t, err)
+	for _, m := range metrics {
+		_, hasCore := m.GetDimensionValue("core")
+		assert.False(t, hasCore, m.Name)
+		assert.Equal(t, metric.CumulativeCounter, m.MetricType)
+	}
+	assert.NotEmpty(t, metrics)
+}
+
+func TestDiamondCPUSimple(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"stat": diamondFixture("cpu", "proc_stat_2")})
+	defer os.RemoveAll(procPath)
+
+	c := newDiamondCPU(nil, 10, defaultLog).(*DiamondCPU)
+	c.Configure(map[string]interface{}{"procPath": procPath, "simple": "True"})
+
+	// the fixture does not change between reads so there is nothing to report
+	metrics, err := c.collectPercent(0)
+	assert.Nil(t, err)
+	assert.Empty(t, metrics)
+}
+
+func TestDiamondRound(t *testing.T) {
+	assert.Equal(t, 3.0, diamondRound(2.5))
+	assert.Equal(t, 2.0, diamondRound(2.49))
+	assert.Equal(t, -3.0, diamondRound(-2.5))
+}
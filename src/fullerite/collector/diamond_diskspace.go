@@ -0,0 +1,254 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+const diamondDiskLabelsPath = "/dev/disk/by-label"
+
+// diskspaceUsage is what statvfs(2) reports for a filesystem
+type diskspaceUsage struct {
+	blockSize   float64
+	blocksTotal float64
+	blocksFree  float64
+	blocksAvail float64
+	inodesTotal float64
+	inodesFree  float64
+	inodesAvail float64
+}
+
+// diskspaceMount is a filesystem we report on
+type diskspaceMount struct {
+	device     string
+	mountPoint string
+}
+
+// DiamondDiskSpace is the native port of Diamond's DiskSpaceCollector.
+// For every mounted filesystem of one of the configured types it reports
+// the space and inodes used, free and available, under the filesystem
+// label or its mount point with "/" replaced by "_" ("root" for /).
+type DiamondDiskSpace struct {
+	diamondCompat
+
+	filesystems    []string
+	excludeFilters *regexp.Regexp
+	labelsPath     string
+
+	// replaced in tests
+	statfs   func(string) (diskspaceUsage, error)
+	deviceID func(string) (uint64, error)
+}
+
+func init() {
+	registerNativeDiamondCollector("DiskSpaceCollector", newDiamondDiskSpace)
+	RegisterSchema("DiskSpaceCollector", config.Schema{
+		{Key: "filesystems", Type: config.StringOrList, Description: "Filesystem types to report"},
+		{Key: "exclude_filters", Type: config.StringOrList, Description: "Regular expressions of the mount points not to report"},
+	})
+}
+
+func newDiamondDiskSpace(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	d := new(DiamondDiskSpace)
+	d.initDiamondCompat(channel, initialInterval, log, "DiskSpaceCollector", "diskspace")
+
+	d.filesystems = []string{"ext2", "ext3", "ext4", "xfs", "glusterfs", "nfs", "ntfs", "hfs", "fat32", "fat16", "btrfs"}
+	d.excludeFilters = regexp.MustCompile("^/export/home")
+	d.labelsPath = diamondDiskLabelsPath
+	d.statfs = diskspaceStatfs
+	d.deviceID = diskspaceDeviceID
+	return d
+}
+
+// Configure the collector
+func (d *DiamondDiskSpace) Configure(configMap map[string]interface{}) {
+	d.configureDiamondParams(configMap)
+
+	if val, exists := configMap["filesystems"]; exists {
+		d.filesystems = diamondList(val, splitDiamondCSV)
+	}
+	if val, exists := configMap["exclude_filters"]; exists {
+		filters := []string{}
+		for _, filter := range diamondList(val, splitDiamondCSV) {
+			if filter != "" {
+				filters = append(filters, filter)
+			}
+		}
+		d.excludeFilters = nil
+		if len(filters) > 0 {
+			re, err := regexp.Compile(strings.Join(filters, "|"))
+			if err != nil {
+				d.log.Error("Ignoring invalid exclude_filters ", filters, ": ", err)
+			} else {
+				d.excludeFilters = re
+			}
+		}
+	}
+}
+
+// Collect publishes the disk space of each filesystem
+func (d *DiamondDiskSpace) Collect() {
+	for _, m := range d.collectDiskSpace() {
+		d.Channel() <- m
+	}
+}
+
+func (d *DiamondDiskSpace) collectDiskSpace() []metric.Metric {
+	mounts, err := d.fileSystems()
+	if err != nil {
+		d.log.Error("No diskspace metrics retrieved: ", err)
+		return nil
+	}
+	labels := d.diskLabels()
+
+	metrics := []metric.Metric{}
+	add := func(name string, value float64) {
+		if m, ok := d.diamondMetric(name, value, metric.Gauge, nil); ok {
+			metrics = append(metrics, m)
+		}
+	}
+
+	for _, mount := range mounts {
+		name, labelled := labels[mount.device]
+		if !labelled {
+			name = strings.Replace(mount.mountPoint, "/", "_", -1)
+			name = strings.Replace(name, ".", "_", -1)
+			name = strings.Replace(name, "\\", "", -1)
+			if name == "_" {
+				name = "root"
+			}
+		}
+
+		usage, err := d.statfs(mount.mountPoint)
+		if err != nil {
+			d.log.Warn("Failed to stat ", mount.mountPoint, ": ", err)
+			continue
+		}
+
+		for _, unit := range d.byteUnits {
+			add(name+"."+unit+"_percentfree", usage.blocksFree/(usage.blocksFree+(usage.blocksTotal-usage.blocksFree))*100)
+			for suffix, blocks := range map[string]float64{
+				"_used":  usage.blocksTotal - usage.blocksFree,
+				"_free":  usage.blocksFree,
+				"_avail": usage.blocksAvail,
+			} {
+				value, err := convertDiamondBytes(usage.blockSize*blocks, "byte", unit)
+				if err != nil {
+					d.log.Warn("Skipping ", name, ": ", err)
+					break
+				}
+				add(name+"."+unit+suffix, value)
+			}
+		}
+
+		if usage.inodesTotal > 0 {
+			add(name+".inodes_percentfree", usage.inodesFree/usage.inodesTotal*100)
+		}
+		add(name+".inodes_used", usage.inodesTotal-usage.inodesFree)
+		add(name+".inodes_free", usage.inodesFree)
+		add(name+".inodes_avail", usage.inodesAvail)
+	}
+	return metrics
+}
+
+// fileSystems returns the mounted filesystems to report on, one per
+// device
+func (d *DiamondDiskSpace) fileSystems() ([]diskspaceMount, error) {
+	file, err := os.Open(d.proc("mounts"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mounts := []diskspaceMount{}
+	seen := map[uint64]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		device, mountPoint, fsType := fields[0], fields[1], fields[2]
+
+		if !containsString(fsType, d.filesystems) {
+			continue
+		}
+		if d.excludeFilters != nil && d.excludeFilters.MatchString(mountPoint) {
+			continue
+		}
+		if strings.HasPrefix(mountPoint, "/dev") || strings.HasPrefix(mountPoint, "/proc") || strings.HasPrefix(mountPoint, "/sys") {
+			continue
+		}
+		if !(strings.Contains(device, "/") || device == "tmpfs") || !strings.HasPrefix(mountPoint, "/") {
+			continue
+		}
+
+		id, err := d.deviceID(mountPoint)
+		if err != nil {
+			d.log.Debug("Path ", mountPoint, " is not mounted - skipping")
+			continue
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if resolved, err := filepath.EvalSymlinks(device); err == nil {
+			device = resolved
+		}
+		mounts = append(mounts, diskspaceMount{device: device, mountPoint: mountPoint})
+	}
+	return mounts, scanner.Err()
+}
+
+// diskLabels maps device nodes to their filesystem labels
+func (d *DiamondDiskSpace) diskLabels() map[string]string {
+	labels := map[string]string{}
+	entries, err := ioutil.ReadDir(d.labelsPath)
+	if err != nil {
+		return labels
+	}
+	for _, entry := range entries {
+		device, err := filepath.EvalSymlinks(filepath.Join(d.labelsPath, entry.Name()))
+		if err != nil {
+			continue
+		}
+		labels[device] = strings.Replace(entry.Name(), `\x2f`, "/", -1)
+	}
+	return labels
+}
+
+func diskspaceStatfs(path string) (diskspaceUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return diskspaceUsage{}, err
+	}
+	// statfs(2) has no f_favail, on Linux statvfs(3) fills it from f_ffree
+	return diskspaceUsage{
+		blockSize:   float64(stat.Bsize),
+		blocksTotal: float64(stat.Blocks),
+		blocksFree:  float64(stat.Bfree),
+		blocksAvail: float64(stat.Bavail),
+		inodesTotal: float64(stat.Files),
+		inodesFree:  float64(stat.Ffree),
+		inodesAvail: float64(stat.Ffree),
+	}, nil
+}
+
+func diskspaceDeviceID(path string) (uint64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Dev), nil
+}
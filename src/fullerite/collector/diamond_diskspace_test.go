@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiamondDiskSpace(t *testing.T, configMap map[string]interface{}) (*DiamondDiskSpace, string) {
+	procPath := diamondProcDir(t, map[string]string{"mounts": diamondFixture("diskspace", "proc_mounts")})
+	configMap["procPath"] = procPath
+
+	d := newDiamondDiskSpace(nil, 10, defaultLog).(*DiamondDiskSpace)
+	d.SetCanonicalName("DiskSpaceCollector")
+	d.Configure(configMap)
+	d.labelsPath = "/nonexistent/by-label"
+	d.statfs = func(string) (diskspaceUsage, error) {
+		return diskspaceUsage{
+			blockSize:   4096,
+			blocksTotal: 360540255,
+			blocksFree:  285953527,
+			blocksAvail: 267639130,
+			inodesTotal: 91578368,
+			inodesFree:  91229495,
+			inodesAvail: 91229495,
+		}, nil
+	}
+	// every mount point is on the same device, so only the first is reported
+	d.deviceID = func(string) (uint64, error) { return 42, nil }
+	return d, procPath
+}
+
+func TestDiamondDiskSpaceCollect(t *testing.T) {
+	d, procPath := newTestDiamondDiskSpace(t, map[string]interface{}{"byte_unit": []interface{}{"byte", "gigabyte"}})
+	defer os.RemoveAll(procPath)
+
+	assertDiamondPayload(t, "DiskSpaceCollector", d.collectDiskSpace())
+}
+
+func TestDiamondDiskSpaceFileSystems(t *testing.T) {
+	d, procPath := newTestDiamondDiskSpace(t, map[string]interface{}{})
+	defer os.RemoveAll(procPath)
+
+	mounts, err := d.fileSystems()
+	require.Nil(t, err)
+	require.Len(t, mounts, 1)
+	assert.Equal(t, "/", mounts[0].mountPoint)
+
+	d.Configure(map[string]interface{}{"exclude_filters": "^/$"})
+	mounts, err = d.fileSystems()
+	assert.Nil(t, err)
+	assert.Empty(t, mounts)
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+var diamondLoadavgRE = regexp.MustCompile(`^([\d.]+) ([\d.]+) ([\d.]+) (\d+)/(\d+)`)
+
+// DiamondLoadAverage is the native port of Diamond's LoadAverageCollector.
+// It reports the 1, 5 and 15 minute load averages and the running and
+// total process counts from /proc/loadavg. With simple set only the 1
+// minute load average is reported.
+type DiamondLoadAverage struct {
+	diamondCompat
+
+	simple bool
+}
+
+func init() {
+	registerNativeDiamondCollector("LoadAverageCollector", newDiamondLoadAverage)
+	RegisterSchema("LoadAverageCollector", config.Schema{
+		{Key: "simple", Type: config.Bool, Default: false, Description: "Only reports the load averages"},
+	})
+}
+
+func newDiamondLoadAverage(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	d := new(DiamondLoadAverage)
+	d.initDiamondCompat(channel, initialInterval, log, "LoadAverageCollector", "loadavg")
+	return d
+}
+
+// Configure the collector
+func (d *DiamondLoadAverage) Configure(configMap map[string]interface{}) {
+	d.configureDiamondParams(configMap)
+
+	if val, exists := configMap["simple"]; exists {
+		d.simple = diamondBool(val, false)
+	}
+}
+
+// Collect publishes the load averages
+func (d *DiamondLoadAverage) Collect() {
+	metrics, err := d.collectLoadavg()
+	if err != nil {
+		d.log.Error("Failed to collect load averages: ", err)
+		return
+	}
+	for _, m := range metrics {
+		d.Channel() <- m
+	}
+}
+
+func (d *DiamondLoadAverage) collectLoadavg() ([]metric.Metric, error) {
+	contents, err := ioutil.ReadFile(d.proc("loadavg"))
+	if err != nil {
+		return nil, err
+	}
+	match := diamondLoadavgRE.FindStringSubmatch(string(contents))
+	if match == nil {
+		return nil, fmt.Errorf("unexpected /proc/loadavg contents %q", contents)
+	}
+
+	names := []string{"loadavg.01", "loadavg.05", "loadavg.15", "loadavg.processes_running", "loadavg.processes_total"}
+	metrics := []metric.Metric{}
+	for i, name := range names {
+		if d.simple && (i == 1 || i == 2) {
+			continue
+		}
+		value, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := d.diamondMetric(name, value, metric.Gauge, nil); ok {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, nil
+}
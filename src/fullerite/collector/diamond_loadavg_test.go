@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiamondLoadAverageCollect(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"loadavg": diamondFixture("loadavg", "proc_loadavg")})
+	defer os.RemoveAll(procPath)
+
+	d := newDiamondLoadAverage(nil, 10, defaultLog).(*DiamondLoadAverage)
+	d.SetCanonicalName("LoadAverageCollector")
+	d.Configure(map[string]interface{}{"procPath": procPath})
+
+	metrics, err := d.collectLoadavg()
+	assert.Nil(t, err)
+	assertDiamondPayload(t, "LoadAverageCollector", metrics)
+}
+
+func TestDiamondLoadAverageSimple(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"loadavg": diamondFixture("loadavg", "proc_loadavg")})
+	defer os.RemoveAll(procPath)
+
+	d := newDiamondLoadAverage(nil, 10, defaultLog).(*DiamondLoadAverage)
+	d.Configure(map[string]interface{}{"procPath": procPath, "simple": "True"})
+
+	metrics, err := d.collectLoadavg()
+	assert.Nil(t, err)
+	names := []string{}
+	for _, m := range metrics {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"loadavg.01", "loadavg.processes_running", "loadavg.processes_total"}, names)
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+// The /proc/meminfo entries reported unless detailed is set
+var diamondMemoryKeys = map[string]bool{
+	"MemAvailable": true, "MemTotal": true, "MemFree": true,
+	"Buffers": true, "Cached": true, "Active": true, "Dirty": true,
+	"Inactive": true, "Shmem": true, "SwapTotal": true, "SwapFree": true,
+	"SwapCached": true, "VmallocTotal": true, "VmallocUsed": true,
+	"VmallocChunk": true, "Committed_AS": true, "Mapped": true, "Mlocked": true,
+}
+
+// DiamondMemory is the native port of Diamond's MemoryCollector. It
+// reports the /proc/meminfo entries as gauges converted to the first
+// byte_unit. Setting detailed reports every entry.
+type DiamondMemory struct {
+	diamondCompat
+
+	detailed bool
+}
+
+func init() {
+	registerNativeDiamondCollector("MemoryCollector", newDiamondMemory)
+	RegisterSchema("MemoryCollector", config.Schema{
+		{Key: "detailed", Type: config.Any, Description: "Reports every field of meminfo when present, whatever its value"},
+	})
+}
+
+func newDiamondMemory(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	m := new(DiamondMemory)
+	m.initDiamondCompat(channel, initialInterval, log, "MemoryCollector", "memory")
+	return m
+}
+
+// Configure the collector
+func (m *DiamondMemory) Configure(configMap map[string]interface{}) {
+	m.configureDiamondParams(configMap)
+
+	// the Python collector only checks whether the key is present
+	_, m.detailed = configMap["detailed"]
+}
+
+// Collect publishes the memory stats
+func (m *DiamondMemory) Collect() {
+	metrics, err := m.collectMemory()
+	if err != nil {
+		m.log.Error("Failed to collect memory metrics: ", err)
+		return
+	}
+	for _, mem := range metrics {
+		m.Channel() <- mem
+	}
+}
+
+func (m *DiamondMemory) collectMemory() ([]metric.Metric, error) {
+	if len(m.byteUnits) == 0 {
+		return nil, nil
+	}
+	unit := m.byteUnits[0]
+
+	file, err := os.Open(m.proc("meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metrics := []metric.Metric{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// entries without a unit, like HugePages_Total, are skipped
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[0], ":")
+		if !m.detailed && !diamondMemoryKeys[name] {
+			continue
+		}
+		raw, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		value, err := convertDiamondBytes(float64(raw), fields[2], unit)
+		if err != nil {
+			m.log.Warn("Skipping ", name, ": ", err)
+			continue
+		}
+		if mem, ok := m.diamondMetric(name, value, metric.Gauge, nil); ok {
+			metrics = append(metrics, mem)
+		}
+	}
+	return metrics, scanner.Err()
+}
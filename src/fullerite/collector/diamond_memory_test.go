@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiamondMemoryCollect(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"meminfo": diamondFixture("memory", "proc_meminfo")})
+	defer os.RemoveAll(procPath)
+
+	m := newDiamondMemory(nil, 10, defaultLog).(*DiamondMemory)
+	m.SetCanonicalName("MemoryCollector")
+	m.Configure(map[string]interface{}{"procPath": procPath})
+
+	metrics, err := m.collectMemory()
+	assert.Nil(t, err)
+	assertDiamondPayload(t, "MemoryCollector", metrics)
+}
+
+func TestDiamondMemoryByteUnit(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"meminfo": diamondFixture("memory", "proc_meminfo")})
+	defer os.RemoveAll(procPath)
+
+	m := newDiamondMemory(nil, 10, defaultLog).(*DiamondMemory)
+	m.Configure(map[string]interface{}{"procPath": procPath, "byte_unit": "kilobyte"})
+
+	metrics, err := m.collectMemory()
+	assert.Nil(t, err)
+	for _, mem := range metrics {
+		if mem.Name == "MemTotal" {
+			assert.Equal(t, 49554212.0, mem.Value)
+		}
+	}
+}
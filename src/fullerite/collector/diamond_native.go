@@ -0,0 +1,253 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+const (
+	diamondDefaultPathPrefix = "servers"
+	diamondDefaultProcPath   = "/proc"
+)
+
+// nativeDiamondCollectors holds the Python Diamond collectors that have a
+// Go port in this package
+var nativeDiamondCollectors = map[string]bool{}
+
+// registerNativeDiamondCollector registers a Go port of a Python Diamond
+// collector under the Python class name so the same name (and the same
+// <ClassName>.conf file) works for both.
+func registerNativeDiamondCollector(name string, f func(chan metric.Metric, int, *l.Entry) Collector) {
+	nativeDiamondCollectors[name] = true
+	RegisterCollector(name, f)
+}
+
+// IsNativeDiamondCollector returns true if the Diamond collector has a
+// native Go port. Like collector names, the name may have an instance
+// suffix, e.g. "CPUCollector second".
+func IsNativeDiamondCollector(name string) bool {
+	return nativeDiamondCollectors[strings.Split(name, " ")[0]]
+}
+
+// diamondCompat is embedded by the native ports of Diamond collectors. It
+// builds metrics exactly as the Python collector would publish them and
+// the Diamond collector would read them back: the metric name is the part
+// of the Diamond path after the collector, and the path prefix, collector
+// path and collector name become dimensions.
+type diamondCompat struct {
+	baseCollector
+
+	path        string
+	pathPrefix  string
+	pathSuffix  string
+	byteUnits   []string
+	procPath    string
+	whitelistRE *regexp.Regexp
+	blacklistRE *regexp.Regexp
+}
+
+func (d *diamondCompat) initDiamondCompat(channel chan metric.Metric, initialInterval int, log *l.Entry, name, diamondPath string) {
+	d.log = log
+	d.channel = channel
+	d.interval = initialInterval
+	d.name = name
+
+	d.path = diamondPath
+	d.pathPrefix = diamondDefaultPathPrefix
+	d.byteUnits = []string{"byte"}
+	d.procPath = diamondDefaultProcPath
+}
+
+// configureDiamondParams reads the configuration keys every Diamond
+// collector understands
+func (d *diamondCompat) configureDiamondParams(configMap map[string]interface{}) {
+	// Diamond's metrics_blacklist is a single regex rather than a list,
+	// so it must not reach configureCommonParams
+	commonConfig := make(map[string]interface{}, len(configMap))
+	for k, v := range configMap {
+		commonConfig[k] = v
+	}
+	if blacklist, ok := configMap["metrics_blacklist"].(string); ok && !strings.HasPrefix(blacklist, "[") {
+		delete(commonConfig, "metrics_blacklist")
+		d.blacklistRE = d.compileDiamondFilter(blacklist)
+	}
+	d.configureCommonParams(commonConfig)
+
+	if whitelist, ok := configMap["metrics_whitelist"].(string); ok {
+		d.whitelistRE = d.compileDiamondFilter(whitelist)
+	}
+	if val, ok := configMap["path"].(string); ok {
+		d.path = val
+	}
+	if val, ok := configMap["path_prefix"].(string); ok {
+		d.pathPrefix = val
+	}
+	if val, ok := configMap["path_suffix"].(string); ok {
+		d.pathSuffix = val
+	}
+	if val, exists := configMap["byte_unit"]; exists {
+		d.byteUnits = diamondList(val, strings.Fields)
+	}
+	if val, ok := configMap["procPath"].(string); ok {
+		d.procPath = val
+	}
+}
+
+// compileDiamondFilter anchors the expression at the start of the metric
+// name, as Python's re.match does
+func (d *diamondCompat) compileDiamondFilter(expr string) *regexp.Regexp {
+	if expr == "" {
+		return nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")")
+	if err != nil {
+		d.log.Error("Ignoring invalid metric filter ", expr, ": ", err)
+		return nil
+	}
+	return re
+}
+
+// proc returns the path of a file under /proc
+func (d *diamondCompat) proc(name string) string {
+	return path.Join(d.procPath, name)
+}
+
+// diamondMetric builds the metric Diamond would publish as name. It
+// returns false when the metric is filtered out by metrics_whitelist or
+// metrics_blacklist.
+func (d *diamondCompat) diamondMetric(name string, value float64, metricType string, dims map[string]string) (metric.Metric, bool) {
+	if d.whitelistRE != nil {
+		if !d.whitelistRE.MatchString(name) {
+			return metric.Metric{}, false
+		}
+	} else if d.blacklistRE != nil && d.blacklistRE.MatchString(name) {
+		return metric.Metric{}, false
+	}
+
+	prefix := d.pathPrefix
+	if d.pathSuffix != "" {
+		prefix = prefix + "." + d.pathSuffix
+	}
+	fullPath := prefix + "." + name
+	if d.path != "." {
+		fullPath = prefix + "." + d.path + "." + name
+	}
+	parts := strings.Split(fullPath, ".")
+
+	m := metric.New(strings.Join(parts[2:], "."))
+	m.MetricType = metricType
+	m.Value = value
+	m.AddDimension("prefix", parts[0])
+	m.AddDimension("collector", parts[1])
+	m.AddDimension("collectorCanonicalName", d.CanonicalName())
+	m.AddDimension("diamond", "yes")
+	m.AddDimensions(dims)
+	return m, true
+}
+
+// publish builds the metric and sends it on the collector channel
+func (d *diamondCompat) publish(name string, value float64, metricType string, dims map[string]string) {
+	if m, ok := d.diamondMetric(name, value, metricType, dims); ok {
+		d.Channel() <- m
+	}
+}
+
+// diamondList reads a Diamond list option, which may be given as a list
+// or as a string that split separates
+func diamondList(value interface{}, split func(string) []string) []string {
+	if str, ok := value.(string); ok {
+		result := []string{}
+		for _, item := range split(str) {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+	return config.GetAsSlice(value)
+}
+
+// splitDiamondCSV splits a comma separated Diamond option
+func splitDiamondCSV(str string) []string {
+	return strings.Split(str, ",")
+}
+
+// containsString tells whether list has value
+func containsString(value string, list []string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// diamondBool parses booleans the way Diamond's str_to_bool does
+func diamondBool(value interface{}, defaultValue bool) bool {
+	if str, ok := value.(string); ok {
+		switch strings.ToLower(strings.TrimSpace(str)) {
+		case "true", "t", "yes", "y":
+			return true
+		case "false", "f", "no", "n", "":
+			return false
+		}
+	}
+	return config.GetAsBool(value, defaultValue)
+}
+
+// diamondByteUnits lists the units diamond.convertor.binary understands,
+// with whether the unit counts bytes and its power of 1024
+var diamondByteUnits = map[string]struct {
+	bytes bool
+	power float64
+}{
+	"bit": {false, 0}, "b": {false, 0},
+	"kilobit": {false, 1}, "kbit": {false, 1}, "Kibit": {false, 1},
+	"megabit": {false, 2}, "Mbit": {false, 2}, "Mibit": {false, 2},
+	"gigabit": {false, 3}, "Gbit": {false, 3}, "Gibit": {false, 3},
+	"terabit": {false, 4}, "Tbit": {false, 4}, "Tibit": {false, 4},
+	"petabit": {false, 5}, "Pbit": {false, 5}, "Pibit": {false, 5},
+	"exabit": {false, 6}, "Ebit": {false, 6}, "Eibit": {false, 6},
+	"zettabit": {false, 7}, "Zbit": {false, 7}, "Zibit": {false, 7},
+	"yottabit": {false, 8}, "Ybit": {false, 8}, "Yibit": {false, 8},
+	"byte": {true, 0}, "B": {true, 0},
+	"kilobyte": {true, 1}, "kB": {true, 1}, "KiB": {true, 1},
+	"megabyte": {true, 2}, "MB": {true, 2}, "MiB": {true, 2}, "Mbyte": {true, 2},
+	"gigabyte": {true, 3}, "GB": {true, 3}, "GiB": {true, 3},
+	"terabyte": {true, 4}, "TB": {true, 4}, "TiB": {true, 4},
+	"petabyte": {true, 5}, "PB": {true, 5}, "PiB": {true, 5},
+	"exabyte": {true, 6}, "EB": {true, 6}, "EiB": {true, 6},
+	"zettabyte": {true, 7}, "ZB": {true, 7}, "ZiB": {true, 7},
+	"yottabyte": {true, 8}, "YB": {true, 8}, "YiB": {true, 8},
+}
+
+// convertDiamondBytes converts between binary units. The arithmetic is
+// done in the same order as diamond.convertor.binary so the results match
+// to the last bit.
+func convertDiamondBytes(value float64, oldUnit, newUnit string) (float64, error) {
+	from, ok := diamondByteUnits[oldUnit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %s", oldUnit)
+	}
+	to, ok := diamondByteUnits[newUnit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %s", newUnit)
+	}
+
+	bits := value * math.Pow(1024, from.power)
+	if from.bytes {
+		bits *= 8
+	}
+	if to.bytes {
+		bits /= 8
+	}
+	return bits / math.Pow(1024, to.power), nil
+}
@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+// Columns of an interface line in /proc/net/dev, in order
+var diamondNetworkFields = []string{
+	"rx_bytes", "rx_packets", "rx_errors", "rx_drop", "rx_fifo",
+	"rx_frame", "rx_compressed", "rx_multicast",
+	"tx_bytes", "tx_packets", "tx_errors", "tx_drop", "tx_fifo",
+	"tx_colls", "tx_carrier", "tx_compressed",
+}
+
+// DiamondNetwork is the native port of Diamond's NetworkCollector. It
+// reports the /proc/net/dev counters of the interfaces whose name starts
+// with one of interfaces (or is one of them when greedy is false) as
+// net.<counter> with an iface dimension. Byte counters are reported once
+// per byte_unit, e.g. net.rx_bit and net.rx_byte.
+type DiamondNetwork struct {
+	diamondCompat
+
+	interfaces []string
+	greedy     bool
+	deviceRE   *regexp.Regexp
+}
+
+func init() {
+	registerNativeDiamondCollector("NetworkCollector", newDiamondNetwork)
+	RegisterSchema("NetworkCollector", config.Schema{
+		{Key: "interfaces", Type: config.StringOrList, Description: "Interface name prefixes to report"},
+		{Key: "greedy", Type: config.Bool, Default: true, Description: "Matches the interfaces by prefix"},
+	})
+}
+
+func newDiamondNetwork(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	n := new(DiamondNetwork)
+	n.initDiamondCompat(channel, initialInterval, log, "NetworkCollector", "network")
+
+	n.byteUnits = []string{"bit", "byte"}
+	n.interfaces = []string{"eth", "bond", "em", "p1p", "tun"}
+	n.greedy = true
+	n.compileDeviceRE()
+	return n
+}
+
+// Configure the collector
+func (n *DiamondNetwork) Configure(configMap map[string]interface{}) {
+	n.configureDiamondParams(configMap)
+
+	if val, exists := configMap["interfaces"]; exists {
+		n.interfaces = diamondList(val, splitDiamondCSV)
+	}
+	if val, exists := configMap["greedy"]; exists {
+		n.greedy = diamondBool(val, true)
+	}
+	n.compileDeviceRE()
+}
+
+func (n *DiamondNetwork) compileDeviceRE() {
+	greed := ""
+	if n.greedy {
+		greed = `\S*`
+	}
+	// interfaces are regular expressions in the Python collector too
+	expr := fmt.Sprintf(`^\s*((?:%s)%s):`, strings.Join(n.interfaces, "|"), greed)
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		n.log.Error("Invalid interfaces ", n.interfaces, ": ", err)
+		re = nil
+	}
+	n.deviceRE = re
+}
+
+// Collect publishes the interface counters
+func (n *DiamondNetwork) Collect() {
+	metrics, err := n.collectNetwork()
+	if err != nil {
+		n.log.Error("Failed to collect network metrics: ", err)
+		return
+	}
+	for _, m := range metrics {
+		n.Channel() <- m
+	}
+}
+
+func (n *DiamondNetwork) collectNetwork() ([]metric.Metric, error) {
+	if n.deviceRE == nil {
+		return nil, nil
+	}
+
+	file, err := os.Open(n.proc("net/dev"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metrics := []metric.Metric{}
+	add := func(name string, value float64, device string) {
+		if m, ok := n.diamondMetric(name, value, metric.CumulativeCounter, map[string]string{"iface": device}); ok {
+			metrics = append(metrics, m)
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		match := n.deviceRE.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		device := match[1]
+		columns := strings.Fields(line[len(match[0]):])
+		if len(columns) < len(diamondNetworkFields) {
+			continue
+		}
+
+		for i, field := range diamondNetworkFields {
+			value, err := strconv.ParseFloat(columns[i], 64)
+			if err != nil {
+				n.log.Warn("Skipping ", field, " of ", device, ": ", err)
+				continue
+			}
+			if field != "rx_bytes" && field != "tx_bytes" {
+				add("net."+field, value, device)
+				continue
+			}
+			for _, unit := range n.byteUnits {
+				converted, err := convertDiamondBytes(value, "byte", unit)
+				if err != nil {
+					n.log.Warn("Skipping ", field, ": ", err)
+					continue
+				}
+				add("net."+strings.Replace(field, "bytes", unit, -1), converted, device)
+			}
+		}
+	}
+	return metrics, scanner.Err()
+}
@@ -0,0 +1,41 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiamondNetworkCollect(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"net/dev": diamondFixture("network", "proc_net_dev_2")})
+	defer os.RemoveAll(procPath)
+
+	n := newDiamondNetwork(nil, 10, defaultLog).(*DiamondNetwork)
+	n.SetCanonicalName("NetworkCollector")
+	n.Configure(map[string]interface{}{
+		"procPath":   procPath,
+		"byte_unit":  []interface{}{"bit", "megabyte"},
+		"interfaces": []interface{}{"eth", "em", "veth"},
+	})
+
+	metrics, err := n.collectNetwork()
+	assert.Nil(t, err)
+	assertDiamondPayload(t, "NetworkCollector", metrics)
+}
+
+func TestDiamondNetworkNotGreedy(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{"net/dev": diamondFixture("network", "proc_net_dev_2")})
+	defer os.RemoveAll(procPath)
+
+	n := newDiamondNetwork(nil, 10, defaultLog).(*DiamondNetwork)
+	n.Configure(map[string]interface{}{"procPath": procPath, "interfaces": "eth0", "greedy": "False"})
+
+	metrics, err := n.collectNetwork()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, metrics)
+	for _, m := range metrics {
+		iface, _ := m.GetDimensionValue("iface")
+		assert.Equal(t, "eth0", iface)
+	}
+}
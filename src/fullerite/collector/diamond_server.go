@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+// Python's logging in the Diamond server formats its lines as
+// "%(asctime)s - %(name)s - %(levelname)s - %(message)s"
+var diamondServerLogRE = regexp.MustCompile(`^\S+ \S+ - (\S+) - (DEBUG|INFO|WARNING|WARN|ERROR|CRITICAL) - (.*)$`)
+
+// diamondServer runs the Python Diamond server as a child process and
+// restarts it with an exponential backoff whenever it exits. When
+// hangTimeout is set a server from which nothing was received for that
+// long is considered hung and killed.
+type diamondServer struct {
+	command      []string
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	hangTimeout  time.Duration
+	lastActivity func() time.Time
+	log          *l.Entry
+
+	mu        sync.Mutex
+	restarts  int
+	startedAt time.Time
+	running   bool
+}
+
+// Restarts returns how many times the server had to be restarted
+func (s *diamondServer) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Uptime returns for how long the current server process has been
+// running, zero when it is not running
+func (s *diamondServer) Uptime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return 0
+	}
+	return time.Since(s.startedAt)
+}
+
+// supervise keeps the server running until quit is closed
+func (s *diamondServer) supervise(quit <-chan struct{}) {
+	backoff := s.minBackoff
+	for {
+		started := time.Now()
+		err := s.runOnce(quit)
+
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		// a server that stayed up for a while starts over with a short backoff
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		s.log.Error("Diamond server exited (", err, "), restarting it in ", backoff)
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(backoff):
+		}
+
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// runOnce starts the server and waits for it to exit. The server runs in
+// its own process group so that the collector processes it forked are
+// killed along with it; they share its output, so the output is only
+// done once all of them are gone.
+func (s *diamondServer) runOnce(quit <-chan struct{}) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	cmd.SysProcAttr = diamondServerSysProcAttr()
+
+	s.log.Info("Starting diamond server: ", s.command)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+
+	s.mu.Lock()
+	s.running = true
+	s.startedAt = time.Now()
+	s.mu.Unlock()
+
+	output := make(chan struct{})
+	go func() {
+		s.logOutput(r)
+		close(output)
+	}()
+
+	// watched makes sure the watcher is gone, and done logging, by the time
+	// the supervisor returns
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		s.watch(pid, quit, done)
+		close(watched)
+	}()
+
+	state, err := cmd.Process.Wait()
+	close(done)
+	<-watched
+	syscall.Kill(-pid, syscall.SIGKILL)
+	<-output
+
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return errors.New(state.String())
+}
+
+// watch kills the server process group when fullerite asks to quit or
+// when the server looks hung
+func (s *diamondServer) watch(pid int, quit <-chan struct{}, done <-chan struct{}) {
+	var hangCheck <-chan time.Time
+	if s.hangTimeout > 0 {
+		ticker := time.NewTicker(s.hangTimeout / 2)
+		defer ticker.Stop()
+		hangCheck = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-quit:
+			syscall.Kill(-pid, syscall.SIGKILL)
+			return
+		case <-hangCheck:
+			s.mu.Lock()
+			last := s.startedAt
+			s.mu.Unlock()
+			if activity := s.lastActivity(); activity.After(last) {
+				last = activity
+			}
+			if time.Since(last) > s.hangTimeout {
+				s.log.Error("Nothing received from the diamond server for ", time.Since(last), ", killing it")
+				syscall.Kill(-pid, syscall.SIGKILL)
+				return
+			}
+		}
+	}
+}
+
+// logOutput copies the server's output into fullerite's log, at the level
+// of the Python log line. Lines that aren't log lines, such as the rest
+// of a traceback, use the level of the line before them.
+// Lines have no length limit, and the output is read until it is closed
+// whatever happens, so that the server never blocks writing to it.
+func (s *diamondServer) logOutput(r io.Reader) {
+	logf := s.log.Info
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			if match := diamondServerLogRE.FindStringSubmatch(line); match != nil {
+				logf = s.logFunc(match[2])
+				logf(fmt.Sprintf("[%s] %s", match[1], match[3]))
+			} else {
+				logf(line)
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.log.Error("Failed to read the Diamond server output: ", err)
+			io.Copy(ioutil.Discard, r)
+			return
+		}
+	}
+}
+
+func (s *diamondServer) logFunc(level string) func(...interface{}) {
+	switch level {
+	case "DEBUG":
+		return s.log.Debug
+	case "WARNING", "WARN":
+		return s.log.Warn
+	case "ERROR", "CRITICAL":
+		return s.log.Error
+	}
+	return s.log.Info
+}
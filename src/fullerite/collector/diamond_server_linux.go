@@ -0,0 +1,11 @@
+// +build linux
+
+package collector
+
+import "syscall"
+
+// diamondServerSysProcAttr puts the Diamond server in its own process
+// group and has the kernel stop it if fullerite dies
+func diamondServerSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGTERM}
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package collector
+
+import "syscall"
+
+// diamondServerSysProcAttr puts the Diamond server in its own process group
+func diamondServerSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiamondServer(command ...string) *diamondServer {
+	log, _ := getTestableLogger()
+	return &diamondServer{
+		command:      command,
+		minBackoff:   10 * time.Millisecond,
+		maxBackoff:   40 * time.Millisecond,
+		lastActivity: func() time.Time { return time.Time{} },
+		log:          log,
+	}
+}
+
+// superviseUntil runs the server until cond holds and returns once the
+// supervisor stopped, along with the goroutines logging to the test hook
+func superviseUntil(t *testing.T, s *diamondServer, cond func() bool) {
+	quit := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		s.supervise(quit)
+		close(stopped)
+	}()
+
+	met := false
+	for deadline := time.Now().Add(5 * time.Second); !met && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		met = cond()
+	}
+	close(quit)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor did not stop")
+	}
+	require.True(t, met, "condition not met in time")
+}
+
+func TestDiamondServerRestarts(t *testing.T) {
+	log, hook := getTestableLogger()
+	s := newTestDiamondServer("sh", "-c", "echo '2016-01-02 10:00:00,000 - diamond - ERROR - boom' >&2; echo Traceback >&2; exit 3")
+	s.log = log
+
+	superviseUntil(t, s, func() bool { return s.Restarts() >= 2 })
+
+	logged := map[string]l.Level{}
+	for _, entry := range hook.Entries {
+		logged[entry.Message] = entry.Level
+	}
+	assert.Equal(t, l.ErrorLevel, logged["[diamond] boom"])
+	assert.Equal(t, l.ErrorLevel, logged["Traceback"], "continuation lines keep the level of the log line")
+
+	exited := false
+	for message := range logged {
+		if message == "Diamond server exited (exit status 3), restarting it in 10ms" {
+			exited = true
+		}
+	}
+	assert.True(t, exited)
+}
+
+func TestDiamondServerUptime(t *testing.T) {
+	s := newTestDiamondServer("sleep", "30")
+
+	superviseUntil(t, s, func() bool { return s.Uptime() > 0 })
+	assert.Equal(t, time.Duration(0), s.Uptime(), "the server is killed when the supervisor stops")
+	assert.Equal(t, 0, s.Restarts())
+}
+
+func TestDiamondServerHang(t *testing.T) {
+	s := newTestDiamondServer("sleep", "30")
+	s.hangTimeout = 100 * time.Millisecond
+
+	superviseUntil(t, s, func() bool { return s.Restarts() >= 1 })
+}
+
+func TestDiamondServerNotHung(t *testing.T) {
+	s := newTestDiamondServer("sleep", "30")
+	s.hangTimeout = 100 * time.Millisecond
+	s.lastActivity = time.Now
+
+	superviseUntil(t, s, func() bool { return s.Uptime() > 300*time.Millisecond })
+	assert.Equal(t, 0, s.Restarts())
+}
+
+func TestDiamondServerLogsLongLines(t *testing.T) {
+	log, hook := getTestableLogger()
+	s := newTestDiamondServer()
+	s.log = log
+
+	long := strings.Repeat("x", 100*1024)
+	s.logOutput(strings.NewReader(long + "\n2016-01-02 10:00:00,000 - diamond - WARNING - after\n"))
+
+	require.Len(t, hook.Entries, 2)
+	assert.Equal(t, long, hook.Entries[0].Message)
+	assert.Equal(t, "[diamond] after", hook.Entries[1].Message)
+	assert.Equal(t, l.WarnLevel, hook.Entries[1].Level)
+}
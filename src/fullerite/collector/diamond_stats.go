@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"fullerite/metric"
+
+	"sync"
+)
+
+// diamondCounts are the line counters of a diamond collector or
+// connection
+type diamondCounts struct {
+	received      float64
+	parseFailures float64
+	dropped       float64
+}
+
+// diamondStats accounts the lines read by the Diamond collector per
+// canonical collector name and per open connection
+type diamondStats struct {
+	mu           sync.Mutex
+	lastID       int
+	collectors   map[string]*diamondCounts
+	connections  map[string]*diamondCounts
+	disconnected diamondCounts
+}
+
+func newDiamondStats() *diamondStats {
+	return &diamondStats{
+		collectors:  map[string]*diamondCounts{},
+		connections: map[string]*diamondCounts{},
+	}
+}
+
+func (s *diamondStats) nextConnectionID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	return s.lastID
+}
+
+func (s *diamondStats) openConnection(connection string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connections[connection] = &diamondCounts{}
+}
+
+// closeConnection forgets the connection, its counts carry on in those of
+// the closed connections
+func (s *diamondStats) closeConnection(connection string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if counts, exists := s.connections[connection]; exists {
+		s.disconnected.received += counts.received
+		s.disconnected.parseFailures += counts.parseFailures
+		s.disconnected.dropped += counts.dropped
+		delete(s.connections, connection)
+	}
+}
+
+func (s *diamondStats) received(connection, collector string) {
+	s.count(connection, collector, func(c *diamondCounts) { c.received++ })
+}
+
+func (s *diamondStats) parseFailed(connection, collector string) {
+	s.count(connection, collector, func(c *diamondCounts) { c.parseFailures++ })
+}
+
+func (s *diamondStats) dropped(connection, collector string) {
+	s.count(connection, collector, func(c *diamondCounts) { c.dropped++ })
+}
+
+func (s *diamondStats) count(connection, collector string, inc func(*diamondCounts)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts, exists := s.collectors[collector]
+	if !exists {
+		counts = &diamondCounts{}
+		s.collectors[collector] = counts
+	}
+	inc(counts)
+
+	if counts, exists := s.connections[connection]; exists {
+		inc(counts)
+	} else {
+		// a line dropped after its connection closed
+		inc(&s.disconnected)
+	}
+}
+
+// internalMetrics returns the counts of every collector under its
+// canonical name and the counts of every open connection under
+// "Diamond connection <name>"
+func (s *diamondStats) internalMetrics() map[string]metric.InternalMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := map[string]metric.InternalMetrics{}
+	for name, counts := range s.collectors {
+		stats[name] = counts.internalMetrics()
+	}
+	for name, counts := range s.connections {
+		stats["Diamond connection "+name] = counts.internalMetrics()
+	}
+	stats["Diamond closed connections"] = s.disconnected.internalMetrics()
+	return stats
+}
+
+func (c diamondCounts) internalMetrics() metric.InternalMetrics {
+	return metric.InternalMetrics{
+		Counters: map[string]float64{
+			"fullerite.diamond_lines_received": c.received,
+			"fullerite.diamond_parse_failures": c.parseFailures,
+			"fullerite.diamond_lines_dropped":  c.dropped,
+		},
+		Gauges: map[string]float64{},
+	}
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+// The TCP stats reported unless allowed_names says otherwise
+var diamondTCPDefaultNames = []string{
+	"ListenOverflows", "ListenDrops", "TCPLoss", "TCPTimeouts",
+	"TCPFastRetrans", "TCPLostRetransmit", "TCPForwardRetrans",
+	"TCPSlowStartRetrans", "CurrEstab", "MaxConn", "TCPAbortOnMemory",
+	"TCPBacklogDrop", "AttemptFails", "EstabResets", "InErrs",
+	"ActiveOpens", "PassiveOpens", "RetransSegs",
+}
+
+// TCP stats that are gauges, everything else is a cumulative counter
+var diamondTCPGauges = map[string]bool{"CurrEstab": true, "MaxConn": true}
+
+// DiamondTCP is the native port of Diamond's TCPCollector. It reports the
+// TCP stats of /proc/net/netstat and /proc/net/snmp as tcp.<name>. An
+// empty allowed_names reports every stat.
+type DiamondTCP struct {
+	diamondCompat
+
+	allowedNames []string
+}
+
+func init() {
+	registerNativeDiamondCollector("TCPCollector", newDiamondTCP)
+	RegisterSchema("TCPCollector", config.Schema{
+		{Key: "allowed_names", Type: config.StringOrList, Description: "Only counters to report"},
+	})
+}
+
+func newDiamondTCP(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	t := new(DiamondTCP)
+	t.initDiamondCompat(channel, initialInterval, log, "TCPCollector", "tcp")
+
+	t.allowedNames = diamondTCPDefaultNames
+	return t
+}
+
+// Configure the collector
+func (t *DiamondTCP) Configure(configMap map[string]interface{}) {
+	t.configureDiamondParams(configMap)
+
+	if val, exists := configMap["allowed_names"]; exists {
+		t.allowedNames = []string{}
+		if val != nil {
+			t.allowedNames = diamondList(val, splitDiamondCSV)
+		}
+	}
+}
+
+// Collect publishes the TCP stats
+func (t *DiamondTCP) Collect() {
+	for _, m := range t.collectTCP() {
+		t.Channel() <- m
+	}
+}
+
+func (t *DiamondTCP) collectTCP() []metric.Metric {
+	stats := map[string]string{}
+	names := []string{}
+	for _, file := range []string{"net/netstat", "net/snmp"} {
+		header, values, err := readDiamondTCPStats(t.proc(file))
+		if err != nil {
+			t.log.Error("Failed to read TCP stats: ", err)
+			continue
+		}
+		for i := 1; i < len(header) && i < len(values); i++ {
+			if _, seen := stats[header[i]]; !seen {
+				names = append(names, header[i])
+			}
+			stats[header[i]] = values[i]
+		}
+	}
+
+	metrics := []metric.Metric{}
+	for _, name := range names {
+		if len(t.allowedNames) > 0 && !containsString(name, t.allowedNames) {
+			continue
+		}
+		value, err := strconv.ParseFloat(stats[name], 64)
+		if err != nil {
+			t.log.Warn("Skipping ", name, ": ", err)
+			continue
+		}
+
+		metricType := metric.CumulativeCounter
+		if diamondTCPGauges[name] {
+			metricType = metric.Gauge
+		}
+		if m, ok := t.diamondMetric("tcp."+name, value, metricType, nil); ok {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// readDiamondTCPStats returns the first line starting with "Tcp", which
+// names the stats, and the line of values that follows it
+func readDiamondTCPStats(path string) ([]string, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "Tcp") {
+			continue
+		}
+		header := strings.Fields(scanner.Text())
+		if !scanner.Scan() {
+			break
+		}
+		return header, strings.Fields(scanner.Text()), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, fmt.Errorf("%s has no lines with Tcp", path)
+}
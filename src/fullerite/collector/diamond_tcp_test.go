@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiamondTCPCollect(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{
+		"net/netstat": diamondFixture("tcp", "proc_net_netstat_2"),
+		"net/snmp":    diamondFixture("tcp", "proc_net_snmp_2"),
+	})
+	defer os.RemoveAll(procPath)
+
+	c := newDiamondTCP(nil, 10, defaultLog).(*DiamondTCP)
+	c.SetCanonicalName("TCPCollector")
+	c.Configure(map[string]interface{}{"procPath": procPath})
+
+	assertDiamondPayload(t, "TCPCollector", c.collectTCP())
+}
+
+func TestDiamondTCPAllowedNames(t *testing.T) {
+	procPath := diamondProcDir(t, map[string]string{
+		"net/netstat": diamondFixture("tcp", "proc_net_netstat_2"),
+		"net/snmp":    diamondFixture("tcp", "proc_net_snmp_2"),
+	})
+	defer os.RemoveAll(procPath)
+
+	c := newDiamondTCP(nil, 10, defaultLog).(*DiamondTCP)
+	c.Configure(map[string]interface{}{"procPath": procPath, "allowed_names": "CurrEstab, TCPLoss"})
+
+	names := []string{}
+	for _, m := range c.collectTCP() {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"tcp.TCPLoss", "tcp.CurrEstab"}, names)
+
+	c.Configure(map[string]interface{}{"allowed_names": []interface{}{}})
+	assert.True(t, len(c.collectTCP()) > len(diamondTCPDefaultNames), "an empty allowed_names reports everything")
+}
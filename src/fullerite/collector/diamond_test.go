@@ -8,7 +8,11 @@ import (
 
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -42,6 +46,13 @@ func TestDiamondConfigure(t *testing.T) {
 	assert.Equal(d.Port(), "0", "should be the defined port")
 }
 
+func TestDiamondConfigureNumericPort(t *testing.T) {
+	d := newDiamond(nil, 12, nil).(*Diamond)
+	d.Configure(map[string]interface{}{"port": float64(19191)})
+
+	assert.Equal(t, "19191", d.Port())
+}
+
 // The test contains a data race. the method `connectToDiamondCollector()` reads the port inside *Diamond
 // while this is written by the `go d.Collect()` routine
 func TestDiamondCollect(t *testing.T) {
@@ -128,3 +139,185 @@ func emitTestMetric(conn net.Conn) {
 	fmt.Fprintf(conn, string(b)+"\n")
 	fmt.Fprintf(conn, string(b)+"\n")
 }
+
+func TestDiamondConfigureServer(t *testing.T) {
+	config := map[string]interface{}{
+		"superviseServer":   "true",
+		"serverMinBackoff":  2,
+		"serverMaxBackoff":  "30",
+		"serverHangTimeout": 300,
+	}
+	d := newDiamond(nil, 12, nil).(*Diamond)
+	d.Configure(config)
+
+	assert.True(t, d.supervise)
+	assert.Equal(t, 2*time.Second, d.serverMinBackoff)
+	assert.Equal(t, 30*time.Second, d.serverMaxBackoff)
+	assert.Equal(t, 300*time.Second, d.serverHangTime)
+}
+
+func TestDiamondServerArgs(t *testing.T) {
+	d := newDiamond(nil, 12, nil).(*Diamond)
+	d.SetServerConfig("/etc/fullerite.conf", "src/diamond/collectors", []string{"CPUCollector", "PingCollector other"})
+
+	assert.Equal(t, []string{
+		"python", "src/diamond/server.py",
+		"-c", "/etc/fullerite.conf",
+		"--collectors_path", "src/diamond/collectors",
+		"--collectors", "CPUCollector,PingCollector other",
+	}, d.serverArgs())
+
+	d.Configure(map[string]interface{}{"serverCommand": []interface{}{"/usr/bin/python2.7", "/opt/diamond/server.py", "-l", "DEBUG"}})
+	assert.Equal(t, []string{"/usr/bin/python2.7", "/opt/diamond/server.py", "-l", "DEBUG"}, d.serverArgs()[:4])
+}
+
+func TestDiamondServerStats(t *testing.T) {
+	d := newDiamond(nil, 12, nil).(*Diamond)
+	d.SetServerConfig("/etc/fullerite.conf", "src/diamond/collectors", []string{"CPUCollector", "PingCollector"})
+
+	seen := metric.New("cpu.idle")
+	seen.AddDimension("collectorCanonicalName", "CPUCollector")
+	d.markReceived([]metric.Metric{seen})
+
+	stats := d.serverStats(time.Now().Add(-time.Minute))
+	require.Equal(t, 2, len(stats), "no restarts or uptime without supervision")
+	for _, m := range stats {
+		assert.Equal(t, "fullerite.diamond_server.seconds_since_last_line", m.Name)
+		name, _ := m.GetDimensionValue("diamondCollector")
+		if name == "CPUCollector" {
+			assert.True(t, m.Value < 1)
+		} else {
+			assert.True(t, m.Value >= 60, "never heard from collectors count from the start")
+		}
+	}
+
+	d.server = &diamondServer{restarts: 3}
+	stats = d.serverStats(time.Now())
+	require.Equal(t, 4, len(stats))
+	assert.Equal(t, "fullerite.diamond_server.restarts", stats[2].Name)
+	assert.Equal(t, 3.0, stats[2].Value)
+	assert.Equal(t, "fullerite.diamond_server.uptime", stats[3].Name)
+	assert.Equal(t, 0.0, stats[3].Value)
+}
+
+func TestDiamondConfigureQueue(t *testing.T) {
+	d := newDiamond(nil, 12, nil).(*Diamond)
+	assert.Equal(t, DefaultDiamondQueueSize, cap(d.incoming))
+	assert.False(t, d.dropOldest, "should block by default")
+
+	d.Configure(map[string]interface{}{
+		"queueSize":          "10",
+		"queueFullBehaviour": "dropOldest",
+		"socketPath":         "/var/run/fullerite.sock",
+	})
+	assert.Equal(t, 10, cap(d.incoming))
+	assert.True(t, d.dropOldest)
+	assert.Equal(t, "/var/run/fullerite.sock", d.socketPath)
+}
+
+func TestDiamondCollectUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diamond")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "fullerite.sock")
+
+	testChannel := make(chan metric.Metric)
+	d := newDiamond(testChannel, 123, test_utils.BuildLogger()).(*Diamond)
+	d.Configure(map[string]interface{}{"port": "0", "socketPath": socketPath})
+	go d.Collect()
+
+	var conn net.Conn
+	for retry := 0; retry < 10; retry++ {
+		if conn, err = net.Dial("unix", socketPath); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Nil(t, err, "should connect")
+	defer conn.Close()
+
+	emitTestMetric(conn)
+	select {
+	case m := <-d.Channel():
+		assert.Equal(t, "test", m.Name)
+	case <-time.After(time.Second):
+		t.Fail()
+	}
+	assert.Equal(t, "0", d.Port(), "no TCP port is opened with a unix socket")
+}
+
+func TestDiamondCollectPortInUse(t *testing.T) {
+	taken, err := net.Listen("tcp4", ":0")
+	require.Nil(t, err)
+	defer taken.Close()
+
+	d := newDiamond(nil, 123, test_utils.BuildLogger()).(*Diamond)
+	d.Configure(map[string]interface{}{"port": strings.Split(taken.Addr().String(), ":")[1]})
+
+	returned := make(chan struct{})
+	go func() {
+		d.collectDiamond()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("should give up when the port is in use")
+	}
+}
+
+func TestDiamondDropOldest(t *testing.T) {
+	d := newDiamond(nil, 12, nil).(*Diamond)
+	d.SetCanonicalName("Diamond")
+	d.Configure(map[string]interface{}{"queueSize": 1, "queueFullBehaviour": "dropOldest"})
+	d.stats.openConnection("tcp 127.0.0.1:4242")
+
+	for _, name := range []string{"first", "second", "third"} {
+		d.enqueue(diamondLine{
+			metrics:    []metric.Metric{metric.New(name)},
+			collector:  "CPUCollector",
+			connection: "tcp 127.0.0.1:4242",
+		})
+	}
+
+	require.Equal(t, 1, len(d.incoming))
+	assert.Equal(t, "third", (<-d.incoming).metrics[0].Name)
+
+	stats := d.InternalMetrics()
+	assert.Equal(t, 2.0, stats["CPUCollector"].Counters["fullerite.diamond_lines_dropped"])
+	assert.Equal(t, 2.0, stats["Diamond connection tcp 127.0.0.1:4242"].Counters["fullerite.diamond_lines_dropped"])
+	assert.Equal(t, 1.0, stats["Diamond"].Gauges["fullerite.diamond_queue_capacity"])
+}
+
+func TestDiamondConnectionAccounting(t *testing.T) {
+	d := newDiamond(nil, 12, defaultLog).(*Diamond)
+	d.SetCanonicalName("Diamond")
+	client, server := net.Pipe()
+
+	read := make(chan struct{})
+	go func() {
+		d.readDiamondMetrics(server)
+		close(read)
+	}()
+
+	fmt.Fprintln(client, `[{"name": "idle", "type": "GAUGE", "value": 1, "dimensions": {"collectorCanonicalName": "CPUCollector"}}]`)
+	fmt.Fprintln(client, `[{"name": "used", "type": "GAUGE", "value": "x", "dimensions": {"collectorCanonicalName": "MemoryCollector"}}]`)
+	fmt.Fprintln(client, `[{"name": "foo", "type": "GAUGE", "value": 1}]`)
+	<-d.incoming
+	<-d.incoming
+
+	stats := d.InternalMetrics()
+	assert.Equal(t, 1.0, stats["CPUCollector"].Counters["fullerite.diamond_lines_received"])
+	assert.Equal(t, 0.0, stats["CPUCollector"].Counters["fullerite.diamond_parse_failures"])
+	assert.Equal(t, 1.0, stats["MemoryCollector"].Counters["fullerite.diamond_lines_received"])
+	assert.Equal(t, 1.0, stats["MemoryCollector"].Counters["fullerite.diamond_parse_failures"])
+	assert.Equal(t, 1.0, stats["Diamond"].Counters["fullerite.diamond_lines_received"], "lines without a collector are the Diamond collector's")
+	assert.Equal(t, 3.0, stats["Diamond connection pipe pipe"].Counters["fullerite.diamond_lines_received"])
+
+	client.Close()
+	<-read
+	stats = d.InternalMetrics()
+	_, open := stats["Diamond connection pipe pipe"]
+	assert.False(t, open, "closed connections are forgotten")
+	assert.Equal(t, 1.0, stats["Diamond closed connections"].Counters["fullerite.diamond_parse_failures"])
+}
@@ -49,6 +49,13 @@ type Regex struct {
 
 func init() {
 	RegisterCollector("DockerStats", newDockerStats)
+	RegisterSchema("DockerStats", config.Schema{
+		{Key: "dockerEndPoint", Type: config.String, Default: endpoint, Description: "Docker daemon endpoint"},
+		{Key: "dockerStatsTimeout", Type: config.Int, Description: "Seconds to wait for the stats of a container, at most the interval"},
+		{Key: "emit_image_name", Type: config.Bool, Default: false, Description: "Adds the image name dimension"},
+		{Key: "generatedDimensions", Type: config.Map, Description: "Dimensions extracted from the container environment by regular expressions"},
+		{Key: "skipContainerRegex", Type: config.String, Description: "Regular expression of the container names to skip"},
+	})
 }
 
 // newDockerStats creates a new DockerStats collector.
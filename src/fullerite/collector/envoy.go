@@ -0,0 +1,489 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+const (
+	envoyDefaultAdminURL = "http://localhost:9901"
+	envoyDefaultTimeout  = 2
+	envoyFormatJSON      = "json"
+	envoyFormatProm      = "prometheus"
+)
+
+// envoyTagRule extracts a dimension out of an Envoy stat name. When the
+// regex has two capture groups the first one is cut out of the stat name
+// and the second one is the dimension value, like Envoy's own tag
+// extractors do. With a single group the name is left untouched.
+type envoyTagRule struct {
+	dimension string
+	regex     *regexp.Regexp
+}
+
+// Defaults follow Envoy's built-in tag extraction rules for the stats
+// we care about: clusters, listeners and http connection managers.
+var envoyDefaultTagRules = map[string]string{
+	"cluster_name":        `^cluster\.((.+?)\.)`,
+	"listener_address":    `^listener\.((\[[_0-9a-fA-F:]+\]_[0-9]+|[_.0-9]+)\.)`,
+	"http_conn_manager":   `^http\.((.*?)\.)`,
+	"response_code_class": `_rq(_([0-9]xx))$`,
+	"response_code":       `_rq(_([0-9]{3}))$`,
+}
+
+// Envoy's JSON output does not say whether a stat is a counter or a gauge.
+// Everything is considered a counter unless it matches one of these.
+var envoyDefaultGaugePatterns = []string{
+	`_active$`,
+	`_buffered$`,
+	`\.membership_(healthy|degraded|excluded|total)$`,
+	`\.max_host_weight$`,
+	`\.(uptime|live|state|concurrency|version)$`,
+	`^server\.(memory_allocated|memory_heap_size|parent_connections|total_connections|days_until_first_cert_expiring)$`,
+}
+
+// Envoy reads the Envoy admin /stats endpoint, either in JSON or in
+// Prometheus format, and reports counters, gauges and histogram percentiles.
+type Envoy struct {
+	baseCollector
+
+	adminURL      string
+	format        string
+	statsFilter   string
+	timeout       int
+	tagRules      []envoyTagRule
+	gaugePatterns []*regexp.Regexp
+}
+
+type envoyJSONStats struct {
+	Stats []struct {
+		Name       string           `json:"name"`
+		Value      *float64         `json:"value"`
+		Histograms *envoyHistograms `json:"histograms"`
+	} `json:"stats"`
+}
+
+type envoyHistograms struct {
+	SupportedQuantiles []float64 `json:"supported_quantiles"`
+	ComputedQuantiles  []struct {
+		Name   string `json:"name"`
+		Values []struct {
+			Cumulative *float64 `json:"cumulative"`
+		} `json:"values"`
+	} `json:"computed_quantiles"`
+}
+
+func init() {
+	RegisterCollector("Envoy", newEnvoy)
+	RegisterSchema("Envoy", config.Schema{
+		{Key: "adminURL", Type: config.String, Default: envoyDefaultAdminURL, Description: "URL of the Envoy admin interface"},
+		{Key: "format", Type: config.String, Default: envoyFormatJSON, Choices: []string{envoyFormatJSON, envoyFormatProm}, Description: "Format the stats are read in"},
+		{Key: "statsFilter", Type: config.String, Description: "Regular expression Envoy filters the stats with"},
+		{Key: "timeout", Type: config.Int, Default: envoyDefaultTimeout, Description: "Seconds to wait for the stats"},
+		{Key: "tagRules", Type: config.StringMap, Description: "Dimension names and the regular expressions extracting them from the stat names"},
+		{Key: "gaugePatterns", Type: config.StringList, Description: "Regular expressions of the stats that are gauges"},
+	})
+}
+
+func newEnvoy(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	e := new(Envoy)
+
+	e.log = log
+	e.channel = channel
+	e.interval = initialInterval
+	e.name = "Envoy"
+
+	e.adminURL = envoyDefaultAdminURL
+	e.format = envoyFormatJSON
+	e.timeout = envoyDefaultTimeout
+	e.tagRules = compileEnvoyTagRules(envoyDefaultTagRules, log)
+	e.gaugePatterns = compileEnvoyPatterns(envoyDefaultGaugePatterns, log)
+
+	return e
+}
+
+// Configure the collector
+func (e *Envoy) Configure(configMap map[string]interface{}) {
+	e.configureCommonParams(configMap)
+
+	if val, exists := configMap["adminURL"]; exists {
+		e.adminURL = strings.TrimRight(val.(string), "/")
+	}
+	if val, exists := configMap["format"]; exists {
+		switch format := val.(string); format {
+		case envoyFormatJSON, envoyFormatProm:
+			e.format = format
+		default:
+			e.log.Warn("Unknown stats format ", format, ", falling back to ", e.format)
+		}
+	}
+	if val, exists := configMap["statsFilter"]; exists {
+		e.statsFilter = val.(string)
+	}
+	if val, exists := configMap["timeout"]; exists {
+		e.timeout = config.GetAsInt(val, envoyDefaultTimeout)
+	}
+	if val, exists := configMap["tagRules"]; exists {
+		e.tagRules = compileEnvoyTagRules(config.GetAsMap(val), e.log)
+	}
+	if val, exists := configMap["gaugePatterns"]; exists {
+		e.gaugePatterns = compileEnvoyPatterns(config.GetAsSlice(val), e.log)
+	}
+}
+
+// Collect queries the admin endpoint and emits the parsed metrics
+func (e *Envoy) Collect() {
+	contents, err := e.queryStats()
+	if err != nil {
+		e.log.Error("Could not load stats from envoy: ", err)
+		return
+	}
+
+	var metrics []metric.Metric
+	if e.format == envoyFormatProm {
+		metrics, err = e.parsePrometheus(contents)
+	} else {
+		metrics, err = e.parseJSON(contents)
+	}
+	if err != nil {
+		e.log.Error("Could not parse envoy stats: ", err)
+		return
+	}
+
+	for _, m := range metrics {
+		e.Channel() <- m
+	}
+}
+
+func (e *Envoy) statsURL() string {
+	params := url.Values{}
+	if e.format == envoyFormatProm {
+		params.Set("format", "prometheus")
+	} else {
+		params.Set("format", "json")
+	}
+	if e.statsFilter != "" {
+		params.Set("filter", e.statsFilter)
+	}
+	return e.adminURL + "/stats?" + params.Encode()
+}
+
+func (e *Envoy) queryStats() ([]byte, error) {
+	client := http.Client{Timeout: time.Duration(e.timeout) * time.Second}
+	statsURL := e.statsURL()
+
+	rsp, err := client.Get(statsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, rsp.Body)
+		rsp.Body.Close()
+	}()
+
+	if rsp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s returned %d error code", statsURL, rsp.StatusCode)
+	}
+	return ioutil.ReadAll(rsp.Body)
+}
+
+func (e *Envoy) parseJSON(contents []byte) ([]metric.Metric, error) {
+	var stats envoyJSONStats
+	if err := json.Unmarshal(contents, &stats); err != nil {
+		return nil, err
+	}
+
+	metrics := []metric.Metric{}
+	for _, stat := range stats.Stats {
+		if stat.Histograms != nil {
+			metrics = append(metrics, e.histogramMetrics(stat.Histograms)...)
+			continue
+		}
+		if stat.Value == nil {
+			continue
+		}
+
+		m := e.buildMetric(stat.Name, *stat.Value)
+		if e.isGauge(stat.Name) {
+			m.MetricType = metric.Gauge
+		} else {
+			m.MetricType = metric.CumulativeCounter
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+func (e *Envoy) histogramMetrics(histograms *envoyHistograms) []metric.Metric {
+	metrics := []metric.Metric{}
+	for _, computed := range histograms.ComputedQuantiles {
+		for i, value := range computed.Values {
+			if i >= len(histograms.SupportedQuantiles) || value.Cumulative == nil {
+				continue
+			}
+			m := e.buildMetric(computed.Name, *value.Cumulative)
+			m.AddDimension("rollup", envoyRollupName(histograms.SupportedQuantiles[i]))
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// buildMetric applies the tag rules to a stat name and returns a gauge
+// with the remaining name and the extracted dimensions.
+func (e *Envoy) buildMetric(statName string, value float64) metric.Metric {
+	name := statName
+	dims := map[string]string{}
+	for _, rule := range e.tagRules {
+		match := rule.regex.FindStringSubmatchIndex(name)
+		if match == nil || len(match) < 4 || match[2] < 0 {
+			continue
+		}
+		if len(match) >= 6 && match[4] >= 0 {
+			dims[rule.dimension] = name[match[4]:match[5]]
+			name = name[:match[2]] + name[match[3]:]
+		} else {
+			dims[rule.dimension] = name[match[2]:match[3]]
+		}
+	}
+
+	m := metric.WithValue("envoy."+name, value)
+	m.AddDimensions(dims)
+	return m
+}
+
+func (e *Envoy) isGauge(statName string) bool {
+	for _, re := range e.gaugePatterns {
+		if re.MatchString(statName) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrometheus reads the text exposition format. Envoy already does tag
+// extraction for it, so labels simply become dimensions.
+func (e *Envoy) parsePrometheus(contents []byte) ([]metric.Metric, error) {
+	types := map[string]string{}
+	buckets := map[string]*envoyPromHistogram{}
+	histogramOrder := []string{}
+	metrics := []metric.Metric{}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(contents)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		name, labels, value, err := parsePrometheusLine(line)
+		if err != nil {
+			e.log.Debug("Skipping prometheus line ", line, ": ", err)
+			continue
+		}
+
+		if base := strings.TrimSuffix(name, "_bucket"); base != name && types[base] == "histogram" {
+			le, err := strconv.ParseFloat(labels["le"], 64)
+			if err != nil {
+				continue
+			}
+			delete(labels, "le")
+			key := base + envoyLabelKey(labels)
+			h, exists := buckets[key]
+			if !exists {
+				h = &envoyPromHistogram{name: base, labels: labels}
+				buckets[key] = h
+				histogramOrder = append(histogramOrder, key)
+			}
+			h.buckets = append(h.buckets, envoyPromBucket{le, value})
+			continue
+		}
+		if types[strings.TrimSuffix(name, "_sum")] == "histogram" ||
+			types[strings.TrimSuffix(name, "_count")] == "histogram" {
+			continue
+		}
+
+		m := metric.WithValue(envoyPromName(name), value)
+		m.AddDimensions(envoyPromDimensions(labels))
+		if types[name] == "counter" {
+			m.MetricType = metric.CumulativeCounter
+		}
+		metrics = append(metrics, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range histogramOrder {
+		metrics = append(metrics, buckets[key].metrics()...)
+	}
+	return metrics, nil
+}
+
+type envoyPromBucket struct {
+	upperBound float64
+	count      float64
+}
+
+type envoyPromHistogram struct {
+	name    string
+	labels  map[string]string
+	buckets []envoyPromBucket
+}
+
+// envoyPromQuantiles are the same quantiles Envoy computes for its JSON output
+var envoyPromQuantiles = []float64{0, 25, 50, 75, 90, 95, 99, 99.5, 99.9, 100}
+
+func (h *envoyPromHistogram) metrics() []metric.Metric {
+	sort.Slice(h.buckets, func(i, j int) bool {
+		return h.buckets[i].upperBound < h.buckets[j].upperBound
+	})
+	if len(h.buckets) == 0 || h.buckets[len(h.buckets)-1].count == 0 {
+		return nil
+	}
+
+	metrics := []metric.Metric{}
+	for _, q := range envoyPromQuantiles {
+		m := metric.WithValue(envoyPromName(h.name), h.quantile(q/100))
+		m.AddDimensions(envoyPromDimensions(h.labels))
+		m.AddDimension("rollup", envoyRollupName(q))
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// quantile estimates a quantile by interpolating linearly inside the
+// bucket it falls in, the same way Prometheus' histogram_quantile does.
+func (h *envoyPromHistogram) quantile(q float64) float64 {
+	total := h.buckets[len(h.buckets)-1].count
+	rank := q * total
+
+	lowerBound, lowerCount := 0.0, 0.0
+	for _, b := range h.buckets {
+		if b.count >= rank && b.count > 0 {
+			if math.IsInf(b.upperBound, 1) {
+				return lowerBound
+			}
+			if b.count == lowerCount {
+				return b.upperBound
+			}
+			return lowerBound + (b.upperBound-lowerBound)*(rank-lowerCount)/(b.count-lowerCount)
+		}
+		lowerBound, lowerCount = b.upperBound, b.count
+	}
+	return lowerBound
+}
+
+var envoyPromLineRE = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(.*)\})?\s+(\S+)`)
+var envoyPromLabelRE = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\]|\\.)*)"`)
+
+func parsePrometheusLine(line string) (string, map[string]string, float64, error) {
+	match := envoyPromLineRE.FindStringSubmatch(line)
+	if match == nil {
+		return "", nil, 0, fmt.Errorf("malformed line")
+	}
+	value, err := strconv.ParseFloat(match[4], 64)
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	labels := map[string]string{}
+	for _, label := range envoyPromLabelRE.FindAllStringSubmatch(match[3], -1) {
+		labels[label[1]] = strings.Replace(label[2], `\"`, `"`, -1)
+	}
+	return match[1], labels, value, nil
+}
+
+func envoyPromName(name string) string {
+	return "envoy." + strings.TrimPrefix(name, "envoy_")
+}
+
+func envoyPromDimensions(labels map[string]string) map[string]string {
+	dims := map[string]string{}
+	for k, v := range labels {
+		dims[strings.TrimPrefix(k, "envoy_")] = v
+	}
+	return dims
+}
+
+func envoyLabelKey(labels map[string]string) string {
+	keys := []string{}
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	key := ""
+	for _, k := range keys {
+		key += "|" + k + "=" + labels[k]
+	}
+	return key
+}
+
+// envoyRollupName turns a quantile (0-100) into a rollup dimension value
+// using the same naming as the dropwizard parsers: p50, p99, p999...
+func envoyRollupName(quantile float64) string {
+	switch quantile {
+	case 0:
+		return "min"
+	case 100:
+		return "max"
+	}
+	return "p" + strings.Replace(strconv.FormatFloat(quantile, 'f', -1, 64), ".", "", -1)
+}
+
+func compileEnvoyTagRules(rules map[string]string, log *l.Entry) []envoyTagRule {
+	names := []string{}
+	for name := range rules {
+		names = append(names, name)
+	}
+	// apply rules in a stable order so that the generated names are too
+	sort.Strings(names)
+
+	compiled := []envoyTagRule{}
+	for _, name := range names {
+		re, err := regexp.Compile(rules[name])
+		if err != nil {
+			log.Error("Invalid tag rule regex for ", name, ": ", err)
+			continue
+		}
+		compiled = append(compiled, envoyTagRule{name, re})
+	}
+	return compiled
+}
+
+func compileEnvoyPatterns(patterns []string, log *l.Entry) []*regexp.Regexp {
+	compiled := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Error("Invalid gauge pattern ", pattern, ": ", err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
@@ -0,0 +1,244 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fullerite/metric"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const envoyTestJSON = `{
+  "stats": [
+    {"name": "cluster.service_main.upstream_rq_2xx", "value": 120},
+    {"name": "cluster.service_main.upstream_cx_active", "value": 4},
+    {"name": "cluster.service_main.membership_healthy", "value": 3},
+    {"name": "listener.0.0.0.0_15001.downstream_cx_total", "value": 42},
+    {"name": "http.ingress_http.downstream_rq_503", "value": 2},
+    {"name": "server.uptime", "value": 3600},
+    {"histograms": {
+      "supported_quantiles": [0, 50, 99.9, 100],
+      "computed_quantiles": [
+        {"name": "cluster.service_main.upstream_rq_time",
+         "values": [
+           {"interval": null, "cumulative": 1},
+           {"interval": null, "cumulative": 5},
+           {"interval": null, "cumulative": 40},
+           {"interval": null, "cumulative": null}
+         ]}
+      ]
+    }}
+  ]
+}`
+
+const envoyTestProm = `# TYPE envoy_cluster_upstream_rq counter
+envoy_cluster_upstream_rq{envoy_response_code_class="2",envoy_cluster_name="service_main"} 120
+# TYPE envoy_cluster_upstream_cx_active gauge
+envoy_cluster_upstream_cx_active{envoy_cluster_name="service_main"} 4
+# TYPE envoy_cluster_upstream_rq_time histogram
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="service_main",le="10"} 50
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="service_main",le="100"} 100
+envoy_cluster_upstream_rq_time_bucket{envoy_cluster_name="service_main",le="+Inf"} 100
+envoy_cluster_upstream_rq_time_sum{envoy_cluster_name="service_main"} 2500
+envoy_cluster_upstream_rq_time_count{envoy_cluster_name="service_main"} 100
+`
+
+func newTestEnvoy() *Envoy {
+	log := defaultLog.WithFields(l.Fields{"collector": "Envoy"})
+	return newEnvoy(make(chan metric.Metric), 10, log).(*Envoy)
+}
+
+func findEnvoyMetric(metrics []metric.Metric, name string, dims map[string]string) (metric.Metric, bool) {
+	for _, m := range metrics {
+		if m.Name != name {
+			continue
+		}
+		matches := true
+		for k, v := range dims {
+			if m.Dimensions[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			return m, true
+		}
+	}
+	return metric.Metric{}, false
+}
+
+func TestEnvoyNewEnvoy(t *testing.T) {
+	e := newTestEnvoy()
+
+	assert.Equal(t, "Envoy", e.Name())
+	assert.Equal(t, envoyDefaultAdminURL, e.adminURL)
+	assert.Equal(t, envoyFormatJSON, e.format)
+	assert.Equal(t, len(envoyDefaultTagRules), len(e.tagRules))
+	assert.Equal(t, "http://localhost:9901/stats?format=json", e.statsURL())
+}
+
+func TestEnvoyConfigure(t *testing.T) {
+	e := newTestEnvoy()
+	e.Configure(map[string]interface{}{
+		"adminURL":      "http://127.0.0.1:15000/",
+		"format":        "prometheus",
+		"statsFilter":   "^cluster",
+		"timeout":       5,
+		"tagRules":      map[string]interface{}{"cluster_name": `^cluster\.((.+?)\.)`},
+		"gaugePatterns": []interface{}{`_active$`},
+	})
+
+	assert.Equal(t, "http://127.0.0.1:15000", e.adminURL)
+	assert.Equal(t, envoyFormatProm, e.format)
+	assert.Equal(t, 5, e.timeout)
+	assert.Equal(t, 1, len(e.tagRules))
+	assert.Equal(t, 1, len(e.gaugePatterns))
+	assert.Equal(t, "http://127.0.0.1:15000/stats?filter=%5Ecluster&format=prometheus", e.statsURL())
+}
+
+func TestEnvoyConfigureUnknownFormat(t *testing.T) {
+	e := newTestEnvoy()
+	e.Configure(map[string]interface{}{"format": "xml"})
+
+	assert.Equal(t, envoyFormatJSON, e.format)
+}
+
+func TestEnvoyParseJSON(t *testing.T) {
+	e := newTestEnvoy()
+	metrics, err := e.parseJSON([]byte(envoyTestJSON))
+	assert.Nil(t, err)
+
+	m, ok := findEnvoyMetric(metrics, "envoy.cluster.upstream_rq", map[string]string{
+		"cluster_name":        "service_main",
+		"response_code_class": "2xx",
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 120.0, m.Value)
+	assert.Equal(t, metric.CumulativeCounter, m.MetricType)
+
+	m, ok = findEnvoyMetric(metrics, "envoy.cluster.upstream_cx_active", map[string]string{"cluster_name": "service_main"})
+	assert.True(t, ok)
+	assert.Equal(t, metric.Gauge, m.MetricType)
+
+	m, ok = findEnvoyMetric(metrics, "envoy.cluster.membership_healthy", nil)
+	assert.True(t, ok)
+	assert.Equal(t, metric.Gauge, m.MetricType)
+
+	m, ok = findEnvoyMetric(metrics, "envoy.listener.downstream_cx_total", map[string]string{"listener_address": "0.0.0.0_15001"})
+	assert.True(t, ok)
+	assert.Equal(t, 42.0, m.Value)
+
+	m, ok = findEnvoyMetric(metrics, "envoy.http.downstream_rq", map[string]string{
+		"http_conn_manager": "ingress_http",
+		"response_code":     "503",
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, m.Value)
+
+	m, ok = findEnvoyMetric(metrics, "envoy.server.uptime", nil)
+	assert.True(t, ok)
+	assert.Equal(t, metric.Gauge, m.MetricType)
+}
+
+func TestEnvoyParseJSONHistograms(t *testing.T) {
+	e := newTestEnvoy()
+	metrics, err := e.parseJSON([]byte(envoyTestJSON))
+	assert.Nil(t, err)
+
+	expected := map[string]float64{"min": 1, "p50": 5, "p999": 40}
+	for rollup, value := range expected {
+		m, ok := findEnvoyMetric(metrics, "envoy.cluster.upstream_rq_time", map[string]string{
+			"cluster_name": "service_main",
+			"rollup":       rollup,
+		})
+		assert.True(t, ok, "missing rollup "+rollup)
+		assert.Equal(t, value, m.Value)
+		assert.Equal(t, metric.Gauge, m.MetricType)
+	}
+
+	// null values are skipped
+	_, ok := findEnvoyMetric(metrics, "envoy.cluster.upstream_rq_time", map[string]string{"rollup": "max"})
+	assert.False(t, ok)
+}
+
+func TestEnvoyParseJSONInvalid(t *testing.T) {
+	e := newTestEnvoy()
+	_, err := e.parseJSON([]byte("not json"))
+	assert.NotNil(t, err)
+}
+
+func TestEnvoyParsePrometheus(t *testing.T) {
+	e := newTestEnvoy()
+	metrics, err := e.parsePrometheus([]byte(envoyTestProm))
+	assert.Nil(t, err)
+
+	m, ok := findEnvoyMetric(metrics, "envoy.cluster_upstream_rq", map[string]string{
+		"cluster_name":        "service_main",
+		"response_code_class": "2",
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 120.0, m.Value)
+	assert.Equal(t, metric.CumulativeCounter, m.MetricType)
+
+	m, ok = findEnvoyMetric(metrics, "envoy.cluster_upstream_cx_active", nil)
+	assert.True(t, ok)
+	assert.Equal(t, metric.Gauge, m.MetricType)
+
+	m, ok = findEnvoyMetric(metrics, "envoy.cluster_upstream_rq_time", map[string]string{"rollup": "p50"})
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, m.Value)
+	assert.Equal(t, "service_main", m.Dimensions["cluster_name"])
+
+	m, ok = findEnvoyMetric(metrics, "envoy.cluster_upstream_rq_time", map[string]string{"rollup": "p75"})
+	assert.True(t, ok)
+	assert.Equal(t, 55.0, m.Value)
+
+	_, ok = findEnvoyMetric(metrics, "envoy.cluster_upstream_rq_time_sum", nil)
+	assert.False(t, ok)
+	_, ok = findEnvoyMetric(metrics, "envoy.cluster_upstream_rq_time_bucket", nil)
+	assert.False(t, ok)
+}
+
+func TestEnvoyRollupName(t *testing.T) {
+	assert.Equal(t, "min", envoyRollupName(0))
+	assert.Equal(t, "p50", envoyRollupName(50))
+	assert.Equal(t, "p995", envoyRollupName(99.5))
+	assert.Equal(t, "p999", envoyRollupName(99.9))
+	assert.Equal(t, "max", envoyRollupName(100))
+}
+
+func TestEnvoyCollect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/stats", r.URL.Path)
+		assert.Equal(t, "json", r.URL.Query().Get("format"))
+		fmt.Fprint(w, envoyTestJSON)
+	}))
+	defer ts.Close()
+
+	e := newTestEnvoy()
+	e.Configure(map[string]interface{}{"adminURL": ts.URL})
+
+	expected, _ := e.parseJSON([]byte(envoyTestJSON))
+	go e.Collect()
+
+	for range expected {
+		m := <-e.Channel()
+		assert.Contains(t, m.Name, "envoy.")
+	}
+}
+
+func TestEnvoyCollectErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	e := newTestEnvoy()
+	e.Configure(map[string]interface{}{"adminURL": ts.URL})
+
+	_, err := e.queryStats()
+	assert.NotNil(t, err)
+}
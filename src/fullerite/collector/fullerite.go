@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"fullerite/config"
 	"fullerite/metric"
 
 	"runtime"
@@ -18,6 +19,7 @@ type Fullerite struct {
 
 func init() {
 	RegisterCollector("Fullerite", newFullerite)
+	RegisterSchema("Fullerite", config.Schema{})
 }
 
 // newFullerite creates a new Test collector.
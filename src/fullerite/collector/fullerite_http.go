@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"fullerite/config"
 	"fullerite/internalserver"
 	"fullerite/metric"
 
@@ -26,6 +27,9 @@ type fulleriteHTTP struct {
 
 func init() {
 	RegisterCollector("FulleriteHTTP", newFulleriteHTTP)
+	RegisterSchema("FulleriteHTTP", config.Schema{
+		{Key: "endpoint", Type: config.String, Default: "http://localhost:9090/metrics", Description: "URL of the fullerite internal server"},
+	})
 }
 
 // newFulleriteHTTPCollector returns a collector meant to query fullerite's HTTP interface
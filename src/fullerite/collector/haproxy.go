@@ -0,0 +1,331 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+const (
+	haproxyDefaultTimeout = 2
+	haproxyShowStat       = "show stat\n"
+)
+
+// haproxyCounters maps the "show stat" CSV columns we are interested in
+// to the metric name and type they are reported as.
+var haproxyCounters = []struct {
+	column     string
+	name       string
+	metricType string
+}{
+	{"qcur", "haproxy.queue.current", metric.Gauge},
+	{"scur", "haproxy.sessions.current", metric.Gauge},
+	{"stot", "haproxy.sessions.total", metric.CumulativeCounter},
+	{"bin", "haproxy.bytes.in", metric.CumulativeCounter},
+	{"bout", "haproxy.bytes.out", metric.CumulativeCounter},
+	{"ereq", "haproxy.errors.request", metric.CumulativeCounter},
+	{"econ", "haproxy.errors.connection", metric.CumulativeCounter},
+	{"eresp", "haproxy.errors.response", metric.CumulativeCounter},
+	{"wretr", "haproxy.retries", metric.CumulativeCounter},
+	{"wredis", "haproxy.redispatches", metric.CumulativeCounter},
+}
+
+// haproxyResponseClasses are the hrsp_* columns, reported as a single
+// metric with a response_class dimension.
+var haproxyResponseClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx", "other"}
+
+// HAProxy reads "show stat" output either from the HAProxy admin unix
+// socket or from the CSV flavour of the HTTP stats page and reports
+// per frontend, backend and server statistics.
+type HAProxy struct {
+	baseCollector
+
+	statsSocket   string
+	statsURL      string
+	statsUser     string
+	statsPassword *config.Secret
+	timeout       int
+	backendFilter *regexp.Regexp
+}
+
+func init() {
+	RegisterCollector("HAProxy", newHAProxy)
+	RegisterSchema("HAProxy", config.Schema{
+		{Key: "statsSocket", Type: config.String, Description: "HAProxy stats socket"},
+		{Key: "statsURL", Type: config.String, Description: "URL of the HAProxy CSV stats, when there is no socket"},
+		{Key: "statsUser", Type: config.String, Description: "User of the stats page"},
+		{Key: "statsPassword", Type: config.String, Secret: true, Description: "Password of the stats page, or a reference to it such as file:/path"},
+		{Key: "timeout", Type: config.Int, Default: haproxyDefaultTimeout, Description: "Seconds to wait for the stats"},
+		{Key: "backendFilter", Type: config.String, Description: "Regular expression of the backends to report"},
+	})
+}
+
+func newHAProxy(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	h := new(HAProxy)
+
+	h.log = log
+	h.channel = channel
+	h.interval = initialInterval
+	h.name = "HAProxy"
+	h.timeout = haproxyDefaultTimeout
+
+	return h
+}
+
+// Configure the collector. Either statsSocket or statsURL needs to be set,
+// when both are present the socket wins.
+func (h *HAProxy) Configure(configMap map[string]interface{}) {
+	h.configureCommonParams(configMap)
+
+	if val, exists := configMap["statsSocket"]; exists {
+		h.statsSocket = val.(string)
+	}
+	if val, exists := configMap["statsURL"]; exists {
+		h.statsURL = val.(string)
+	}
+	if val, exists := configMap["statsUser"]; exists {
+		h.statsUser = val.(string)
+	}
+	if val, exists := configMap["statsPassword"]; exists {
+		h.statsPassword = config.GetAsSecret(val, config.DefaultSecretTTL)
+	}
+	if val, exists := configMap["timeout"]; exists {
+		h.timeout = config.GetAsInt(val, haproxyDefaultTimeout)
+	}
+	if val, exists := configMap["backendFilter"]; exists {
+		re, err := regexp.Compile(val.(string))
+		if err != nil {
+			h.log.Error("Invalid backendFilter regex ", val, ": ", err)
+		} else {
+			h.backendFilter = re
+		}
+	}
+
+	if h.statsSocket == "" && h.statsURL == "" {
+		h.log.Warn("Neither statsSocket nor statsURL is configured, no metrics will be collected")
+	}
+}
+
+// Collect fetches the stats CSV and emits the metrics parsed out of it
+func (h *HAProxy) Collect() {
+	contents, err := h.fetchStats()
+	if err != nil {
+		h.log.Error("Could not load stats from haproxy: ", err)
+		return
+	}
+
+	metrics, err := h.parseStats(contents)
+	if err != nil {
+		h.log.Error("Could not parse haproxy stats: ", err)
+		return
+	}
+
+	for _, m := range metrics {
+		h.Channel() <- m
+	}
+}
+
+func (h *HAProxy) fetchStats() (string, error) {
+	timeout := time.Duration(h.timeout) * time.Second
+	if h.statsSocket != "" {
+		return queryHAProxySocket(h.statsSocket, timeout)
+	}
+	if h.statsURL != "" {
+		password, err := h.statsPassword.Value()
+		if err != nil {
+			return "", err
+		}
+		return queryHAProxyURL(h.statsURL, h.statsUser, password, timeout)
+	}
+	return "", fmt.Errorf("no stats source configured")
+}
+
+func queryHAProxySocket(path string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := io.WriteString(conn, haproxyShowStat); err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func queryHAProxyURL(statsURL, user, password string, timeout time.Duration) (string, error) {
+	client := http.Client{Timeout: timeout}
+
+	req, err := http.NewRequest("GET", statsURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, rsp.Body)
+		rsp.Body.Close()
+	}()
+
+	if rsp.StatusCode != 200 {
+		return "", fmt.Errorf("%s returned %d error code", statsURL, rsp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// parseStats turns the "show stat" CSV into metrics. The first line is
+// the header, prefixed with "# ".
+func (h *HAProxy) parseStats(contents string) ([]metric.Metric, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(contents, "# ")))
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty stats output")
+	}
+
+	header := map[string]int{}
+	for i, column := range records[0] {
+		header[column] = i
+	}
+	for _, required := range []string{"pxname", "svname"} {
+		if _, exists := header[required]; !exists {
+			return nil, fmt.Errorf("stats header is missing the %s column", required)
+		}
+	}
+
+	metrics := []metric.Metric{}
+	for _, row := range records[1:] {
+		get := func(column string) (string, bool) {
+			if i, exists := header[column]; exists && i < len(row) {
+				return row[i], row[i] != ""
+			}
+			return "", false
+		}
+
+		proxy, _ := get("pxname")
+		server, _ := get("svname")
+		proxyType := haproxyRowType(server, get)
+
+		if proxyType != "frontend" && h.backendFilter != nil && !h.backendFilter.MatchString(proxy) {
+			continue
+		}
+
+		dims := map[string]string{
+			"proxy":      proxy,
+			"proxy_type": proxyType,
+		}
+		if proxyType == "server" {
+			dims["server"] = server
+		}
+
+		for _, counter := range haproxyCounters {
+			if value, ok := get(counter.column); ok {
+				if m, ok := buildHAProxyMetric(counter.name, counter.metricType, value, dims); ok {
+					metrics = append(metrics, m)
+				}
+			}
+		}
+
+		for _, class := range haproxyResponseClasses {
+			if value, ok := get("hrsp_" + class); ok {
+				if m, ok := buildHAProxyMetric("haproxy.responses", metric.CumulativeCounter, value, dims); ok {
+					m.AddDimension("response_class", class)
+					metrics = append(metrics, m)
+				}
+			}
+		}
+
+		if status, ok := get("status"); ok {
+			if up, known := haproxyStatusValue(status); known {
+				m := metric.WithValue("haproxy.up", up)
+				m.AddDimensions(dims)
+				metrics = append(metrics, m)
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+// haproxyRowType figures out whether a row describes a frontend, a backend
+// or a server. The "type" column is used when available, older versions
+// of haproxy only let us look at the svname.
+func haproxyRowType(server string, get func(string) (string, bool)) string {
+	if t, ok := get("type"); ok {
+		switch t {
+		case "0":
+			return "frontend"
+		case "1":
+			return "backend"
+		case "2":
+			return "server"
+		case "3":
+			return "listener"
+		}
+	}
+
+	switch server {
+	case "FRONTEND":
+		return "frontend"
+	case "BACKEND":
+		return "backend"
+	}
+	return "server"
+}
+
+// haproxyStatusValue converts the status column into 1 (healthy) or 0.
+// Statuses without health information (e.g. "no check") are skipped.
+func haproxyStatusValue(status string) (float64, bool) {
+	switch {
+	case status == "OPEN" || strings.HasPrefix(status, "UP"):
+		return 1, true
+	case strings.HasPrefix(status, "DOWN") || status == "NOLB" || status == "DRAIN" || strings.HasPrefix(status, "MAINT"):
+		return 0, true
+	}
+	return 0, false
+}
+
+func buildHAProxyMetric(name, metricType, value string, dims map[string]string) (metric.Metric, bool) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return metric.Metric{}, false
+	}
+	m := metric.New(name)
+	m.MetricType = metricType
+	m.Value = v
+	m.AddDimensions(dims)
+	return m, true
+}
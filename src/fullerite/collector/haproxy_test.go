@@ -0,0 +1,238 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"fullerite/config"
+	"fullerite/metric"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const haproxyTestCSV = `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,
+main,FRONTEND,,,3,10,2000,120,1000,2000,0,0,1,,,,,OPEN,,,,,,,,,1,1,0,,,,0,1,0,5,,,,0,100,2,3,4,0,,1,5,110,,,
+service.main,host1:31000,0,0,1,4,,50,400,800,,0,,0,0,1,0,UP,1,1,0,0,0,100,0,,1,2,1,,50,,2,0,,3,L7OK,200,1,0,45,1,2,2,0,0,,,,0,0,
+service.main,host2:31001,2,3,0,4,,40,300,600,,0,,1,0,0,1,DOWN,1,1,0,3,1,10,20,,1,2,2,,40,,2,0,,3,L4CON,,0,0,35,1,2,2,0,0,,,,0,0,
+service.main,BACKEND,2,3,1,8,200,90,700,1400,0,0,,1,0,1,1,UP,2,2,0,,1,100,0,,1,2,0,,90,,1,0,,6,,,,0,80,2,4,4,0,,,,,0,0,
+other.main,host3:31002,0,0,0,0,,0,0,0,,0,,0,0,0,0,no check,1,1,0,,,,,,1,3,1,,0,,2,0,,0,,,,0,0,0,0,0,0,0,,,,0,0,
+`
+
+func newTestHAProxy() *HAProxy {
+	log := defaultLog.WithFields(l.Fields{"collector": "HAProxy"})
+	return newHAProxy(make(chan metric.Metric), 10, log).(*HAProxy)
+}
+
+func findHAProxyMetric(metrics []metric.Metric, name string, dims map[string]string) (metric.Metric, bool) {
+	for _, m := range metrics {
+		if m.Name != name {
+			continue
+		}
+		matches := true
+		for k, v := range dims {
+			if m.Dimensions[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return m, true
+		}
+	}
+	return metric.Metric{}, false
+}
+
+func TestHAProxyNewHAProxy(t *testing.T) {
+	h := newTestHAProxy()
+
+	assert.Equal(t, "HAProxy", h.Name())
+	assert.Equal(t, 10, h.Interval())
+	assert.Equal(t, haproxyDefaultTimeout, h.timeout)
+}
+
+func TestHAProxyConfigure(t *testing.T) {
+	h := newTestHAProxy()
+	h.Configure(map[string]interface{}{
+		"statsSocket":   "/var/run/haproxy.sock",
+		"statsURL":      "http://localhost:3212/;csv",
+		"timeout":       "5",
+		"backendFilter": "^service\\.",
+	})
+
+	assert.Equal(t, "/var/run/haproxy.sock", h.statsSocket)
+	assert.Equal(t, "http://localhost:3212/;csv", h.statsURL)
+	assert.Equal(t, 5, h.timeout)
+	assert.NotNil(t, h.backendFilter)
+	assert.True(t, h.backendFilter.MatchString("service.main"))
+}
+
+func TestHAProxyConfigureInvalidFilter(t *testing.T) {
+	h := newTestHAProxy()
+	h.Configure(map[string]interface{}{"backendFilter": "("})
+
+	assert.Nil(t, h.backendFilter)
+}
+
+func TestHAProxyParseStats(t *testing.T) {
+	h := newTestHAProxy()
+	metrics, err := h.parseStats(haproxyTestCSV)
+	assert.Nil(t, err)
+
+	m, ok := findHAProxyMetric(metrics, "haproxy.sessions.current", map[string]string{"proxy": "main", "proxy_type": "frontend"})
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, m.Value)
+	assert.Equal(t, metric.Gauge, m.MetricType)
+	_, hasServer := m.Dimensions["server"]
+	assert.False(t, hasServer)
+
+	m, ok = findHAProxyMetric(metrics, "haproxy.responses", map[string]string{"proxy": "main", "response_class": "2xx"})
+	assert.True(t, ok)
+	assert.Equal(t, 100.0, m.Value)
+	assert.Equal(t, metric.CumulativeCounter, m.MetricType)
+
+	m, ok = findHAProxyMetric(metrics, "haproxy.queue.current", map[string]string{"server": "host2:31001", "proxy_type": "server"})
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, m.Value)
+
+	m, ok = findHAProxyMetric(metrics, "haproxy.retries", map[string]string{"proxy": "service.main", "proxy_type": "backend"})
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, m.Value)
+
+	m, ok = findHAProxyMetric(metrics, "haproxy.bytes.out", map[string]string{"server": "host1:31000"})
+	assert.True(t, ok)
+	assert.Equal(t, 800.0, m.Value)
+
+	m, ok = findHAProxyMetric(metrics, "haproxy.up", map[string]string{"server": "host1:31000"})
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, m.Value)
+
+	m, ok = findHAProxyMetric(metrics, "haproxy.up", map[string]string{"server": "host2:31001"})
+	assert.True(t, ok)
+	assert.Equal(t, 0.0, m.Value)
+
+	// "no check" carries no health information
+	_, ok = findHAProxyMetric(metrics, "haproxy.up", map[string]string{"server": "host3:31002"})
+	assert.False(t, ok)
+
+	// empty columns are not reported
+	_, ok = findHAProxyMetric(metrics, "haproxy.queue.current", map[string]string{"proxy": "main"})
+	assert.False(t, ok)
+}
+
+func TestHAProxyParseStatsBackendFilter(t *testing.T) {
+	h := newTestHAProxy()
+	h.Configure(map[string]interface{}{"backendFilter": "^service\\."})
+
+	metrics, err := h.parseStats(haproxyTestCSV)
+	assert.Nil(t, err)
+
+	for _, m := range metrics {
+		if m.Dimensions["proxy_type"] != "frontend" {
+			assert.Equal(t, "service.main", m.Dimensions["proxy"])
+		}
+	}
+	_, ok := findHAProxyMetric(metrics, "haproxy.sessions.current", map[string]string{"proxy": "main"})
+	assert.True(t, ok, "frontends should not be filtered")
+}
+
+func TestHAProxyParseStatsInvalid(t *testing.T) {
+	h := newTestHAProxy()
+
+	_, err := h.parseStats("")
+	assert.NotNil(t, err)
+
+	_, err = h.parseStats("foo,bar\n1,2\n")
+	assert.NotNil(t, err)
+}
+
+func TestHAProxyRowTypeWithoutTypeColumn(t *testing.T) {
+	get := func(string) (string, bool) { return "", false }
+
+	assert.Equal(t, "frontend", haproxyRowType("FRONTEND", get))
+	assert.Equal(t, "backend", haproxyRowType("BACKEND", get))
+	assert.Equal(t, "server", haproxyRowType("host1", get))
+}
+
+func TestHAProxyQueryURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, haproxyTestCSV)
+	}))
+	defer ts.Close()
+
+	h := newTestHAProxy()
+	h.Configure(map[string]interface{}{
+		"statsURL":      ts.URL + "/;csv",
+		"statsUser":     "admin",
+		"statsPassword": "secret",
+	})
+
+	contents, err := h.fetchStats()
+	assert.Nil(t, err)
+	assert.Equal(t, haproxyTestCSV, contents)
+
+	h.statsPassword = config.NewSecret("wrong", 0)
+	_, err = h.fetchStats()
+	assert.NotNil(t, err)
+}
+
+func TestHAProxyQuerySocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "haproxy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := path.Join(dir, "haproxy.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, len(haproxyShowStat))
+		conn.Read(buf)
+		received <- string(buf)
+		fmt.Fprint(conn, haproxyTestCSV)
+	}()
+
+	h := newTestHAProxy()
+	h.Configure(map[string]interface{}{"statsSocket": socket})
+
+	contents, err := h.fetchStats()
+	assert.Nil(t, err)
+	assert.Equal(t, haproxyShowStat, <-received)
+	assert.Equal(t, haproxyTestCSV, contents)
+}
+
+func TestHAProxyCollect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, haproxyTestCSV)
+	}))
+	defer ts.Close()
+
+	h := newTestHAProxy()
+	h.Configure(map[string]interface{}{"statsURL": ts.URL})
+
+	expected, _ := h.parseStats(haproxyTestCSV)
+	go h.Collect()
+
+	for range expected {
+		m := <-h.Channel()
+		assert.Contains(t, m.Name, "haproxy.")
+	}
+}
@@ -32,6 +32,10 @@ type ServiceEndpoint struct {
 
 func init() {
 	RegisterCollector("HttpDropwizard", newHTTPDropwizard)
+	RegisterSchema("HttpDropwizard", config.Schema{
+		{Key: "endpoints", Type: config.List, Description: "Endpoints to read, each a map of service_name, port and path"},
+		{Key: "http_timeout", Type: config.Int, Default: 3, Description: "Seconds to wait for an endpoint"},
+	})
 }
 
 func newHTTPDropwizard(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
@@ -0,0 +1,493 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+const (
+	logTailCounter   = "counter"
+	logTailGauge     = "gauge"
+	logTailHistogram = "histogram"
+
+	logTailDefaultValueGroup = "value"
+
+	// logTailDefaultStateDir is where the offsets are saved without a
+	// stateFile, next to the other state of fullerite
+	logTailDefaultStateDir = "/var/lib/fullerite"
+)
+
+// LogTail follows log files and derives metrics from lines matching
+// configured regex rules. The files are globs, expanded on every
+// collection so that files created since are followed too. Read offsets
+// are kept in a state file so a restart picks up where the previous run
+// stopped.
+//
+// Example config:
+//
+//	{
+//	    "files": ["/var/log/app/*.log"],
+//	    "stateFile": "/var/lib/fullerite/logtail.json",
+//	    "rules": [
+//	        {"name": "app.errors", "regex": "ERROR \\[(?P<component>\\w+)\\]"},
+//	        {"name": "app.latency", "type": "histogram", "regex": "took (?P<value>[0-9.]+)ms"}
+//	    ]
+//	}
+type LogTail struct {
+	baseCollector
+
+	files     []string
+	rules     []logTailRule
+	stateFile string
+	tails     map[string]*logTailFile
+	// collected tells whether the files were read once already, the files
+	// found after that are read from their start
+	collected bool
+}
+
+// logTailRule turns matching lines into metrics. Named groups other
+// than valueGroup become dimensions.
+type logTailRule struct {
+	name       string
+	regex      *regexp.Regexp
+	metricType string
+	valueGroup string
+}
+
+// logTailFile keeps track of how far into a file we have read
+type logTailFile struct {
+	path   string
+	file   *os.File
+	inode  uint64
+	offset int64
+}
+
+// logTailState is what gets persisted for each followed file
+type logTailState struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// logTailAggregate accumulates the matches of one rule and dimension set
+// over a collection interval.
+type logTailAggregate struct {
+	rule       *logTailRule
+	dimensions map[string]string
+	count      int
+	values     []float64
+}
+
+func init() {
+	RegisterCollector("LogTail", newLogTail)
+	RegisterSchema("LogTail", config.Schema{
+		{Key: "files", Type: config.StringList, Required: true, Description: "Globs of the log files to follow"},
+		{Key: "rules", Type: config.List, Required: true, Description: "Rules with a name, a regex, a type and a valueGroup"},
+		{Key: "stateFile", Type: config.String, Description: "Where the file offsets are saved, in /var/lib/fullerite by default"},
+	})
+}
+
+func newLogTail(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	lt := new(LogTail)
+
+	lt.log = log
+	lt.channel = channel
+	lt.interval = initialInterval
+	lt.name = "LogTail"
+	lt.tails = make(map[string]*logTailFile)
+
+	return lt
+}
+
+// Configure the collector
+func (lt *LogTail) Configure(configMap map[string]interface{}) {
+	lt.configureCommonParams(configMap)
+
+	if val, exists := configMap["files"]; exists {
+		lt.files = config.GetAsSlice(val)
+	} else {
+		lt.log.Warn("Required config 'files' does not exist")
+	}
+
+	if val, exists := configMap["rules"]; exists {
+		lt.rules = lt.parseRules(val)
+	} else {
+		lt.log.Warn("Required config 'rules' does not exist")
+	}
+
+	if val, exists := configMap["stateFile"]; exists {
+		lt.stateFile = fmt.Sprint(val)
+	} else {
+		name := strings.Replace(lt.CanonicalName(), " ", "_", -1)
+		if name == "" {
+			name = lt.Name()
+		}
+		lt.stateFile = filepath.Join(logTailDefaultStateDir, "logtail_"+name+".offsets")
+	}
+
+	lt.restoreState()
+}
+
+func (lt *LogTail) parseRules(value interface{}) []logTailRule {
+	rawRules, ok := value.([]interface{})
+	if !ok {
+		lt.log.Error("Expected 'rules' to be a list of rules")
+		return nil
+	}
+
+	rules := []logTailRule{}
+	for _, rawRule := range rawRules {
+		ruleConfig := config.GetAsMap(rawRule)
+
+		rule := logTailRule{
+			name:       ruleConfig["name"],
+			metricType: logTailCounter,
+			valueGroup: logTailDefaultValueGroup,
+		}
+		if rule.name == "" {
+			lt.log.Error("Skipping log rule without a name: ", ruleConfig)
+			continue
+		}
+
+		re, err := regexp.Compile(ruleConfig["regex"])
+		if err != nil || ruleConfig["regex"] == "" {
+			lt.log.Error("Skipping log rule ", rule.name, " with invalid regex: ", err)
+			continue
+		}
+		rule.regex = re
+
+		if metricType, exists := ruleConfig["type"]; exists {
+			rule.metricType = metricType
+		}
+		if valueGroup, exists := ruleConfig["valueGroup"]; exists {
+			rule.valueGroup = valueGroup
+		}
+
+		switch rule.metricType {
+		case logTailCounter:
+		case logTailGauge, logTailHistogram:
+			if !containsString(rule.valueGroup, rule.regex.SubexpNames()) {
+				lt.log.Error("Skipping log rule ", rule.name, ": no capture group named ", rule.valueGroup)
+				continue
+			}
+		default:
+			lt.log.Error("Skipping log rule ", rule.name, " with unknown type ", rule.metricType)
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Collect reads what has been appended to the files since the last run
+// and emits the resulting metrics
+func (lt *LogTail) Collect() {
+	for _, m := range lt.collectMetrics() {
+		lt.Channel() <- m
+	}
+}
+
+func (lt *LogTail) collectMetrics() []metric.Metric {
+	aggregates := map[string]*logTailAggregate{}
+	keys := []string{}
+
+	for _, path := range lt.logFiles() {
+		tail, exists := lt.tails[path]
+		if !exists {
+			tail = &logTailFile{path: path, offset: -1}
+			if lt.collected {
+				tail.offset = 0
+			}
+			lt.tails[path] = tail
+		}
+
+		err := tail.readLines(func(line string) {
+			for i := range lt.rules {
+				key, agg := lt.rules[i].apply(line, path)
+				if agg == nil {
+					continue
+				}
+				if existing, exists := aggregates[key]; exists {
+					existing.count += agg.count
+					existing.values = append(existing.values, agg.values...)
+				} else {
+					aggregates[key] = agg
+					keys = append(keys, key)
+				}
+			}
+		})
+		if err != nil {
+			lt.log.Warn("Failed to read ", path, ": ", err)
+		}
+	}
+	lt.collected = true
+	lt.saveState()
+
+	metrics := []metric.Metric{}
+	for _, key := range keys {
+		metrics = append(metrics, aggregates[key].metrics()...)
+	}
+	return metrics
+}
+
+// logFiles returns the files matching the globs, along with the files
+// still open, so that the end of a file removed since is read. A file that
+// isn't a glob is returned even when missing, to be reported.
+func (lt *LogTail) logFiles() []string {
+	paths := []string{}
+	seen := map[string]bool{}
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range lt.files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			lt.log.Warn("Invalid glob ", pattern, ": ", err)
+			continue
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			add(pattern)
+		}
+		for _, path := range matches {
+			add(path)
+		}
+	}
+
+	open := []string{}
+	for path, tail := range lt.tails {
+		if tail.file != nil && !seen[path] {
+			open = append(open, path)
+		}
+	}
+	sort.Strings(open)
+	for _, path := range open {
+		add(path)
+	}
+	return paths
+}
+
+// apply matches a line against the rule and returns the aggregation key
+// and a single-line aggregate, or nil if the line doesn't match.
+func (r *logTailRule) apply(line, path string) (string, *logTailAggregate) {
+	match := r.regex.FindStringSubmatch(line)
+	if match == nil {
+		return "", nil
+	}
+
+	agg := &logTailAggregate{
+		rule:       r,
+		dimensions: map[string]string{"file": path},
+		count:      1,
+	}
+	for i, group := range r.regex.SubexpNames() {
+		if i == 0 || group == "" {
+			continue
+		}
+		if group == r.valueGroup && r.metricType != logTailCounter {
+			value, err := strconv.ParseFloat(match[i], 64)
+			if err != nil {
+				return "", nil
+			}
+			agg.values = append(agg.values, value)
+			continue
+		}
+		agg.dimensions[group] = match[i]
+	}
+
+	dimNames := []string{}
+	for name := range agg.dimensions {
+		dimNames = append(dimNames, name)
+	}
+	sort.Strings(dimNames)
+
+	key := r.name
+	for _, name := range dimNames {
+		key += "|" + name + "=" + agg.dimensions[name]
+	}
+	return key, agg
+}
+
+func (agg *logTailAggregate) metrics() []metric.Metric {
+	build := func(name, metricType string, value float64) metric.Metric {
+		m := metric.New(name)
+		m.MetricType = metricType
+		m.Value = value
+		m.AddDimensions(agg.dimensions)
+		return m
+	}
+
+	switch agg.rule.metricType {
+	case logTailGauge:
+		return []metric.Metric{build(agg.rule.name, metric.Gauge, agg.values[len(agg.values)-1])}
+	case logTailHistogram:
+		values := append([]float64{}, agg.values...)
+		sort.Float64s(values)
+
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		rollups := map[string]float64{
+			"min":  values[0],
+			"max":  values[len(values)-1],
+			"mean": sum / float64(len(values)),
+			"p50":  metric.Percentile(values, 50),
+			"p75":  metric.Percentile(values, 75),
+			"p95":  metric.Percentile(values, 95),
+			"p99":  metric.Percentile(values, 99),
+		}
+		metrics := []metric.Metric{build(agg.rule.name, metric.Counter, float64(len(values)))}
+		metrics[0].AddDimension("rollup", "count")
+		for _, rollup := range []string{"min", "max", "mean", "p50", "p75", "p95", "p99"} {
+			m := build(agg.rule.name, metric.Gauge, rollups[rollup])
+			m.AddDimension("rollup", rollup)
+			metrics = append(metrics, m)
+		}
+		return metrics
+	}
+	return []metric.Metric{build(agg.rule.name, metric.Counter, float64(agg.count))}
+}
+
+// readLines calls lineFunc for every complete line appended since the
+// last call. Rotation is detected through the inode: the rest of the old
+// file is drained before switching over to the new one. A file that got
+// smaller than our offset has been truncated and is read from the start.
+func (t *logTailFile) readLines(lineFunc func(string)) error {
+	info, statErr := os.Stat(t.path)
+
+	if t.file != nil && (statErr != nil || fileInode(info) != t.inode) {
+		// rotated or removed, finish up what was left in the old file
+		if err := t.drain(lineFunc); err != nil {
+			return err
+		}
+		t.file.Close()
+		t.file = nil
+		// whatever shows up at this path next is read from the start
+		t.offset = 0
+	}
+	if statErr != nil {
+		if t.offset < 0 {
+			// missing when first seen, whatever is written to it is new
+			t.offset = 0
+		}
+		return statErr
+	}
+
+	if t.file == nil {
+		f, err := os.Open(t.path)
+		if err != nil {
+			return err
+		}
+		t.file = f
+		t.inode = fileInode(info)
+		if t.offset < 0 {
+			// never seen this file before: only count lines written from now on
+			t.offset = info.Size()
+		}
+	}
+
+	if info.Size() < t.offset {
+		t.offset = 0
+	}
+	return t.drain(lineFunc)
+}
+
+func (t *logTailFile) drain(lineFunc func(string)) error {
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(t.file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// a partial line is left for the next run
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		t.offset += int64(len(line))
+		lineFunc(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+func (lt *LogTail) restoreState() {
+	contents, err := ioutil.ReadFile(lt.stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lt.log.Warn("Failed to read state file ", lt.stateFile, ": ", err)
+		}
+		return
+	}
+
+	state := map[string]logTailState{}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		lt.log.Warn("Ignoring invalid state file ", lt.stateFile, ": ", err)
+		return
+	}
+
+	for path, fileState := range state {
+		tail := &logTailFile{path: path, offset: fileState.Offset}
+		if info, err := os.Stat(path); err != nil || fileInode(info) != fileState.Inode {
+			// rotated while we were down, the current file is all new
+			tail.offset = 0
+		}
+		lt.tails[path] = tail
+	}
+}
+
+func (lt *LogTail) saveState() {
+	state := map[string]logTailState{}
+	for path, tail := range lt.tails {
+		if tail.file != nil {
+			state[path] = logTailState{Inode: tail.inode, Offset: tail.offset}
+		}
+	}
+
+	contents, err := json.Marshal(state)
+	if err != nil {
+		lt.log.Error("Failed to serialize state: ", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(lt.stateFile), 0755); err != nil {
+		lt.log.Error("Failed to create the directory of state file ", lt.stateFile, ": ", err)
+		return
+	}
+	// write and rename so that a crash never leaves a half written file
+	tmpFile := lt.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, contents, 0644); err != nil {
+		lt.log.Error("Failed to write state file ", tmpFile, ": ", err)
+		return
+	}
+	if err := os.Rename(tmpFile, lt.stateFile); err != nil {
+		lt.log.Error("Failed to write state file ", lt.stateFile, ": ", err)
+	}
+}
+
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,264 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"fullerite/metric"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogTail(t *testing.T, dir string, extra map[string]interface{}) (*LogTail, string) {
+	logFile := path.Join(dir, "app.log")
+	configMap := map[string]interface{}{
+		"files":     []interface{}{logFile},
+		"stateFile": path.Join(dir, "state.json"),
+		"rules": []interface{}{
+			map[string]interface{}{
+				"name":  "app.errors",
+				"regex": `ERROR \[(?P<component>\w+)\]`,
+			},
+			map[string]interface{}{
+				"name":  "app.latency",
+				"type":  "histogram",
+				"regex": `took (?P<value>[0-9.]+)ms`,
+			},
+			map[string]interface{}{
+				"name":       "app.queue",
+				"type":       "gauge",
+				"regex":      `queue=(?P<size>\d+)`,
+				"valueGroup": "size",
+			},
+		},
+	}
+	for k, v := range extra {
+		configMap[k] = v
+	}
+
+	log := defaultLog.WithFields(l.Fields{"collector": "LogTail"})
+	lt := newLogTail(make(chan metric.Metric), 10, log).(*LogTail)
+	lt.Configure(configMap)
+	return lt, logFile
+}
+
+func appendToFile(t *testing.T, file string, lines ...string) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	defer f.Close()
+	for _, line := range lines {
+		fmt.Fprint(f, line)
+	}
+}
+
+func sumLogTailMetric(metrics []metric.Metric, name string, dims map[string]string) float64 {
+	total := 0.0
+	for _, m := range metrics {
+		if m.Name != name {
+			continue
+		}
+		matches := true
+		for k, v := range dims {
+			if m.Dimensions[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			total += m.Value
+		}
+	}
+	return total
+}
+
+func TestLogTailConfigure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, nil)
+	assert.Equal(t, []string{logFile}, lt.files)
+	assert.Equal(t, 3, len(lt.rules))
+	assert.Equal(t, logTailCounter, lt.rules[0].metricType)
+	assert.Equal(t, logTailHistogram, lt.rules[1].metricType)
+	assert.Equal(t, "size", lt.rules[2].valueGroup)
+}
+
+func TestLogTailConfigureInvalidRules(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, _ := newTestLogTail(t, dir, map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{"regex": "no name"},
+			map[string]interface{}{"name": "bad.regex", "regex": "("},
+			map[string]interface{}{"name": "bad.type", "regex": "x", "type": "summary"},
+			map[string]interface{}{"name": "no.value", "regex": "x", "type": "gauge"},
+			map[string]interface{}{"name": "good", "regex": "x"},
+		},
+	})
+	assert.Equal(t, 1, len(lt.rules))
+	assert.Equal(t, "good", lt.rules[0].name)
+}
+
+func TestLogTailDefaultStateFile(t *testing.T) {
+	log := defaultLog.WithFields(l.Fields{"collector": "LogTail"})
+	lt := newLogTail(make(chan metric.Metric), 10, log).(*LogTail)
+	lt.SetCanonicalName("LogTail app")
+	lt.Configure(map[string]interface{}{})
+
+	assert.Equal(t, "/var/lib/fullerite/logtail_LogTail_app.offsets", lt.stateFile)
+}
+
+func TestLogTailCollect(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, nil)
+	appendToFile(t, logFile, "ERROR [db] old line written before we started\n")
+
+	// lines already in the file when it is first seen are not counted
+	metrics := lt.collectMetrics()
+	assert.Equal(t, 0, len(metrics))
+
+	appendToFile(t, logFile,
+		"ERROR [db] connection refused\n",
+		"ERROR [db] connection refused\n",
+		"ERROR [cache] miss storm\n",
+		"INFO request took 10ms\n",
+		"INFO request took 30ms\n",
+		"INFO queue=4\n",
+		"INFO queue=7\n",
+		"ERROR [db] partial line",
+	)
+	metrics = lt.collectMetrics()
+
+	assert.Equal(t, 2.0, sumLogTailMetric(metrics, "app.errors", map[string]string{"component": "db", "file": logFile}))
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", map[string]string{"component": "cache"}))
+	assert.Equal(t, 2.0, sumLogTailMetric(metrics, "app.latency", map[string]string{"rollup": "count"}))
+	assert.Equal(t, 20.0, sumLogTailMetric(metrics, "app.latency", map[string]string{"rollup": "mean"}))
+	assert.Equal(t, 30.0, sumLogTailMetric(metrics, "app.latency", map[string]string{"rollup": "max"}))
+	assert.Equal(t, 7.0, sumLogTailMetric(metrics, "app.queue", nil))
+
+	for _, m := range metrics {
+		if m.Name == "app.errors" {
+			assert.Equal(t, metric.Counter, m.MetricType)
+		}
+		if m.Name == "app.queue" {
+			assert.Equal(t, metric.Gauge, m.MetricType)
+			_, hasValueDim := m.Dimensions["size"]
+			assert.False(t, hasValueDim)
+		}
+	}
+
+	// the partial line is picked up once it is complete
+	appendToFile(t, logFile, "\n")
+	metrics = lt.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", map[string]string{"component": "db"}))
+}
+
+func TestLogTailRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, nil)
+	appendToFile(t, logFile, "")
+	lt.collectMetrics()
+
+	appendToFile(t, logFile, "ERROR [db] before rotation\n")
+	assert.Nil(t, os.Rename(logFile, logFile+".1"))
+	appendToFile(t, logFile+".1", "ERROR [db] late write to the old file\n")
+	appendToFile(t, logFile, "ERROR [db] in the new file\n")
+
+	metrics := lt.collectMetrics()
+	assert.Equal(t, 3.0, sumLogTailMetric(metrics, "app.errors", nil))
+
+	appendToFile(t, logFile, "ERROR [db] again\n")
+	metrics = lt.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", nil))
+}
+
+func TestLogTailTruncation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, nil)
+	appendToFile(t, logFile, "some\nlines\nbefore\nwe\nstarted\n")
+	lt.collectMetrics()
+
+	assert.Nil(t, os.Truncate(logFile, 0))
+	appendToFile(t, logFile, "ERROR [db] after truncation\n")
+
+	metrics := lt.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", nil))
+}
+
+func TestLogTailRestart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, nil)
+	appendToFile(t, logFile, "")
+	lt.collectMetrics()
+	appendToFile(t, logFile, "ERROR [db] counted by the first instance\n")
+	metrics := lt.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", nil))
+
+	appendToFile(t, logFile, "ERROR [db] written while fullerite was down\n")
+
+	restarted, _ := newTestLogTail(t, dir, nil)
+	metrics = restarted.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", nil))
+}
+
+func TestLogTailRestartAfterRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, nil)
+	appendToFile(t, logFile, "a line that moves the offset forward\n")
+	lt.collectMetrics()
+
+	assert.Nil(t, os.Rename(logFile, logFile+".1"))
+	appendToFile(t, logFile, "ERROR [db] new file written while fullerite was down\n")
+
+	restarted, _ := newTestLogTail(t, dir, nil)
+	metrics := restarted.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", nil))
+}
+
+func TestLogTailFileCreatedAfterStart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, nil)
+	lt.Collect()
+
+	appendToFile(t, logFile, "ERROR [db] first line of a new file\n")
+	metrics := lt.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", map[string]string{"file": logFile}))
+}
+
+func TestLogTailGlob(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logtail")
+	defer os.RemoveAll(dir)
+
+	lt, logFile := newTestLogTail(t, dir, map[string]interface{}{
+		"files": []interface{}{path.Join(dir, "*.log")},
+	})
+	appendToFile(t, logFile, "ERROR [db] old line written before we started\n")
+	assert.Equal(t, 0, len(lt.collectMetrics()))
+
+	// a file created since is read from its start
+	otherFile := path.Join(dir, "other.log")
+	appendToFile(t, otherFile, "ERROR [db] in a new file\n")
+	appendToFile(t, logFile+".1", "ERROR [db] not a match\n")
+	appendToFile(t, logFile, "ERROR [cache] miss storm\n")
+
+	metrics := lt.collectMetrics()
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", map[string]string{"file": otherFile}))
+	assert.Equal(t, 1.0, sumLogTailMetric(metrics, "app.errors", map[string]string{"file": logFile}))
+	assert.Equal(t, 2.0, sumLogTailMetric(metrics, "app.errors", nil))
+}
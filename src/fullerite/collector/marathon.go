@@ -36,6 +36,10 @@ type MarathonStats struct {
 
 func init() {
 	RegisterCollector("MarathonStats", newMarathonStats)
+	RegisterSchema("MarathonStats", config.Schema{
+		{Key: "marathonHost", Type: config.String, Required: true, Description: "Marathon host the stats are read from"},
+		{Key: "extraDimensions", Type: config.StringMap, Description: "Dimensions added to every metric"},
+	})
 }
 
 func newMarathonStats(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
@@ -77,6 +77,9 @@ type MesosStats struct {
 
 func init() {
 	RegisterCollector("MesosStats", newMesosStats)
+	RegisterSchema("MesosStats", config.Schema{
+		{Key: "mesosNodes", Type: config.String, Required: true, Description: "Comma separated Mesos masters"},
+	})
 }
 
 // newMesosStats Simple constructor to set properties for the embedded baseCollector.
@@ -52,6 +52,10 @@ type MesosSlaveStats struct {
 
 func init() {
 	RegisterCollector("MesosSlaveStats", newMesosSlaveStats)
+	RegisterSchema("MesosSlaveStats", config.Schema{
+		{Key: "httpTimeout", Type: config.String, Default: "10", Description: "Seconds to wait for the agent, as a string"},
+		{Key: "slaveSnapshotPort", Type: config.String, Default: "5051", Description: "Port of the agent, as a string"},
+	})
 }
 
 // newMesosSlaveStats Simple constructor to set properties for the embedded baseCollector.
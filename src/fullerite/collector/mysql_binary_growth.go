@@ -3,6 +3,7 @@ package collector
 import (
 	"bufio"
 	"fmt"
+	"fullerite/config"
 	"os"
 	"path"
 	"strings"
@@ -45,6 +46,9 @@ var (
 
 func init() {
 	RegisterCollector("MySQLBinlogGrowth", newMySQLBinlogGrowth)
+	RegisterSchema("MySQLBinlogGrowth", config.Schema{
+		{Key: "mycnf", Type: config.String, Default: defaultCnfPath, Description: "MySQL configuration with the binary log settings"},
+	})
 }
 
 // newMySQLBinlogGrowth creates a new MySQLBinlogGrowth collector.
@@ -0,0 +1,318 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bytes"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+// Nagios plugin exit codes
+const (
+	NagiosOK       = 0
+	NagiosWarning  = 1
+	NagiosCritical = 2
+	NagiosUnknown  = 3
+
+	nagiosDefaultTimeout = 10
+)
+
+var nagiosStateNames = map[int]string{
+	NagiosOK:       "OK",
+	NagiosWarning:  "WARNING",
+	NagiosCritical: "CRITICAL",
+	NagiosUnknown:  "UNKNOWN",
+}
+
+// label=value[UOM];[warn];[crit];[min];[max], labels with spaces are single quoted
+var nagiosPerfdataRE = regexp.MustCompile(
+	`('(?:[^']|'')+'|[^\s=']+)=(U|[-+]?[0-9.]+(?:[eE][-+]?[0-9]+)?)([a-zA-Z%]*)` +
+		`(?:;([^;\s]*))?(?:;([^;\s]*))?(?:;([^;\s]*))?(?:;([^;\s]*))?`,
+)
+
+// Used when a perfdata value is reported with the "c" unit
+const nagiosCounterUnit = "c"
+
+// NagiosCheck runs Nagios style check scripts, each on its own schedule,
+// and reports their exit status and performance data. The check
+// definitions use the same keys as Sensu checks so they can be copied over.
+//
+// Example config:
+//
+//	{
+//	    "interval": 10,
+//	    "checks": {
+//	        "disk_root": {
+//	            "command": "/usr/lib/nagios/plugins/check_disk -w 20% -c 10% -p /",
+//	            "interval": 60,
+//	            "timeout": 20
+//	        }
+//	    }
+//	}
+type NagiosCheck struct {
+	baseCollector
+
+	checks []*nagiosCheckDefinition
+}
+
+type nagiosCheckDefinition struct {
+	name     string
+	command  string
+	interval time.Duration
+	timeout  time.Duration
+
+	mutex   sync.Mutex
+	running bool
+	lastRun time.Time
+}
+
+// nagiosPerfdata is a single parsed performance data item
+type nagiosPerfdata struct {
+	label      string
+	value      float64
+	unit       string
+	thresholds map[string]float64
+}
+
+func init() {
+	RegisterCollector("NagiosCheck", newNagiosCheck)
+	RegisterSchema("NagiosCheck", config.Schema{
+		{Key: "checks", Type: config.Map, Required: true, Description: "Checks by name, each with a command, an interval and a timeout"},
+		{Key: "timeout", Type: config.Int, Default: nagiosDefaultTimeout, Description: "Seconds a check may run by default"},
+	})
+}
+
+func newNagiosCheck(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	n := new(NagiosCheck)
+
+	n.log = log
+	n.channel = channel
+	n.interval = initialInterval
+	n.name = "NagiosCheck"
+
+	return n
+}
+
+// Configure the collector
+func (n *NagiosCheck) Configure(configMap map[string]interface{}) {
+	n.configureCommonParams(configMap)
+
+	defaultTimeout := nagiosDefaultTimeout
+	if val, exists := configMap["timeout"]; exists {
+		defaultTimeout = config.GetAsInt(val, nagiosDefaultTimeout)
+	}
+
+	checks, ok := configMap["checks"].(map[string]interface{})
+	if !ok {
+		n.log.Warn("Required config 'checks' does not exist or is not a map")
+		return
+	}
+
+	names := []string{}
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	n.checks = []*nagiosCheckDefinition{}
+	for _, name := range names {
+		checkConfig, ok := checks[name].(map[string]interface{})
+		if !ok {
+			n.log.Error("Skipping check ", name, ": definition is not a map")
+			continue
+		}
+		command, ok := checkConfig["command"].(string)
+		if !ok || command == "" {
+			n.log.Error("Skipping check ", name, ": no command")
+			continue
+		}
+
+		check := &nagiosCheckDefinition{
+			name:     name,
+			command:  command,
+			interval: time.Duration(n.interval) * time.Second,
+			timeout:  time.Duration(defaultTimeout) * time.Second,
+		}
+		if val, exists := checkConfig["interval"]; exists {
+			check.interval = time.Duration(config.GetAsInt(val, n.interval)) * time.Second
+		}
+		if val, exists := checkConfig["timeout"]; exists {
+			check.timeout = time.Duration(config.GetAsInt(val, defaultTimeout)) * time.Second
+		}
+		n.checks = append(n.checks, check)
+	}
+}
+
+// Collect starts every check that is due. Checks run in the background so
+// a slow one never holds up the others; a check that is still running
+// from a previous round is not started again.
+func (n *NagiosCheck) Collect() {
+	now := time.Now()
+	for _, check := range n.checks {
+		if check.start(now) {
+			go n.runCheck(check)
+		}
+	}
+}
+
+// start marks the check as running if it is due
+func (c *nagiosCheckDefinition) start(now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.running || now.Sub(c.lastRun) < c.interval {
+		return false
+	}
+	c.running = true
+	c.lastRun = now
+	return true
+}
+
+func (c *nagiosCheckDefinition) finish() {
+	c.mutex.Lock()
+	c.running = false
+	c.mutex.Unlock()
+}
+
+func (n *NagiosCheck) runCheck(check *nagiosCheckDefinition) {
+	defer check.finish()
+
+	for _, m := range n.checkMetrics(check) {
+		n.Channel() <- m
+	}
+}
+
+func (n *NagiosCheck) checkMetrics(check *nagiosCheckDefinition) []metric.Metric {
+	checkLog := n.log.WithField("check", check.name)
+	status, output := runNagiosCommand(check.command, check.timeout)
+	checkLog.Debug("Check returned ", nagiosStateNames[status], ": ", output)
+
+	statusMetric := metric.WithValue("nagios.status", float64(status))
+	statusMetric.AddDimension("check", check.name)
+	metrics := []metric.Metric{statusMetric}
+
+	for _, perf := range parseNagiosPerfdata(output) {
+		base := metric.WithValue("nagios.perfdata", perf.value)
+		if perf.unit == nagiosCounterUnit {
+			base.MetricType = metric.CumulativeCounter
+		}
+		dims := map[string]string{"check": check.name, "label": perf.label}
+		if perf.unit != "" {
+			dims["unit"] = perf.unit
+		}
+		base.AddDimensions(dims)
+		metrics = append(metrics, base)
+
+		for _, field := range []string{"warn", "crit", "min", "max"} {
+			if value, exists := perf.thresholds[field]; exists {
+				m := metric.WithValue("nagios.perfdata."+field, value)
+				m.AddDimensions(dims)
+				metrics = append(metrics, m)
+			}
+		}
+	}
+	return metrics
+}
+
+// runNagiosCommand runs the check through the shell and returns its
+// Nagios state and output. A check that can't be run or doesn't finish
+// in time is UNKNOWN. The check gets its own process group so that
+// anything it spawned is killed along with it on timeout.
+func runNagiosCommand(command string, timeout time.Duration) (int, string) {
+	var output bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return NagiosUnknown, err.Error()
+	}
+
+	timedOut := int32(0)
+	timer := time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err := cmd.Wait()
+	timer.Stop()
+
+	if atomic.LoadInt32(&timedOut) == 1 {
+		return NagiosUnknown, "check timed out after " + timeout.String()
+	}
+	if err == nil {
+		return NagiosOK, output.String()
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			code := status.ExitStatus()
+			if code < NagiosOK || code > NagiosUnknown {
+				code = NagiosUnknown
+			}
+			return code, output.String()
+		}
+	}
+	return NagiosUnknown, err.Error()
+}
+
+// parseNagiosPerfdata extracts the performance data out of plugin output.
+// It follows the plugin guidelines: perfdata comes after the first "|" of
+// the first line, and after the first "|" found in the long text that
+// follows.
+func parseNagiosPerfdata(output string) []nagiosPerfdata {
+	lines := strings.SplitN(strings.TrimSpace(output), "\n", 2)
+
+	perfdata := ""
+	if i := strings.Index(lines[0], "|"); i >= 0 {
+		perfdata = lines[0][i+1:]
+	}
+	if len(lines) > 1 {
+		if i := strings.Index(lines[1], "|"); i >= 0 {
+			perfdata += " " + lines[1][i+1:]
+		}
+	}
+
+	result := []nagiosPerfdata{}
+	for _, match := range nagiosPerfdataRE.FindAllStringSubmatch(perfdata, -1) {
+		if match[2] == "U" {
+			// the plugin could not determine the value
+			continue
+		}
+		value, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+
+		label := match[1]
+		if strings.HasPrefix(label, "'") {
+			label = strings.Replace(label[1:len(label)-1], "''", "'", -1)
+		}
+
+		perf := nagiosPerfdata{
+			label:      label,
+			value:      value,
+			unit:       match[3],
+			thresholds: map[string]float64{},
+		}
+		for i, field := range []string{"warn", "crit", "min", "max"} {
+			// ranges (e.g. "10:20" or "@5") can't be reported as a single value
+			if threshold, err := strconv.ParseFloat(match[4+i], 64); err == nil {
+				perf.thresholds[field] = threshold
+			}
+		}
+		result = append(result, perf)
+	}
+	return result
+}
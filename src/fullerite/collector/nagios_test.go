@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"fullerite/metric"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNagiosCheck(checks map[string]interface{}) *NagiosCheck {
+	log := defaultLog.WithFields(l.Fields{"collector": "NagiosCheck"})
+	n := newNagiosCheck(make(chan metric.Metric), 10, log).(*NagiosCheck)
+	n.Configure(map[string]interface{}{"checks": checks})
+	return n
+}
+
+func TestNagiosCheckConfigure(t *testing.T) {
+	n := newTestNagiosCheck(map[string]interface{}{
+		"disk": map[string]interface{}{
+			"command":  "check_disk -w 20%",
+			"interval": 60,
+			"timeout":  "5",
+		},
+		"load":       map[string]interface{}{"command": "check_load"},
+		"no_command": map[string]interface{}{"interval": 60},
+		"not_a_map":  "check_foo",
+	})
+
+	assert.Equal(t, 2, len(n.checks))
+	assert.Equal(t, "disk", n.checks[0].name)
+	assert.Equal(t, 60*time.Second, n.checks[0].interval)
+	assert.Equal(t, 5*time.Second, n.checks[0].timeout)
+	assert.Equal(t, "load", n.checks[1].name)
+	assert.Equal(t, 10*time.Second, n.checks[1].interval)
+	assert.Equal(t, nagiosDefaultTimeout*time.Second, n.checks[1].timeout)
+}
+
+func TestNagiosCheckSchedule(t *testing.T) {
+	check := &nagiosCheckDefinition{name: "test", interval: time.Minute}
+	now := time.Now()
+
+	assert.True(t, check.start(now))
+	assert.False(t, check.start(now.Add(2*time.Minute)), "should not start while still running")
+
+	check.finish()
+	assert.False(t, check.start(now.Add(30*time.Second)), "should not start before the interval elapsed")
+	assert.True(t, check.start(now.Add(time.Minute)))
+}
+
+func TestRunNagiosCommand(t *testing.T) {
+	status, output := runNagiosCommand("echo 'DISK OK'", time.Second)
+	assert.Equal(t, NagiosOK, status)
+	assert.Equal(t, "DISK OK\n", output)
+
+	status, _ = runNagiosCommand("echo 'DISK WARNING'; exit 1", time.Second)
+	assert.Equal(t, NagiosWarning, status)
+
+	status, _ = runNagiosCommand("exit 2", time.Second)
+	assert.Equal(t, NagiosCritical, status)
+
+	status, _ = runNagiosCommand("exit 42", time.Second)
+	assert.Equal(t, NagiosUnknown, status)
+}
+
+func TestRunNagiosCommandTimeout(t *testing.T) {
+	start := time.Now()
+	status, output := runNagiosCommand("sleep 10 | cat", 100*time.Millisecond)
+
+	assert.Equal(t, NagiosUnknown, status)
+	assert.Contains(t, output, "timed out")
+	assert.True(t, time.Since(start) < 5*time.Second, "children of the check should be killed too")
+}
+
+func TestParseNagiosPerfdata(t *testing.T) {
+	output := "DISK OK - free space: / 3326 MB (56%); | /=2643MB;5948;5958;0;5968 'free inodes'=90%;;;; \n" +
+		"/boot 68 MB (69%); | /boot=68MB;88;93;0;98\n" +
+		"/home=69357MB;253404;253409;0;253414 time=0.05s;~:1;@2:5 " +
+		"packets=1234c missing=U"
+
+	perfdata := parseNagiosPerfdata(output)
+	assert.Equal(t, 6, len(perfdata))
+
+	assert.Equal(t, "/", perfdata[0].label)
+	assert.Equal(t, 2643.0, perfdata[0].value)
+	assert.Equal(t, "MB", perfdata[0].unit)
+	assert.Equal(t, map[string]float64{"warn": 5948, "crit": 5958, "min": 0, "max": 5968}, perfdata[0].thresholds)
+
+	assert.Equal(t, "free inodes", perfdata[1].label)
+	assert.Equal(t, "%", perfdata[1].unit)
+	assert.Equal(t, 0, len(perfdata[1].thresholds))
+
+	assert.Equal(t, "/boot", perfdata[2].label)
+	assert.Equal(t, "/home", perfdata[3].label)
+
+	// ranges are not reported as thresholds
+	assert.Equal(t, "time", perfdata[4].label)
+	assert.Equal(t, 0.05, perfdata[4].value)
+	assert.Equal(t, 0, len(perfdata[4].thresholds))
+
+	assert.Equal(t, "packets", perfdata[5].label)
+	assert.Equal(t, "c", perfdata[5].unit)
+}
+
+func TestParseNagiosPerfdataNone(t *testing.T) {
+	assert.Equal(t, 0, len(parseNagiosPerfdata("PROCS OK")))
+	assert.Equal(t, 0, len(parseNagiosPerfdata("")))
+}
+
+func TestNagiosCheckMetrics(t *testing.T) {
+	n := newTestNagiosCheck(map[string]interface{}{
+		"disk": map[string]interface{}{
+			"command": "echo 'DISK WARNING | /=2643MB;5948;;0 packets=10c'; exit 1",
+		},
+	})
+
+	metrics := n.checkMetrics(n.checks[0])
+	assert.Equal(t, 5, len(metrics))
+
+	assert.Equal(t, "nagios.status", metrics[0].Name)
+	assert.Equal(t, float64(NagiosWarning), metrics[0].Value)
+	assert.Equal(t, map[string]string{"check": "disk"}, metrics[0].Dimensions)
+
+	assert.Equal(t, "nagios.perfdata", metrics[1].Name)
+	assert.Equal(t, 2643.0, metrics[1].Value)
+	assert.Equal(t, metric.Gauge, metrics[1].MetricType)
+	assert.Equal(t, map[string]string{"check": "disk", "label": "/", "unit": "MB"}, metrics[1].Dimensions)
+
+	assert.Equal(t, "nagios.perfdata.warn", metrics[2].Name)
+	assert.Equal(t, 5948.0, metrics[2].Value)
+	assert.Equal(t, "nagios.perfdata.min", metrics[3].Name)
+
+	assert.Equal(t, "packets", metrics[4].Dimensions["label"])
+	assert.Equal(t, metric.CumulativeCounter, metrics[4].MetricType)
+}
+
+func TestNagiosCheckCollect(t *testing.T) {
+	n := newTestNagiosCheck(map[string]interface{}{
+		"ok": map[string]interface{}{"command": "echo OK"},
+	})
+
+	n.Collect()
+	m := <-n.Channel()
+	assert.Equal(t, "nagios.status", m.Name)
+	assert.Equal(t, "ok", m.Dimensions["check"])
+}
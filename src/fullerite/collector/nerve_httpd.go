@@ -63,6 +63,13 @@ type nerveHTTPDResponse struct {
 
 func init() {
 	RegisterCollector("NerveHTTPD", newNerveHTTPD)
+	RegisterSchema("NerveHTTPD", config.Schema{
+		{Key: "configFilePath", Type: config.String, Default: "/etc/nerve/nerve.conf.json", Description: "Nerve configuration listing the services"},
+		{Key: "queryPath", Type: config.String, Default: "server-status?auto", Description: "Path of the Apache status page"},
+		{Key: "host", Type: config.String, Default: "localhost", Description: "Host the services listen on"},
+		{Key: "status_ttl", Type: config.Int, Default: 3600, Description: "Seconds a service without a status page is skipped for"},
+		{Key: "servicesWhitelist", Type: config.StringList, Description: "Only services to query"},
+	})
 }
 
 func newNerveHTTPD(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
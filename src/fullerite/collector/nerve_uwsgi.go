@@ -38,6 +38,15 @@ type nerveUWSGICollector struct {
 
 func init() {
 	RegisterCollector("NerveUWSGI", newNerveUWSGI)
+	RegisterSchema("NerveUWSGI", config.Schema{
+		{Key: "configFilePath", Type: config.String, Default: "/etc/nerve/nerve.conf.json", Description: "Nerve configuration listing the services"},
+		{Key: "queryPath", Type: config.String, Default: "status/metrics", Description: "Path of the metrics page"},
+		{Key: "servicesWhitelist", Type: config.StringList, Description: "Only services to query"},
+		{Key: "workersStatsEnabled", Type: config.Bool, Default: false, Description: "Also reads the uWSGI worker stats"},
+		{Key: "workersStatsQueryPath", Type: config.String, Default: "status/uwsgi", Description: "Path of the worker stats"},
+		{Key: "workersStatsBlacklist", Type: config.StringList, Description: "Services whose worker stats are not read"},
+		{Key: "http_timeout", Type: config.Int, Default: 2, Description: "Seconds to wait for a service"},
+	})
 }
 
 // Default values of configuration fields
@@ -8,6 +8,7 @@ package collector
 
 import (
 	"fmt"
+	"fullerite/config"
 	"fullerite/metric"
 	"fullerite/util"
 	"os/exec"
@@ -48,6 +49,10 @@ type procNetUDPStats struct {
 
 func init() {
 	RegisterCollector("ProcNetUDPStats", newProcNetUDPStats)
+	RegisterSchema("ProcNetUDPStats", config.Schema{
+		{Key: "localAddressWhitelist", Type: config.String, Description: "Regular expression of the local addresses to report"},
+		{Key: "remoteAddressWhitelist", Type: config.String, Description: "Regular expression of the remote addresses to report"},
+	})
 }
 
 func newProcNetUDPStats(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
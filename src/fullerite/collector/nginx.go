@@ -40,6 +40,11 @@ var (
 
 func init() {
 	RegisterCollector("NginxStats", newNginxStats)
+	RegisterSchema("NginxStats", config.Schema{
+		{Key: "reqHost", Type: config.String, Default: "localhost", Description: "Host of the nginx status page"},
+		{Key: "reqPort", Type: config.String, Default: "8080", Description: "Port of the nginx status page, as a string"},
+		{Key: "reqPath", Type: config.String, Default: "/nginx_status", Description: "Path of the nginx status page"},
+	})
 }
 
 func newNginxStats(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
@@ -26,6 +26,9 @@ var (
 
 func init() {
 	RegisterCollector("NginxNerveStats", newNginxNerveStats)
+	RegisterSchema("NginxNerveStats", config.Schema{
+		{Key: "servicePath.*", Type: config.String, Description: "Path of the nginx status page of the service named after the dot"},
+	})
 }
 
 func newNginxNerveStats(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
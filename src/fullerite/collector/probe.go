@@ -0,0 +1,422 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+	"fullerite/util"
+
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+const (
+	probeTypeHTTP = "http"
+	probeTypeTCP  = "tcp"
+	probeTypeDNS  = "dns"
+
+	probeDefaultTimeout     = 5
+	probeDefaultConcurrency = 4
+	probeDefaultNervePath   = "status"
+)
+
+// Probe runs synthetic HTTP(S), TCP connect and DNS lookup checks and
+// reports whether they succeeded along with the time spent in each phase.
+//
+// Example config:
+//
+//	{
+//	    "concurrency": 4,
+//	    "timeout": 5,
+//	    "probes": {
+//	        "frontend": {"type": "http", "target": "https://www.example.com/", "timeout": 3},
+//	        "database": {"type": "tcp", "target": "db.local:3306"},
+//	        "resolver": {"type": "dns", "target": "example.com"}
+//	    },
+//	    "nerveConfigPath": "/etc/nerve/nerve.conf.json",
+//	    "nerveProbePath": "status"
+//	}
+//
+// When nerveConfigPath is set every service registered in Nerve on this
+// host also gets an HTTP probe against localhost.
+type Probe struct {
+	baseCollector
+
+	probes          []probeDefinition
+	concurrency     int
+	nerveConfigPath string
+	nerveProbePath  string
+	defaultTimeout  time.Duration
+}
+
+type probeDefinition struct {
+	name           string
+	probeType      string
+	target         string
+	timeout        time.Duration
+	insecure       bool
+	expectedStatus int
+}
+
+// probeResult holds what a single probe run measured
+type probeResult struct {
+	success    bool
+	statusCode int
+	phases     map[string]time.Duration
+	certExpiry *time.Time
+}
+
+func init() {
+	RegisterCollector("Probe", newProbe)
+	RegisterSchema("Probe", config.Schema{
+		{Key: "probes", Type: config.Map, Description: "Probes by name, each with a type, target, timeout, insecure and expectedStatus"},
+		{Key: "concurrency", Type: config.Int, Default: probeDefaultConcurrency, Description: "Probes run at the same time"},
+		{Key: "timeout", Type: config.Int, Default: probeDefaultTimeout, Description: "Seconds a probe may take by default"},
+		{Key: "nerveConfigPath", Type: config.String, Description: "Nerve configuration whose services are probed too"},
+		{Key: "nerveProbePath", Type: config.String, Default: probeDefaultNervePath, Description: "Path probed on the Nerve services"},
+	})
+}
+
+func newProbe(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
+	p := new(Probe)
+
+	p.log = log
+	p.channel = channel
+	p.interval = initialInterval
+	p.name = "Probe"
+
+	p.concurrency = probeDefaultConcurrency
+	p.nerveProbePath = probeDefaultNervePath
+	p.defaultTimeout = probeDefaultTimeout * time.Second
+
+	return p
+}
+
+// Configure the collector
+func (p *Probe) Configure(configMap map[string]interface{}) {
+	p.configureCommonParams(configMap)
+
+	if val, exists := configMap["concurrency"]; exists {
+		p.concurrency = config.GetAsInt(val, probeDefaultConcurrency)
+		if p.concurrency < 1 {
+			p.concurrency = 1
+		}
+	}
+	if val, exists := configMap["timeout"]; exists {
+		p.defaultTimeout = time.Duration(config.GetAsInt(val, probeDefaultTimeout)) * time.Second
+	}
+	if val, exists := configMap["nerveConfigPath"]; exists {
+		p.nerveConfigPath = val.(string)
+	}
+	if val, exists := configMap["nerveProbePath"]; exists {
+		p.nerveProbePath = strings.TrimLeft(val.(string), "/")
+	}
+
+	p.probes = []probeDefinition{}
+	probes, _ := configMap["probes"].(map[string]interface{})
+	names := []string{}
+	for name := range probes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		probeConfig, ok := probes[name].(map[string]interface{})
+		if !ok {
+			p.log.Error("Skipping probe ", name, ": definition is not a map")
+			continue
+		}
+		probe := probeDefinition{
+			name:      name,
+			probeType: probeTypeHTTP,
+			timeout:   p.defaultTimeout,
+		}
+		if val, exists := probeConfig["type"]; exists {
+			probe.probeType = strings.ToLower(val.(string))
+		}
+		if val, exists := probeConfig["target"]; exists {
+			probe.target = val.(string)
+		}
+		if val, exists := probeConfig["timeout"]; exists {
+			probe.timeout = time.Duration(config.GetAsFloat(val, p.defaultTimeout.Seconds()) * float64(time.Second))
+		}
+		if val, exists := probeConfig["insecure"]; exists {
+			probe.insecure = config.GetAsBool(val, false)
+		}
+		if val, exists := probeConfig["expectedStatus"]; exists {
+			probe.expectedStatus = config.GetAsInt(val, 0)
+		}
+
+		switch {
+		case probe.target == "":
+			p.log.Error("Skipping probe ", name, ": no target")
+		case probe.probeType != probeTypeHTTP && probe.probeType != probeTypeTCP && probe.probeType != probeTypeDNS:
+			p.log.Error("Skipping probe ", name, ": unknown type ", probe.probeType)
+		default:
+			p.probes = append(p.probes, probe)
+		}
+	}
+}
+
+// Collect runs all the probes, at most `concurrency` at a time, and
+// emits their results once they are all done
+func (p *Probe) Collect() {
+	probes := append([]probeDefinition{}, p.probes...)
+	probes = append(probes, p.nerveProbes()...)
+
+	results := make([][]metric.Metric, len(probes))
+	semaphore := make(chan struct{}, p.concurrency)
+	var wg sync.WaitGroup
+
+	for i := range probes {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			results[i] = probes[i].metrics(probes[i].run(p.log))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, metrics := range results {
+		for _, m := range metrics {
+			p.Channel() <- m
+		}
+	}
+}
+
+// nerveProbes builds an HTTP probe for each service Nerve has registered
+// on this host
+func (p *Probe) nerveProbes() []probeDefinition {
+	if p.nerveConfigPath == "" {
+		return nil
+	}
+
+	rawFileContents, err := ioutil.ReadFile(p.nerveConfigPath)
+	if err != nil {
+		p.log.Warn("Failed to read the contents of file ", p.nerveConfigPath, " because ", err)
+		return nil
+	}
+	services, err := util.ParseNerveConfig(&rawFileContents, false)
+	if err != nil {
+		p.log.Warn("Failed to parse the nerve config at ", p.nerveConfigPath, ": ", err)
+		return nil
+	}
+
+	probes := []probeDefinition{}
+	for _, service := range services {
+		probes = append(probes, probeDefinition{
+			name:      service.Name,
+			probeType: probeTypeHTTP,
+			target:    fmt.Sprintf("http://localhost:%d/%s", service.Port, p.nerveProbePath),
+			timeout:   p.defaultTimeout,
+		})
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].target < probes[j].target })
+	return probes
+}
+
+func (probe probeDefinition) run(log *l.Entry) probeResult {
+	probeLog := log.WithFields(l.Fields{"probe": probe.name, "target": probe.target})
+
+	var result probeResult
+	var err error
+	switch probe.probeType {
+	case probeTypeHTTP:
+		result, err = probe.runHTTP()
+	case probeTypeTCP:
+		result, err = probe.runTCP()
+	case probeTypeDNS:
+		result, err = probe.runDNS()
+	}
+	if err != nil {
+		probeLog.Warn("Probe failed: ", err)
+	}
+	return result
+}
+
+func (probe probeDefinition) runHTTP() (probeResult, error) {
+	result := probeResult{phases: map[string]time.Duration{}}
+
+	req, err := http.NewRequest("GET", probe.target, nil)
+	if err != nil {
+		return result, err
+	}
+
+	// the transport may call the hooks from different goroutines, and dials
+	// the addresses of a dual-stack host in parallel, so the phases start
+	// per address
+	var mutex sync.Mutex
+	starts := map[string]time.Time{}
+	begin := func(key string) {
+		mutex.Lock()
+		starts[key] = time.Now()
+		mutex.Unlock()
+	}
+	end := func(phase, key string) {
+		mutex.Lock()
+		if since, exists := starts[key]; exists {
+			result.phases[phase] = time.Since(since)
+		}
+		mutex.Unlock()
+	}
+	record := func(phase string, since time.Time) {
+		mutex.Lock()
+		result.phases[phase] = time.Since(since)
+		mutex.Unlock()
+	}
+
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { begin("dns") },
+		DNSDone:  func(httptrace.DNSDoneInfo) { end("dns", "dns") },
+		ConnectStart: func(network, addr string) {
+			begin("connect " + network + " " + addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				end("connect", "connect "+network+" "+addr)
+			}
+		},
+		TLSHandshakeStart:    func() { begin("tls") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { end("tls", "tls") },
+		GotFirstResponseByte: func() { record("first_byte", start) },
+	}
+
+	client := http.Client{
+		Timeout: probe.timeout,
+		Transport: &http.Transport{
+			// every probe measures a fresh connection
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: probe.insecure},
+		},
+	}
+	rsp, err := client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return result, err
+	}
+	io.Copy(ioutil.Discard, rsp.Body)
+	rsp.Body.Close()
+	record("total", start)
+
+	result.statusCode = rsp.StatusCode
+	if rsp.TLS != nil && len(rsp.TLS.PeerCertificates) > 0 {
+		expiry := rsp.TLS.PeerCertificates[0].NotAfter
+		result.certExpiry = &expiry
+	}
+
+	if probe.expectedStatus != 0 {
+		result.success = rsp.StatusCode == probe.expectedStatus
+	} else {
+		result.success = rsp.StatusCode < 400
+	}
+	if !result.success {
+		return result, fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+	}
+	return result, nil
+}
+
+func (probe probeDefinition) runTCP() (probeResult, error) {
+	result := probeResult{phases: map[string]time.Duration{}}
+
+	host, port, err := net.SplitHostPort(probe.target)
+	if err != nil {
+		return result, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probe.timeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	result.phases["dns"] = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+
+	connectStart := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+	if err != nil {
+		return result, err
+	}
+	conn.Close()
+	result.phases["connect"] = time.Since(connectStart)
+	result.phases["total"] = time.Since(start)
+
+	result.success = true
+	return result, nil
+}
+
+func (probe probeDefinition) runDNS() (probeResult, error) {
+	result := probeResult{phases: map[string]time.Duration{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probe.timeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, probe.target)
+	result.phases["dns"] = time.Since(start)
+	result.phases["total"] = result.phases["dns"]
+	if err != nil {
+		return result, err
+	}
+
+	result.success = len(addrs) > 0
+	return result, nil
+}
+
+// metrics converts a probe result into metrics. Latencies are reported in
+// milliseconds with a phase dimension.
+func (probe probeDefinition) metrics(result probeResult) []metric.Metric {
+	dims := map[string]string{
+		"probe":      probe.name,
+		"target":     probe.target,
+		"probe_type": probe.probeType,
+	}
+	build := func(name string, value float64) metric.Metric {
+		m := metric.WithValue(name, value)
+		m.AddDimensions(dims)
+		return m
+	}
+
+	success := 0.0
+	if result.success {
+		success = 1.0
+	}
+	metrics := []metric.Metric{build("probe.success", success)}
+
+	phases := []string{}
+	for phase := range result.phases {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		m := build("probe.latency", result.phases[phase].Seconds()*1000)
+		m.AddDimension("phase", phase)
+		metrics = append(metrics, m)
+	}
+
+	if result.statusCode != 0 {
+		metrics = append(metrics, build("probe.http.status_code", float64(result.statusCode)))
+	}
+	if result.certExpiry != nil {
+		days := time.Until(*result.certExpiry).Hours() / 24
+		metrics = append(metrics, build("probe.tls.cert_expiry_days", days))
+	}
+	return metrics
+}
@@ -0,0 +1,269 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"fullerite/metric"
+	"fullerite/util"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProbe(configMap map[string]interface{}) *Probe {
+	log := defaultLog.WithFields(l.Fields{"collector": "Probe"})
+	p := newProbe(make(chan metric.Metric), 10, log).(*Probe)
+	p.Configure(configMap)
+	return p
+}
+
+func probeMetric(metrics []metric.Metric, name string, dims map[string]string) (metric.Metric, bool) {
+	for _, m := range metrics {
+		if m.Name != name {
+			continue
+		}
+		matches := true
+		for k, v := range dims {
+			if m.Dimensions[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			return m, true
+		}
+	}
+	return metric.Metric{}, false
+}
+
+func TestProbeConfigure(t *testing.T) {
+	p := newTestProbe(map[string]interface{}{
+		"concurrency": 2,
+		"timeout":     3,
+		"probes": map[string]interface{}{
+			"web":        map[string]interface{}{"target": "http://localhost/", "expectedStatus": 204},
+			"db":         map[string]interface{}{"type": "TCP", "target": "localhost:3306", "timeout": 0.5},
+			"resolver":   map[string]interface{}{"type": "dns", "target": "example.com"},
+			"no_target":  map[string]interface{}{"type": "dns"},
+			"bad_type":   map[string]interface{}{"type": "icmp", "target": "localhost"},
+			"not_a_map":  "http://localhost",
+			"tls_no_chk": map[string]interface{}{"target": "https://localhost/", "insecure": true},
+		},
+	})
+
+	assert.Equal(t, 2, p.concurrency)
+	assert.Equal(t, 4, len(p.probes))
+
+	assert.Equal(t, "db", p.probes[0].name)
+	assert.Equal(t, probeTypeTCP, p.probes[0].probeType)
+	assert.Equal(t, 500*time.Millisecond, p.probes[0].timeout)
+
+	assert.Equal(t, "resolver", p.probes[1].name)
+	assert.Equal(t, 3*time.Second, p.probes[1].timeout)
+
+	assert.True(t, p.probes[2].insecure)
+
+	assert.Equal(t, "web", p.probes[3].name)
+	assert.Equal(t, probeTypeHTTP, p.probes[3].probeType)
+	assert.Equal(t, 204, p.probes[3].expectedStatus)
+}
+
+func TestProbeHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	probe := probeDefinition{name: "web", probeType: probeTypeHTTP, target: ts.URL, timeout: time.Second}
+	result, err := probe.runHTTP()
+	assert.Nil(t, err)
+	assert.True(t, result.success)
+	assert.Equal(t, 200, result.statusCode)
+	assert.Nil(t, result.certExpiry)
+	for _, phase := range []string{"connect", "first_byte", "total"} {
+		_, exists := result.phases[phase]
+		assert.True(t, exists, "missing phase "+phase)
+	}
+
+	probe.target = ts.URL + "/broken"
+	result, err = probe.runHTTP()
+	assert.NotNil(t, err)
+	assert.False(t, result.success)
+	assert.Equal(t, 500, result.statusCode)
+
+	probe.expectedStatus = 500
+	result, err = probe.runHTTP()
+	assert.Nil(t, err)
+	assert.True(t, result.success)
+}
+
+func TestProbeHTTPResolvesName(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	// localhost may resolve to both ::1 and 127.0.0.1, dialed in parallel
+	target := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	probe := probeDefinition{name: "web", probeType: probeTypeHTTP, target: target, timeout: time.Second}
+	result, err := probe.runHTTP()
+	assert.Nil(t, err)
+	for _, phase := range []string{"dns", "connect", "first_byte", "total"} {
+		_, exists := result.phases[phase]
+		assert.True(t, exists, "missing phase "+phase)
+	}
+}
+
+func TestProbeHTTPS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	probe := probeDefinition{name: "web", probeType: probeTypeHTTP, target: ts.URL, timeout: time.Second}
+	result, err := probe.runHTTP()
+	assert.NotNil(t, err, "self signed certificate should fail verification")
+	assert.False(t, result.success)
+
+	probe.insecure = true
+	result, err = probe.runHTTP()
+	assert.Nil(t, err)
+	assert.True(t, result.success)
+	_, exists := result.phases["tls"]
+	assert.True(t, exists)
+
+	metrics := probe.metrics(result)
+	m, ok := probeMetric(metrics, "probe.tls.cert_expiry_days", nil)
+	assert.True(t, ok)
+	assert.True(t, m.Value > 0)
+}
+
+func TestProbeHTTPTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	probe := probeDefinition{name: "slow", probeType: probeTypeHTTP, target: ts.URL, timeout: 50 * time.Millisecond}
+	result, err := probe.runHTTP()
+	assert.NotNil(t, err)
+	assert.False(t, result.success)
+}
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	probe := probeDefinition{name: "db", probeType: probeTypeTCP, target: listener.Addr().String(), timeout: time.Second}
+	result, err := probe.runTCP()
+	assert.Nil(t, err)
+	assert.True(t, result.success)
+	_, exists := result.phases["connect"]
+	assert.True(t, exists)
+
+	listener.Close()
+	result, err = probe.runTCP()
+	assert.NotNil(t, err)
+	assert.False(t, result.success)
+
+	probe.target = "no-port"
+	_, err = probe.runTCP()
+	assert.NotNil(t, err)
+}
+
+func TestProbeDNS(t *testing.T) {
+	probe := probeDefinition{name: "resolver", probeType: probeTypeDNS, target: "localhost", timeout: time.Second}
+	result, err := probe.runDNS()
+	assert.Nil(t, err)
+	assert.True(t, result.success)
+
+	probe.target = "does-not-exist.invalid"
+	result, err = probe.runDNS()
+	assert.NotNil(t, err)
+	assert.False(t, result.success)
+}
+
+func TestProbeMetrics(t *testing.T) {
+	probe := probeDefinition{name: "web", probeType: probeTypeHTTP, target: "http://localhost/"}
+	expiry := time.Now().Add(48*time.Hour + time.Minute)
+	result := probeResult{
+		success:    true,
+		statusCode: 200,
+		phases:     map[string]time.Duration{"dns": time.Millisecond, "total": 20 * time.Millisecond},
+		certExpiry: &expiry,
+	}
+
+	metrics := probe.metrics(result)
+	assert.Equal(t, 5, len(metrics))
+
+	m, _ := probeMetric(metrics, "probe.success", nil)
+	assert.Equal(t, 1.0, m.Value)
+	assert.Equal(t, map[string]string{"probe": "web", "target": "http://localhost/", "probe_type": "http"}, m.Dimensions)
+
+	m, _ = probeMetric(metrics, "probe.latency", map[string]string{"phase": "total"})
+	assert.Equal(t, 20.0, m.Value)
+
+	m, _ = probeMetric(metrics, "probe.http.status_code", nil)
+	assert.Equal(t, 200.0, m.Value)
+
+	m, _ = probeMetric(metrics, "probe.tls.cert_expiry_days", nil)
+	assert.Equal(t, 2, int(m.Value))
+}
+
+func TestProbeCollectWithNerve(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+	}))
+	defer ts.Close()
+	port := ts.URL[strings.LastIndex(ts.URL, ":")+1:]
+
+	nerveConfig := util.CreateMinimalNerveConfig(map[string]util.EndPoint{
+		"example_service.main": {Host: "127.0.0.1", Port: port},
+	})
+	contents, _ := json.Marshal(nerveConfig)
+	nerveFile, _ := ioutil.TempFile("", "nerve.conf.json")
+	nerveFile.Write(contents)
+	nerveFile.Close()
+	defer os.Remove(nerveFile.Name())
+
+	p := newTestProbe(map[string]interface{}{
+		"nerveConfigPath": nerveFile.Name(),
+		"nerveProbePath":  "/health",
+		"probes": map[string]interface{}{
+			"resolver": map[string]interface{}{"type": "dns", "target": "localhost"},
+		},
+	})
+
+	go p.Collect()
+
+	metrics := []metric.Metric{}
+	timeout := time.After(5 * time.Second)
+	for len(metrics) < 4 {
+		select {
+		case m := <-p.Channel():
+			metrics = append(metrics, m)
+		case <-timeout:
+			t.Fatal("timed out waiting for probe metrics")
+		}
+	}
+
+	m, ok := probeMetric(metrics, "probe.success", map[string]string{"probe": "example_service"})
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, m.Value)
+	assert.Equal(t, "http://localhost:"+port+"/health", m.Dimensions["target"])
+
+	m, ok = probeMetric(metrics, "probe.success", map[string]string{"probe": "resolver"})
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, m.Value)
+}
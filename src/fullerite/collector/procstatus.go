@@ -29,6 +29,11 @@ func (ps ProcStatus) MatchCommandLine() bool {
 
 func init() {
 	RegisterCollector("ProcStatus", newProcStatus)
+	RegisterSchema("ProcStatus", config.Schema{
+		{Key: "pattern", Type: config.String, Description: "Regular expression of the process names to report"},
+		{Key: "matchCommandLine", Type: config.Bool, Default: false, Description: "Matches the pattern against the command line instead of the name"},
+		{Key: "generatedDimensions", Type: config.StringMap, Description: "Dimensions extracted from the command line by regular expressions"},
+	})
 }
 
 // newProcStatus creates a new Test collector.
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"strings"
+)
+
+// collectorSchemas holds the configuration keys of each collector, besides
+// the common ones
+var collectorSchemas = map[string]config.Schema{}
+
+// commonSchema declares the keys configureCommonParams reads
+var commonSchema = append(config.Schema{
+	{Key: "interval", Type: config.Int, Default: DefaultCollectionInterval, Description: "Seconds between collections, the global interval by default"},
+	{Key: "prefix", Type: config.String, Description: "Prefix of the metric names"},
+	{Key: "metrics_blacklist", Type: config.StringList, Description: "Regular expressions of the metric names not to emit"},
+	{Key: "dimensions_blacklist", Type: config.StringMap, Description: "Dimension names and value regular expressions of the metrics not to emit"},
+	{Key: "aggregation", Type: config.Map, Description: "Aggregates the matching metrics over a window before emitting them"},
+}, metric.CardinalitySchema...)
+
+// diamondSchema declares the keys of the Python Diamond collector
+// configuration the native ports read, and the ones only Python reads
+var diamondSchema = config.Schema{
+	{Key: "metrics_blacklist", Type: config.StringOrList, Description: "Regular expression of the metric paths not to emit, or a list of metric name regular expressions"},
+	{Key: "metrics_whitelist", Type: config.String, Description: "Regular expression of the only metric paths to emit"},
+	{Key: "path", Type: config.String, Description: "Path of the metrics, the collector's by default"},
+	{Key: "path_prefix", Type: config.String, Default: diamondDefaultPathPrefix, Description: "Prefix of the metric paths"},
+	{Key: "path_suffix", Type: config.String, Description: "Suffix of the metric paths"},
+	{Key: "byte_unit", Type: config.StringOrList, Description: "Units the byte metrics are converted to"},
+	{Key: "procPath", Type: config.String, Default: diamondDefaultProcPath, Description: "Where /proc is mounted"},
+	{Key: "enabled", Type: config.Any, Description: "Only read by the Python collector"},
+	{Key: "measure_collector_time", Type: config.Any, Description: "Only read by the Python collector"},
+	{Key: "ttl_multiplier", Type: config.Any, Description: "Only read by the Python collector"},
+}
+
+// RegisterSchema declares the configuration keys of a collector, besides
+// the common ones
+func RegisterSchema(name string, schema config.Schema) {
+	collectorSchemas[name] = schema
+}
+
+// Schema returns the configuration schema of a collector, and false when
+// there is no such collector. Like collector names, the name may have an
+// instance suffix.
+func Schema(name string) (config.Schema, bool) {
+	realName := strings.Split(name, " ")[0]
+	if _, exists := collectorConstructs[realName]; !exists {
+		return nil, false
+	}
+
+	schema := config.Schema{}
+	if nativeDiamondCollectors[realName] {
+		schema = append(schema, diamondSchema...)
+	}
+	for _, field := range commonSchema {
+		if _, declared := schema.Field(field.Key); !declared {
+			schema = append(schema, field)
+		}
+	}
+	return append(schema, collectorSchemas[realName]...), true
+}
+
+// ValidateConfig returns the problems of a collector configuration: those
+// its schema finds and those of its aggregation.
+func ValidateConfig(name string, configMap map[string]interface{}) []config.Problem {
+	schema, exists := Schema(name)
+	if !exists {
+		return []config.Problem{{Message: "unknown collector " + name}}
+	}
+	problems := schema.Validate(configMap)
+	if aggregation, ok := configMap["aggregation"].(map[string]interface{}); ok {
+		if _, err := metric.ParseAggregationConfig(aggregation); err != nil {
+			problems = append(problems, config.Problem{Key: "aggregation", Message: err.Error()})
+		}
+	}
+	return problems
+}
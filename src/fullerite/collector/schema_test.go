@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"fullerite/config"
+
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaOfNativeDiamondCollector(t *testing.T) {
+	schema, exists := Schema("CPUCollector")
+	assert.True(t, exists)
+
+	field, declared := schema.Field("metrics_blacklist")
+	assert.True(t, declared)
+	assert.Equal(t, config.StringOrList, field.Type)
+
+	_, exists = Schema("NoSuchCollector")
+	assert.False(t, exists)
+}
+
+func TestValidateConfig(t *testing.T) {
+	problems := ValidateConfig("Diamond", map[string]interface{}{
+		"port":     true,
+		"interval": "10",
+		"typo":     1.0,
+	})
+
+	assert.Equal(t, []config.Problem{
+		{Key: "port", Message: "should be a string or number, not true"},
+		{Key: "typo", Message: "unknown key", Warning: true},
+	}, problems)
+}
+
+func TestValidateConfigUnknownCollector(t *testing.T) {
+	problems := ValidateConfig("NoSuchCollector", map[string]interface{}{})
+
+	assert.Equal(t, []config.Problem{{Message: "unknown collector NoSuchCollector"}}, problems)
+}
@@ -56,6 +56,14 @@ var (
 
 func init() {
 	RegisterCollector("SmemStats", newSmemStats)
+	RegisterSchema("SmemStats", config.Schema{
+		{Key: "user", Type: config.String, Required: true, Description: "User running smem"},
+		{Key: "procsWhitelist", Type: config.String, Required: true, Description: "Regular expression of the processes to report"},
+		{Key: "smemPath", Type: config.String, Required: true, Description: "Path of smem"},
+		{Key: "metricsBlacklist", Type: config.StringList, Description: "Metrics not to report"},
+		{Key: "dimensionsFromCmdline", Type: config.StringMap, Description: "Dimensions extracted from the command line by regular expressions"},
+		{Key: "dimensionsFromEnv", Type: config.StringMap, Description: "Dimensions read from environment variables of the processes"},
+	})
 }
 
 func newSmemStats(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
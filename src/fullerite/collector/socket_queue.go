@@ -25,6 +25,9 @@ var (
 
 func init() {
 	RegisterCollector("SocketQueue", newSocketQueue)
+	RegisterSchema("SocketQueue", config.Schema{
+		{Key: "PortList", Type: config.StringList, Required: true, Description: "Ports whose queues are reported"},
+	})
 }
 
 func newSocketQueue(channel chan metric.Metric, initialInterval int, log *l.Entry) Collector {
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"fullerite/config"
 	"fullerite/metric"
 
 	"math/rand"
@@ -24,6 +25,9 @@ type Test struct {
 
 func init() {
 	RegisterCollector("Test", NewTest)
+	RegisterSchema("Test", config.Schema{
+		{Key: "metricName", Type: config.String, Default: "TestMetric", Description: "Name of the metric emitted"},
+	})
 }
 
 // NewTest creates a new Test collector.
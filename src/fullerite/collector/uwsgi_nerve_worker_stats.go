@@ -30,6 +30,12 @@ type uWSGINerveWorkerStatsCollector struct {
 
 func init() {
 	RegisterCollector("UWSGINerveWorkerStats", newUWSGINerveWorkerStats)
+	RegisterSchema("UWSGINerveWorkerStats", config.Schema{
+		{Key: "configFilePath", Type: config.String, Default: "/etc/nerve/nerve.conf.json", Description: "Nerve configuration listing the services"},
+		{Key: "queryPath", Type: config.String, Default: "status/uwsgi", Description: "Path of the worker stats"},
+		{Key: "servicesWhitelist", Type: config.StringList, Description: "Only services to query"},
+		{Key: "http_timeout", Type: config.Int, Default: 2, Description: "Seconds to wait for a service"},
+	})
 }
 
 // Default values of configuration fields
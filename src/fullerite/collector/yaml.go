@@ -65,6 +65,13 @@ type YamlMetrics struct {
 
 func init() {
 	RegisterCollector("YamlMetrics", NewYamlMetrics)
+	RegisterSchema("YamlMetrics", config.Schema{
+		{Key: "yamlSource", Type: config.String, Default: defaultYamlSource, Description: "File, URL or command the YAML is read from"},
+		{Key: "yamlSourceMethod", Type: config.String, Default: defaultYamlSourceMethod, Description: "How yamlSource is read"},
+		{Key: "yamlFormat", Type: config.String, Default: defaultYamlFormat, Description: "Layout of the YAML"},
+		{Key: "yamlKeyWhitelist", Type: config.StringList, Description: "Only keys to report"},
+		{Key: "metricPrefix", Type: config.String, Default: defaultYamlMetricPrefix, Description: "Prefix of the metric names"},
+	})
 }
 
 // NewYamlMetrics returns a initial collector, to be configured
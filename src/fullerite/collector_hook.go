@@ -52,6 +52,7 @@ func (hook *LogErrorHook) reportErrors(entry *logrus.Entry) {
 	newMetric.Value = 1
 	if val, exists := entry.Data["collector"]; exists {
 		newMetric.AddDimension("collector", val.(string))
+		recordCollectorErrorLog(val.(string))
 	}
 
 	writeToHandlers(hook.handlers, newMetric)
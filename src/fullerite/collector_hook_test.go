@@ -42,3 +42,16 @@ func TestCollectorLogsErrors(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestLogErrorHookCountsCollectorErrors(t *testing.T) {
+	resetCollectorStats()
+	testLogger := test_utils.BuildLogger().WithField("collector", "Test hook error logs")
+	hook := NewLogErrorHook([]handler.Handler{})
+
+	hook.reportErrors(testLogger)
+	hook.reportErrors(testLogger)
+
+	stats := map[string]metric.InternalMetrics{}
+	mergeCollectorRunStats(stats)
+	assert.Equal(t, 2.0, stats["Test hook error logs"].Counters["fullerite.collector_error_logs"])
+}
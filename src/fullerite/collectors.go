@@ -8,6 +8,9 @@ import (
 
 	"fmt"
 	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,6 +29,50 @@ func startCollectors(c config.Config) (collectors []collector.Collector) {
 			collectors = append(collectors, collectorInst)
 		}
 	}
+
+	// Diamond collectors listed in nativeDiamondCollectors run in-process
+	// instead of in the Python Diamond server. Their metrics carry the
+	// collectorCanonicalName dimension just like the Python ones.
+	for _, name := range c.DiamondCollectors {
+		if !isNativeDiamondCollector(name, c) {
+			continue
+		}
+		if !collector.IsNativeDiamondCollector(name) {
+			log.Error("There is no native version of diamond collector ", name)
+			continue
+		}
+		conf, err := c.GetCollectorConfig(name)
+		if err != nil {
+			log.Error("Collector config failed to load for: ", name)
+			continue
+		}
+
+		collectorInst := startCollector(name, c, conf)
+		if collectorInst != nil {
+			collectors = append(collectors, collectorInst)
+		}
+	}
+	return collectors
+}
+
+func isNativeDiamondCollector(name string, c config.Config) bool {
+	for _, native := range c.NativeDiamondCollectors {
+		if native == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pythonDiamondCollectors returns the Diamond collectors that are left to
+// the Python Diamond server
+func pythonDiamondCollectors(c config.Config) []string {
+	collectors := []string{}
+	for _, name := range c.DiamondCollectors {
+		if !isNativeDiamondCollector(name, c) {
+			collectors = append(collectors, name)
+		}
+	}
 	return collectors
 }
 
@@ -36,20 +83,38 @@ func startCollector(name string, globalConfig config.Config, instanceConfig map[
 		return nil
 	}
 
+	logConfigProblems(collector.ValidateConfig(name, instanceConfig), "Collector "+name)
+
 	// apply the global configs
 	collectorInst.SetInterval(config.GetAsInt(globalConfig.Interval, collector.DefaultCollectionInterval))
 
+	// the Diamond collector may run the Python Diamond server, which needs
+	// the global config
+	if diamond, ok := collectorInst.(*collector.Diamond); ok {
+		configFile, remove, err := globalConfig.JSONFile()
+		if err != nil {
+			// the Python server only reads JSON
+			log.Error("Not starting collector ", name, ", failed to write the configuration for the Diamond server: ", err)
+			return nil
+		}
+		atExit(diamond.Stop)
+		atExit(remove)
+		diamond.SetServerConfig(configFile, globalConfig.DiamondCollectorsPath, pythonDiamondCollectors(globalConfig))
+	}
+
 	// apply the instance configs
 	collectorInst.Configure(instanceConfig)
 
-	go runCollector(collectorInst)
+	control := registerCollectorControl(collectorInst, instanceConfig)
+	go runCollector(collectorInst, control)
 	return collectorInst
 }
 
-func runCollector(collector collector.Collector) {
+func runCollector(collector collector.Collector, control *collectorControl) {
 	log.Info("Running ", collector)
 
 	ticker := time.NewTicker(time.Duration(collector.Interval()) * time.Second)
+	defer ticker.Stop()
 	collect := ticker.C
 
 	staggerValue := 1
@@ -58,18 +123,26 @@ func runCollector(collector collector.Collector) {
 	for {
 		select {
 		case <-collect:
-			if collector.CollectorType() == "listener" {
-				collector.Collect()
-			} else {
-				countdownTimer := time.AfterFunc(collectionDeadline*time.Second, func() {
-					reportCollector(collector)
-				})
-				collector.Collect()
-				countdownTimer.Stop()
+			if control.isPaused() {
+				continue
 			}
+		case <-control.collectNow:
+		case <-control.stop:
+			return
 		}
+
+		start := time.Now()
+		if collector.CollectorType() == "listener" {
+			collector.Collect()
+		} else {
+			countdownTimer := time.AfterFunc(collectionDeadline*time.Second, func() {
+				reportCollector(collector)
+			})
+			collector.Collect()
+			countdownTimer.Stop()
+		}
+		recordCollectorRun(collector.CanonicalName(), time.Since(start))
 	}
-	ticker.Stop()
 }
 
 func readFromCollectors(collectors []collector.Collector,
@@ -87,8 +160,15 @@ func readFromCollector(collector collector.Collector,
 	// from Single channel (owned by Go Diamond Collector) and hence we use a map
 	// for keeping track of metrics from each individual collector
 	emissionCounter := map[string]uint64{}
+	runStats := map[string]*collectorRunStats{}
 	lastEmission := time.Now()
 	statDuration := time.Duration(collector.Interval()) * time.Second
+	// Diamond metrics are limited per Python collector, hence one limiter
+	// per canonical name
+	limiters := map[string]*metric.CardinalityLimiter{}
+	lastCardinalityReport := time.Now()
+	aggregators := map[string]*metric.Aggregator{}
+	stopAggregating := make(chan struct{})
 	for m := range collector.Channel() {
 		var exists bool
 		c := collector.CanonicalName()
@@ -108,7 +188,29 @@ func readFromCollector(collector collector.Collector,
 		if stringInSlice(m.Name, collector.Blacklist()) {
 			continue
 		}
+		if time.Since(lastCardinalityReport) > statDuration {
+			reportCardinalityExceeded(limiters, collector.Prefix(), handlers)
+			lastCardinalityReport = time.Now()
+		}
+		if cardinality := collector.CardinalityConfig(); cardinality.Limit > 0 {
+			limiter, exists := limiters[c]
+			if !exists {
+				limiter = metric.NewCardinalityLimiter(cardinality, c, log)
+				limiters[c] = limiter
+				registerCardinalityLimiter(c, limiter)
+			}
+			var ok bool
+			if m, ok = limiter.Check(m); !ok {
+				continue
+			}
+		}
 		emissionCounter[c]++
+		stats, exists := runStats[c]
+		if !exists {
+			stats = collectorRunStatsFor(c)
+			runStats[c] = stats
+		}
+		stats.recordEmission()
 		// collectorStatChans is an optional parameter. In case of ad-hoc collector
 		// this parameter is not supplied at all. Using variadic arguments is pretty much
 		// only way of doing this in go.
@@ -125,18 +227,268 @@ func readFromCollector(collector collector.Collector,
 			m.Name = collector.Prefix() + m.Name
 		}
 
-		for i := range handlers {
-			if _, exists := handlers[i].CollectorEndpoints()[c]; exists {
-				handlers[i].CollectorEndpoints()[c].Channel <- m
+		if aggregation := collector.AggregationConfig(); aggregation != nil {
+			aggregator, exists := aggregators[c]
+			if !exists {
+				aggregator = metric.NewAggregator(*aggregation)
+				aggregators[c] = aggregator
+				go emitAggregates(c, aggregator, handlers, stopAggregating)
+			}
+			if aggregator.Add(m) {
+				continue
 			}
 		}
+
+		sendToHandlers(c, m, handlers)
 	}
+	close(stopAggregating)
 	// Closing the stat channel after collector loop finishes
 	for _, statChannel := range collectorStatChans {
 		close(statChannel)
 	}
 }
 
+// reportCardinalityExceeded sends a fullerite.cardinality_exceeded counter
+// for every collector that had metrics over its cardinality limit to the
+// handlers of that collector, along with the sums of the points over the
+// limit when they are aggregated
+func reportCardinalityExceeded(limiters map[string]*metric.CardinalityLimiter, prefix string, handlers []handler.Handler) {
+	for c, limiter := range limiters {
+		for _, m := range limiter.TakeOverflow() {
+			m.Name = prefix + m.Name
+			sendToHandlers(c, m, handlers)
+		}
+		exceeded := limiter.TakeExceeded()
+		if exceeded == 0 {
+			continue
+		}
+		m := metric.WithValue(metric.CardinalityExceeded, float64(exceeded))
+		m.MetricType = metric.Counter
+		m.AddDimension("collector", c)
+		sendToHandlers(c, m, handlers)
+	}
+}
+
+// emitAggregates sends the aggregated metrics of collector c to its
+// handlers at the end of each aggregation window, and once more when
+// the collector stops
+func emitAggregates(c string, aggregator *metric.Aggregator, handlers []handler.Handler, stop <-chan struct{}) {
+	ticker := time.NewTicker(aggregator.Window())
+	defer ticker.Stop()
+	for stopped := false; !stopped; {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			stopped = true
+		}
+		for _, m := range aggregator.Flush() {
+			sendToHandlers(c, m, handlers)
+		}
+	}
+}
+
+// collectorCardinality keeps the cardinality limiters of the collectors,
+// by canonical name, for the internal server
+var collectorCardinality = struct {
+	sync.Mutex
+	limiters map[string]*metric.CardinalityLimiter
+}{limiters: map[string]*metric.CardinalityLimiter{}}
+
+func registerCardinalityLimiter(name string, limiter *metric.CardinalityLimiter) {
+	collectorCardinality.Lock()
+	defer collectorCardinality.Unlock()
+	collectorCardinality.limiters[name] = limiter
+}
+
+// mergeCollectorCardinality adds the unique series of the collectors with
+// a cardinality limit to the stats
+func mergeCollectorCardinality(stats map[string]metric.InternalMetrics) {
+	collectorCardinality.Lock()
+	defer collectorCardinality.Unlock()
+	for name, limiter := range collectorCardinality.limiters {
+		m, exists := stats[name]
+		if !exists {
+			m = metric.InternalMetrics{Counters: map[string]float64{}, Gauges: map[string]float64{}}
+		}
+		m.Gauges["fullerite.unique_series"] = float64(limiter.Series())
+		m.Gauges["fullerite.unique_series_limit"] = float64(limiter.Limit())
+		stats[name] = m
+	}
+}
+
+// collectorControl lets the admin API pause the scheduled collections of
+// a collector or make it collect now, and keeps its configuration
+type collectorControl struct {
+	collector  collector.Collector
+	config     map[string]interface{}
+	paused     int32
+	collectNow chan struct{}
+	stop       chan struct{}
+}
+
+func (control *collectorControl) isPaused() bool {
+	return atomic.LoadInt32(&control.paused) == 1
+}
+
+func (control *collectorControl) setPaused(paused bool) {
+	value := int32(0)
+	if paused {
+		value = 1
+	}
+	atomic.StoreInt32(&control.paused, value)
+}
+
+// collectorControls keeps the controls of the running collectors, by
+// canonical name
+var collectorControls = struct {
+	sync.Mutex
+	controls map[string]*collectorControl
+}{controls: map[string]*collectorControl{}}
+
+func registerCollectorControl(c collector.Collector, conf map[string]interface{}) *collectorControl {
+	control := &collectorControl{
+		collector:  c,
+		config:     conf,
+		collectNow: make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+	collectorControls.Lock()
+	defer collectorControls.Unlock()
+	collectorControls.controls[c.CanonicalName()] = control
+	return control
+}
+
+// stopCollector stops running a collector and forgets its control
+func stopCollector(name string) {
+	collectorControls.Lock()
+	defer collectorControls.Unlock()
+	if control, exists := collectorControls.controls[name]; exists {
+		close(control.stop)
+		delete(collectorControls.controls, name)
+		if stoppable, ok := control.collector.(collector.StoppableCollector); ok {
+			stoppable.Stop()
+		}
+	}
+}
+
+func collectorControlFor(name string) *collectorControl {
+	collectorControls.Lock()
+	defer collectorControls.Unlock()
+	return collectorControls.controls[name]
+}
+
+// collectorDurationWindow is how many of the last runs of a collector the
+// percentiles of its collection duration are computed over
+const collectorDurationWindow = 100
+
+// collectorRunStats are the runtime stats of a collector: its runs and
+// their durations, the runs that went over the deadline, the errors it
+// logged and the points it emitted
+type collectorRunStats struct {
+	// points and lastEmission, in nanoseconds since the epoch, change with
+	// every metric emitted and hence are updated atomically, out of mu
+	points       uint64
+	lastEmission int64
+
+	mu            sync.Mutex
+	runs          float64
+	overruns      float64
+	errorLogs     float64
+	lastDuration  time.Duration
+	durations     []float64
+	nextDuration  int
+	lastRunPoints float64
+}
+
+// collectorStats keeps the runtime stats of the collectors, by canonical
+// name, for the internal server
+var collectorStats = struct {
+	sync.Mutex
+	collectors map[string]*collectorRunStats
+}{collectors: map[string]*collectorRunStats{}}
+
+// collectorRunStatsFor returns the stats of a collector, which callers
+// recording every metric keep rather than look up each time
+func collectorRunStatsFor(name string) *collectorRunStats {
+	collectorStats.Lock()
+	defer collectorStats.Unlock()
+	stats, exists := collectorStats.collectors[name]
+	if !exists {
+		stats = &collectorRunStats{}
+		collectorStats.collectors[name] = stats
+	}
+	return stats
+}
+
+// updateCollectorStats applies update to the stats of a collector
+func updateCollectorStats(name string, update func(*collectorRunStats)) {
+	stats := collectorRunStatsFor(name)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	update(stats)
+}
+
+// recordCollectorRun accounts a run of a collector: its duration and the
+// points emitted since the previous run ended
+func recordCollectorRun(name string, duration time.Duration) {
+	updateCollectorStats(name, func(stats *collectorRunStats) {
+		stats.runs++
+		stats.lastDuration = duration
+		if len(stats.durations) < collectorDurationWindow {
+			stats.durations = append(stats.durations, duration.Seconds())
+		} else {
+			stats.durations[stats.nextDuration] = duration.Seconds()
+		}
+		stats.nextDuration = (stats.nextDuration + 1) % collectorDurationWindow
+		stats.lastRunPoints = float64(atomic.SwapUint64(&stats.points, 0))
+	})
+}
+
+func recordCollectorOverrun(name string) {
+	updateCollectorStats(name, func(stats *collectorRunStats) { stats.overruns++ })
+}
+
+func recordCollectorErrorLog(name string) {
+	updateCollectorStats(name, func(stats *collectorRunStats) { stats.errorLogs++ })
+}
+
+func (stats *collectorRunStats) recordEmission() {
+	atomic.AddUint64(&stats.points, 1)
+	atomic.StoreInt64(&stats.lastEmission, time.Now().UnixNano())
+}
+
+// mergeCollectorRunStats adds the runtime stats of the collectors to the
+// stats. The duration and points of the runs are only there for the
+// collectors that ran, not the Python Diamond collectors.
+func mergeCollectorRunStats(stats map[string]metric.InternalMetrics) {
+	collectorStats.Lock()
+	defer collectorStats.Unlock()
+	for name, run := range collectorStats.collectors {
+		m, exists := stats[name]
+		if !exists {
+			m = metric.InternalMetrics{Counters: map[string]float64{}, Gauges: map[string]float64{}}
+		}
+		run.mu.Lock()
+		m.Counters["fullerite.collector_error_logs"] = run.errorLogs
+		if lastEmission := atomic.LoadInt64(&run.lastEmission); lastEmission != 0 {
+			m.Gauges["fullerite.seconds_since_last_emission"] = time.Since(time.Unix(0, lastEmission)).Seconds()
+		}
+		if run.runs > 0 {
+			m.Counters["fullerite.collector_runs"] = run.runs
+			m.Counters["fullerite.collector_overruns"] = run.overruns
+			m.Gauges["fullerite.collector_points_per_run"] = run.lastRunPoints
+
+			durations := append([]float64{}, run.durations...)
+			sort.Float64s(durations)
+			m.Gauges["fullerite.collection_duration"] = run.lastDuration.Seconds()
+			m.Gauges["fullerite.collection_duration.p50"] = metric.Percentile(durations, 50)
+			m.Gauges["fullerite.collection_duration.p99"] = metric.Percentile(durations, 99)
+		}
+		run.mu.Unlock()
+		stats[name] = m
+	}
+}
+
 func emitCollectorStats(data map[string]uint64,
 	collectorStatChan chan<- metric.CollectorEmission) {
 	for collectorName, count := range data {
@@ -146,6 +498,7 @@ func emitCollectorStats(data map[string]uint64,
 
 func reportCollector(collector collector.Collector) {
 	log.Warn(fmt.Sprintf("%s collector took too long to run, reporting incident!", collector.Name()))
+	recordCollectorOverrun(collector.CanonicalName())
 	newMetric := metric.New("fullerite.collection_time_exceeded")
 	newMetric.MetricType = metric.Counter
 	newMetric.Value = 1
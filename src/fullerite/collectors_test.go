@@ -7,6 +7,7 @@ import (
 	"fullerite/metric"
 	"sync"
 
+	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -85,6 +86,15 @@ func TestStartCollectorsMixedConfig(t *testing.T) {
 	}
 }
 
+func TestPythonDiamondCollectors(t *testing.T) {
+	conf := config.Config{
+		DiamondCollectors:       []string{"CPUCollector", "PingCollector", "CPUCollector other"},
+		NativeDiamondCollectors: []string{"CPUCollector"},
+	}
+
+	assert.Equal(t, []string{"PingCollector", "CPUCollector other"}, pythonDiamondCollectors(conf))
+}
+
 func TestStartCollectorTooLong(t *testing.T) {
 	logrus.SetLevel(logrus.ErrorLevel)
 	c := make(map[string]interface{})
@@ -207,3 +217,172 @@ func TestCollectorBlacklist(t *testing.T) {
 
 	assert.Equal(t, uint64(1), collectorMetrics["Test"])
 }
+
+func TestMergeCollectorInternalMetrics(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	stats := map[string]metric.InternalMetrics{
+		"Diamond": {
+			Counters: map[string]float64{"fullerite.collector_datapoints": 5},
+			Gauges:   map[string]float64{},
+		},
+	}
+	collectors := []collector.Collector{collector.New("Test"), collector.New("Diamond")}
+
+	mergeCollectorInternalMetrics(stats, collectors)
+
+	assert.Equal(t, 5.0, stats["Diamond"].Counters["fullerite.collector_datapoints"])
+	assert.Equal(t, float64(collector.DefaultDiamondQueueSize), stats["Diamond"].Gauges["fullerite.diamond_queue_capacity"])
+	assert.Contains(t, stats, "Diamond closed connections")
+	assert.NotContains(t, stats, "Test")
+}
+
+func TestMergeCollectorRunStats(t *testing.T) {
+	resetCollectorStats()
+	name := "Test run stats"
+	run := collectorRunStatsFor(name)
+	run.recordEmission()
+	run.recordEmission()
+	recordCollectorRun(name, 2*time.Second)
+	for i := 0; i < 3; i++ {
+		run.recordEmission()
+	}
+	recordCollectorRun(name, time.Second)
+	recordCollectorOverrun(name)
+	recordCollectorErrorLog(name)
+	collectorRunStatsFor("Test python collector").recordEmission()
+
+	stats := map[string]metric.InternalMetrics{
+		name: {
+			Counters: map[string]float64{"fullerite.collector_datapoints": 5},
+			Gauges:   map[string]float64{},
+		},
+	}
+	mergeCollectorRunStats(stats)
+
+	assert.Equal(t, map[string]float64{
+		"fullerite.collector_datapoints": 5,
+		"fullerite.collector_runs":       2,
+		"fullerite.collector_overruns":   1,
+		"fullerite.collector_error_logs": 1,
+	}, stats[name].Counters)
+	gauges := stats[name].Gauges
+	assert.Equal(t, 1.0, gauges["fullerite.collection_duration"])
+	assert.Equal(t, 1.0, gauges["fullerite.collection_duration.p50"])
+	assert.Equal(t, 2.0, gauges["fullerite.collection_duration.p99"])
+	assert.Equal(t, 3.0, gauges["fullerite.collector_points_per_run"])
+	assert.InDelta(t, 0, gauges["fullerite.seconds_since_last_emission"], 1)
+
+	assert.NotContains(t, stats["Test python collector"].Counters, "fullerite.collector_runs")
+	assert.Contains(t, stats["Test python collector"].Gauges, "fullerite.seconds_since_last_emission")
+}
+
+func TestCollectorRunDurationWindow(t *testing.T) {
+	resetCollectorStats()
+	name := "Test run duration window"
+	recordCollectorRun(name, time.Hour)
+	for i := 0; i < collectorDurationWindow; i++ {
+		recordCollectorRun(name, time.Second)
+	}
+
+	stats := map[string]metric.InternalMetrics{}
+	mergeCollectorRunStats(stats)
+
+	assert.Equal(t, 1.0, stats[name].Gauges["fullerite.collection_duration.p99"])
+	assert.Equal(t, float64(collectorDurationWindow+1), stats[name].Counters["fullerite.collector_runs"])
+}
+
+func TestCollectorCardinalityLimit(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	c := make(map[string]interface{})
+	c["interval"] = 1
+	c["cardinalityLimit"] = 1
+	col := collector.New("Test")
+	col.SetInterval(1)
+	col.Configure(c)
+
+	collectorChannel := map[string]handler.CollectorEnd{
+		"Test": handler.CollectorEnd{Channel: make(chan metric.Metric), BufferSize: 1},
+	}
+	testHandler := handler.New("Log")
+	testHandler.SetCollectorEndpoints(collectorChannel)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		col.Channel() <- metric.New("m1")
+		col.Channel() <- metric.New("m2")
+		time.Sleep(1100 * time.Millisecond)
+		col.Channel() <- metric.New("m1")
+		close(col.Channel())
+	}()
+	received := []metric.Metric{}
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			received = append(received, <-collectorChannel["Test"].Channel)
+		}
+	}()
+	readFromCollector(col, []handler.Handler{testHandler})
+	wg.Wait()
+
+	assert.Equal(t, "m1", received[0].Name)
+	assert.Equal(t, metric.CardinalityExceeded, received[1].Name)
+	assert.Equal(t, 1.0, received[1].Value)
+	assert.Equal(t, "Test", received[1].Dimensions["collector"])
+	assert.Equal(t, "m1", received[2].Name)
+
+	stats := map[string]metric.InternalMetrics{}
+	mergeCollectorCardinality(stats)
+	assert.Equal(t, 1.0, stats["Test"].Gauges["fullerite.unique_series"])
+	assert.Equal(t, 1.0, stats["Test"].Gauges["fullerite.unique_series_limit"])
+}
+
+func TestCollectorAggregation(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	c := make(map[string]interface{})
+	c["interval"] = 1
+	c["aggregation"] = map[string]interface{}{
+		"groupBy": []interface{}{"collector"},
+		"stats":   []interface{}{"max"},
+	}
+	col := collector.New("Test")
+	col.SetInterval(1)
+	col.Configure(c)
+
+	collectorChannel := map[string]handler.CollectorEnd{
+		"Test": handler.CollectorEnd{Channel: make(chan metric.Metric), BufferSize: 1},
+	}
+	testHandler := handler.New("Log")
+	testHandler.SetCollectorEndpoints(collectorChannel)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for _, value := range []float64{4, 8} {
+			m := metric.WithValue("uwsgi.busy", value)
+			m.AddDimension("worker", fmt.Sprint(value))
+			col.Channel() <- m
+		}
+		close(col.Channel())
+	}()
+	var received metric.Metric
+	go func() {
+		defer wg.Done()
+		received = <-collectorChannel["Test"].Channel
+	}()
+	readFromCollector(col, []handler.Handler{testHandler})
+	wg.Wait()
+
+	assert.Equal(t, "uwsgi.busy.max", received.Name)
+	assert.Equal(t, 8.0, received.Value)
+	assert.Equal(t, map[string]string{"collector": "Test"}, received.Dimensions)
+}
+
+// resetCollectorStats forgets the runtime stats the other tests recorded
+func resetCollectorStats() {
+	collectorStats.Lock()
+	defer collectorStats.Unlock()
+	collectorStats.collectors = map[string]*collectorRunStats{}
+}
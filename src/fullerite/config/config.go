@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -14,59 +16,118 @@ var log = logrus.WithFields(logrus.Fields{"app": "fullerite", "pkg": "config"})
 
 // Config type holds the global Fullerite configuration.
 type Config struct {
-	Prefix                string                            `json:"prefix"`
-	Interval              interface{}                       `json:"interval"`
-	CollectorsConfigPath  string                            `json:"collectorsConfigPath"`
-	DiamondCollectorsPath string                            `json:"diamondCollectorsPath"`
-	DiamondCollectors     []string                          `json:"diamondCollectors"`
-	Handlers              map[string]map[string]interface{} `json:"handlers"`
-	Collectors            []string                          `json:"collectors"`
-	DefaultDimensions     map[string]string                 `json:"defaultDimensions"`
-	InternalServerConfig  map[string]interface{}            `json:"internalServer"`
+	Prefix                  string                            `json:"prefix"`
+	Interval                interface{}                       `json:"interval"`
+	CollectorsConfigPath    string                            `json:"collectorsConfigPath"`
+	DiamondCollectorsPath   string                            `json:"diamondCollectorsPath"`
+	DiamondCollectors       []string                          `json:"diamondCollectors"`
+	NativeDiamondCollectors []string                          `json:"nativeDiamondCollectors"`
+	Handlers                map[string]map[string]interface{} `json:"handlers"`
+	Collectors              []string                          `json:"collectors"`
+	DefaultDimensions       map[string]string                 `json:"defaultDimensions"`
+	InternalServerConfig    map[string]interface{}            `json:"internalServer"`
+	Routes                  []Route                           `json:"routes"`
+
+	// File is where the configuration was read from
+	File string `json:"-"`
+
+	// resolved is the JSON of the configuration, when File isn't that
+	resolved []byte
 }
 
-// ReadConfig reads a fullerite configuration file
+// Route sends the metrics matching it to Handlers, named as in the
+// handlers configuration, instead of every handler listening to their
+// collector. Name and the dimension values are regular expressions.
+type Route struct {
+	Name       string            `json:"name"`
+	Dimensions map[string]string `json:"dimensions"`
+	Handlers   []string          `json:"handlers"`
+}
+
+// ReadConfig reads a fullerite configuration file, see readConfigFile
+// for the formats, includes and environment variables it supports
 func ReadConfig(configFile string) (c Config, e error) {
 	log.Info("Reading configuration file at ", configFile)
-	contents, e := ioutil.ReadFile(configFile)
+	contents, plain, e := readConfigFile(configFile)
 	if e != nil {
 		log.Error("Config file error: ", e)
 		return c, e
 	}
-	err := json.Unmarshal(contents, &c)
+	resolved, e := json.Marshal(contents)
+	if e != nil {
+		log.Error("Invalid config: ", e)
+		return c, e
+	}
+	err := json.Unmarshal(resolved, &c)
 	if err != nil {
-		log.Error("Invalid JSON in config: ", err)
+		log.Error("Invalid config: ", err)
 		return c, err
 	}
+	c.File = configFile
+	if !plain {
+		c.resolved = resolved
+	}
 	return c, nil
 }
 
-// ReadCollectorConfig reads a fullerite collector configuration file
+// ReadCollectorConfig reads a fullerite collector configuration file,
+// like ReadConfig
 func ReadCollectorConfig(configFile string) (c map[string]interface{}, e error) {
 	log.Info("Reading collector configuration file at ", configFile)
-	contents, e := ioutil.ReadFile(configFile)
+	c, _, e = readConfigFile(configFile)
 	if e != nil {
 		log.Error("Config file error: ", e)
 		return c, e
 	}
-	err := json.Unmarshal(contents, &c)
-	if err != nil {
-		log.Error("Invalid JSON in config: ", err)
-		return c, err
-	}
 	return c, nil
 }
 
 // GetCollectorConfig returns collector config. given a name
 func (conf Config) GetCollectorConfig(name string) (map[string]interface{}, error) {
-	configFile := strings.Join([]string{conf.CollectorsConfigPath, name}, "/") + ".conf"
+	collectorConf, err := ReadCollectorConfig(conf.CollectorConfigFile(name))
+	return collectorConf, err
+}
+
+// CollectorConfigFile returns the configuration file of a collector:
+// <collectorsConfigPath>/<name>.conf or, when there is none, the file with
+// the .json, .yaml, .yml or .toml extension
+func (conf Config) CollectorConfigFile(name string) string {
+	configFile := strings.Join([]string{conf.CollectorsConfigPath, name}, "/")
 	// Since collector naems can be defined with a space in order to instantiate multiple
 	// instances of the same collector, we want their files
 	// will not have that space and needs to have it replaced with an underscore
 	// instead
 	configFile = strings.Replace(configFile, " ", "_", -1)
-	collectorConf, err := ReadCollectorConfig(configFile)
-	return collectorConf, err
+	return findCollectorConfig(configFile)
+}
+
+// JSONFile returns the path of a JSON file with the configuration, for
+// the Python Diamond server, and a function removing it: File itself when
+// it is plain JSON, else a copy of the resolved configuration, as it may
+// hold the secrets read from the environment, in a new directory only the
+// user can access.
+func (conf Config) JSONFile() (string, func(), error) {
+	if conf.resolved == nil {
+		return conf.File, func() {}, nil
+	}
+	dir, err := ioutil.TempDir("", "fullerite")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { os.RemoveAll(dir) }
+
+	name := strings.TrimSuffix(filepath.Base(conf.File), filepath.Ext(conf.File))
+	f, err := ioutil.TempFile(dir, name+"-")
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(conf.resolved); err != nil {
+		remove()
+		return "", nil, err
+	}
+	return f.Name(), remove, nil
 }
 
 // GetAsFloat parses a string to a float or returns the float if float is passed in
@@ -44,7 +44,11 @@ var testGoodConfiguration = `{
             "timeout": 2,
 			"collectorBlackList": ["TestCollector1", "TestCollector2"]
         }
-    }
+    },
+
+    "routes": [
+        {"dimensions": {"service": "^payments$"}, "handlers": ["Graphite"]}
+    ]
 }
 `
 
@@ -164,8 +168,12 @@ func TestParseCollectorConfig(t *testing.T) {
 }
 
 func TestParseGoodConfig(t *testing.T) {
-	_, err := config.ReadConfig(tmpTestGoodFile)
+	c, err := config.ReadConfig(tmpTestGoodFile)
 	assert.Nil(t, err, "should succeed")
+	assert.Equal(t, tmpTestGoodFile, c.File, "should remember where it was read from")
+	assert.Equal(t, []config.Route{
+		{Dimensions: map[string]string{"service": "^payments$"}, Handlers: []string{"Graphite"}},
+	}, c.Routes)
 }
 
 func TestParseBadConfig(t *testing.T) {
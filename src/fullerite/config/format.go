@@ -0,0 +1,253 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// includeKey lists the files merged into the configuration holding it
+const includeKey = "include"
+
+// configExtensions are the extensions of the files an included directory
+// is read for, and the ones a collector configuration is looked up with
+var configExtensions = []string{".conf", ".json", ".yaml", ".yml", ".toml"}
+
+// envReference matches ${VARIABLE} and ${VARIABLE:-default}
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// readConfigFile reads a configuration file in the format its extension
+// says: YAML for .yaml and .yml, TOML for .toml and JSON otherwise. The
+// ${VARIABLE} and ${VARIABLE:-default} in its strings are replaced by the
+// environment variables, the default being used when the variable is
+// unset or empty. The files, globs or directories listed under include,
+// relative to the file, are read the same way and merged into it in
+// order: their tables are merged with the file's, their lists appended
+// to the file's and their other values replace the file's. Directories
+// are read for their configuration files, in lexical order.
+//
+// plain is false when the contents aren't the JSON of the file as it is.
+func readConfigFile(configFile string) (contents map[string]interface{}, plain bool, err error) {
+	return readConfigFileFrom(configFile, map[string]bool{})
+}
+
+func readConfigFileFrom(configFile string, reading map[string]bool) (map[string]interface{}, bool, error) {
+	absolute, err := filepath.Abs(configFile)
+	if err != nil {
+		return nil, false, err
+	}
+	if reading[absolute] {
+		return nil, false, fmt.Errorf("%s includes itself", configFile)
+	}
+	reading[absolute] = true
+	defer delete(reading, absolute)
+
+	raw, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, false, err
+	}
+	contents, err := decodeConfig(configFile, raw)
+	if err != nil {
+		return nil, false, err
+	}
+	plain := configFormat(configFile) == "JSON"
+
+	interpolated, expanded := interpolateEnv(contents)
+	contents = interpolated.(map[string]interface{})
+	if expanded {
+		plain = false
+	}
+
+	include, exists := contents[includeKey]
+	if !exists {
+		return contents, plain, nil
+	}
+	delete(contents, includeKey)
+
+	var patterns []string
+	switch value := include.(type) {
+	case string:
+		patterns = []string{value}
+	case []interface{}:
+		for _, pattern := range value {
+			patterns = append(patterns, fmt.Sprint(pattern))
+		}
+	default:
+		return nil, false, fmt.Errorf("%s in %s should be a path or a list of paths", includeKey, configFile)
+	}
+
+	for _, pattern := range patterns {
+		files, err := includedFiles(filepath.Dir(configFile), pattern)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, file := range files {
+			log.Info("Including configuration file ", file)
+			included, _, err := readConfigFileFrom(file, reading)
+			if err != nil {
+				return nil, false, err
+			}
+			mergeConfig(contents, included)
+		}
+	}
+	return contents, false, nil
+}
+
+// configFormat returns the format of a configuration file after its extension
+func configFormat(configFile string) string {
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	case ".toml":
+		return "TOML"
+	default:
+		return "JSON"
+	}
+}
+
+func decodeConfig(configFile string, raw []byte) (map[string]interface{}, error) {
+	format := configFormat(configFile)
+	var err error
+	switch format {
+	case "YAML":
+		if raw, err = yaml.YAMLToJSON(raw); err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %s", format, configFile, err)
+		}
+	case "TOML":
+		contents, err := parseTOML(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %s", format, configFile, err)
+		}
+		return contents, nil
+	}
+
+	var contents map[string]interface{}
+	if err = json.Unmarshal(raw, &contents); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %s", format, configFile, err)
+	}
+	if contents == nil {
+		contents = map[string]interface{}{}
+	}
+	return contents, nil
+}
+
+// includedFiles returns the files an include pattern stands for
+func includedFiles(dir string, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return nil, fmt.Errorf("included file %s does not exist", pattern)
+	}
+
+	var files []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, match)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(match)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isConfigFile(entry.Name()) {
+				files = append(files, filepath.Join(match, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isConfigFile(name string) bool {
+	extension := strings.ToLower(filepath.Ext(name))
+	for _, configExtension := range configExtensions {
+		if extension == configExtension {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeConfig merges src into dst: tables are merged, lists appended and
+// any other value replaced
+func mergeConfig(dst, src map[string]interface{}) {
+	for key, value := range src {
+		switch srcValue := value.(type) {
+		case map[string]interface{}:
+			if dstValue, ok := dst[key].(map[string]interface{}); ok {
+				mergeConfig(dstValue, srcValue)
+				continue
+			}
+		case []interface{}:
+			if dstValue, ok := dst[key].([]interface{}); ok {
+				dst[key] = append(dstValue, srcValue...)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// interpolateEnv replaces the environment variable references in the
+// strings of a decoded configuration, and tells whether it found any
+func interpolateEnv(value interface{}) (interface{}, bool) {
+	expanded := false
+	switch v := value.(type) {
+	case string:
+		if !envReference.MatchString(v) {
+			return v, false
+		}
+		return envReference.ReplaceAllStringFunc(v, func(reference string) string {
+			match := envReference.FindStringSubmatch(reference)
+			if env := os.Getenv(match[1]); env != "" {
+				return env
+			}
+			if match[2] == "" {
+				log.Warn("Environment variable ", match[1], " referenced in the configuration is not set")
+			}
+			return match[3]
+		}), true
+	case map[string]interface{}:
+		for key, item := range v {
+			var itemExpanded bool
+			v[key], itemExpanded = interpolateEnv(item)
+			expanded = expanded || itemExpanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			var itemExpanded bool
+			v[i], itemExpanded = interpolateEnv(item)
+			expanded = expanded || itemExpanded
+		}
+	}
+	return value, expanded
+}
+
+// findCollectorConfig returns the configuration file of a collector, the
+// first of base with one of the configuration extensions which exists
+func findCollectorConfig(base string) string {
+	for _, extension := range configExtensions {
+		if _, err := os.Stat(base + extension); err == nil {
+			return base + extension
+		}
+	}
+	return base + configExtensions[0]
+}
@@ -0,0 +1,209 @@
+package config_test
+
+import (
+	"fullerite/config"
+
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestConfig(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestReadYAMLConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeTestConfig(t, dir, "fullerite.yaml", `
+# comments are fine
+prefix: test.
+interval: 10
+collectors: [Test]
+handlers:
+  Graphite:
+    server: 10.40.11.51
+    port: "2003"
+routes:
+  - dimensions: {service: ^payments$}
+    handlers: [Graphite]
+`)
+	c, err := config.ReadConfig(path)
+	require.Nil(t, err)
+	assert.Equal(t, "test.", c.Prefix)
+	assert.Equal(t, float64(10), c.Interval)
+	assert.Equal(t, []string{"Test"}, c.Collectors)
+	assert.Equal(t, "10.40.11.51", c.Handlers["Graphite"]["server"])
+	assert.Equal(t, []config.Route{
+		{Dimensions: map[string]string{"service": "^payments$"}, Handlers: []string{"Graphite"}},
+	}, c.Routes)
+
+	_, err = config.ReadConfig(writeTestConfig(t, dir, "bad.yml", "prefix: [unclosed"))
+	assert.NotNil(t, err)
+}
+
+func TestReadTOMLConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeTestConfig(t, dir, "fullerite.toml", `
+prefix = "test."
+interval = 10
+collectors = ["Test"]
+
+[handlers.SignalFx]
+authToken = "secret"
+timeout = 2
+`)
+	c, err := config.ReadConfig(path)
+	require.Nil(t, err)
+	assert.Equal(t, "test.", c.Prefix)
+	assert.Equal(t, []string{"Test"}, c.Collectors)
+	assert.Equal(t, map[string]interface{}{"authToken": "secret", "timeout": float64(2)}, c.Handlers["SignalFx"])
+
+	_, err = config.ReadConfig(writeTestConfig(t, dir, "bad.toml", "prefix = "))
+	assert.NotNil(t, err)
+}
+
+func TestReadConfigInterpolatesEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("FULLERITE_TEST_TOKEN", "secret")
+	defer os.Unsetenv("FULLERITE_TEST_TOKEN")
+	os.Setenv("FULLERITE_TEST_EMPTY", "")
+	defer os.Unsetenv("FULLERITE_TEST_EMPTY")
+
+	path := writeTestConfig(t, dir, "fullerite.conf", `{
+		"prefix": "${FULLERITE_TEST_EMPTY:-default.}",
+		"collectors": ["${FULLERITE_TEST_UNSET}Test"],
+		"handlers": {"SignalFx": {"authToken": "token-${FULLERITE_TEST_TOKEN}"}},
+		"routes": [{"name": "^nerve$", "handlers": ["SignalFx"]}]
+	}`)
+	c, err := config.ReadConfig(path)
+	require.Nil(t, err)
+	assert.Equal(t, "default.", c.Prefix)
+	assert.Equal(t, []string{"Test"}, c.Collectors)
+	assert.Equal(t, "token-secret", c.Handlers["SignalFx"]["authToken"])
+	assert.Equal(t, "^nerve$", c.Routes[0].Name)
+}
+
+func TestReadConfigIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestConfig(t, dir, "conf.d/10-graphite.yaml", `
+collectors: [ProcStatus]
+handlers:
+  Graphite: {server: graphite.local, port: 2003}
+`)
+	writeTestConfig(t, dir, "conf.d/20-override.toml", `
+interval = 30
+[handlers.Graphite]
+port = 2004
+`)
+	writeTestConfig(t, dir, "conf.d/README", "not a configuration")
+	writeTestConfig(t, dir, "extra.json", `{"defaultDimensions": {"env": "test"}}`)
+	path := writeTestConfig(t, dir, "fullerite.conf", `{
+		"include": ["conf.d", "extra.json"],
+		"prefix": "test.",
+		"interval": 10,
+		"collectors": ["Test"]
+	}`)
+
+	c, err := config.ReadConfig(path)
+	require.Nil(t, err)
+	assert.Equal(t, "test.", c.Prefix)
+	assert.Equal(t, float64(30), c.Interval)
+	assert.Equal(t, []string{"Test", "ProcStatus"}, c.Collectors)
+	assert.Equal(t, map[string]interface{}{"server": "graphite.local", "port": float64(2004)}, c.Handlers["Graphite"])
+	assert.Equal(t, map[string]string{"env": "test"}, c.DefaultDimensions)
+
+	writeTestConfig(t, dir, "missing.conf", `{"include": "nowhere.conf"}`)
+	_, err = config.ReadConfig(filepath.Join(dir, "missing.conf"))
+	assert.NotNil(t, err)
+
+	writeTestConfig(t, dir, "loop.conf", `{"include": "loop.conf"}`)
+	_, err = config.ReadConfig(filepath.Join(dir, "loop.conf"))
+	assert.NotNil(t, err)
+}
+
+func TestGetCollectorConfigFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestConfig(t, dir, "Test.conf", `{"interval": 10}`)
+	writeTestConfig(t, dir, "Other_instance.yaml", "interval: 20")
+	writeTestConfig(t, dir, "Other.toml", "interval = 30")
+	c := config.Config{CollectorsConfigPath: dir}
+
+	conf, err := c.GetCollectorConfig("Test")
+	require.Nil(t, err)
+	assert.Equal(t, float64(10), conf["interval"])
+
+	conf, err = c.GetCollectorConfig("Other instance")
+	require.Nil(t, err)
+	assert.Equal(t, float64(20), conf["interval"])
+
+	conf, err = c.GetCollectorConfig("Other")
+	require.Nil(t, err)
+	assert.Equal(t, float64(30), conf["interval"])
+
+	_, err = c.GetCollectorConfig("Missing")
+	assert.NotNil(t, err)
+}
+
+func TestJSONFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	plain := writeTestConfig(t, dir, "plain.conf", `{"prefix": "test."}`)
+	c, err := config.ReadConfig(plain)
+	require.Nil(t, err)
+	jsonFile, remove, err := c.JSONFile()
+	assert.Nil(t, err)
+	assert.Equal(t, plain, jsonFile)
+	remove()
+	assert.True(t, fileExists(plain), "the configuration itself is never removed")
+
+	c, err = config.ReadConfig(writeTestConfig(t, dir, "resolved.yaml", "prefix: test.\ninterval: 10"))
+	require.Nil(t, err)
+	jsonFile, remove, err = c.JSONFile()
+	require.Nil(t, err)
+	defer remove()
+
+	info, err := os.Stat(jsonFile)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Stat(filepath.Dir(jsonFile))
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	contents, err := ioutil.ReadFile(jsonFile)
+	require.Nil(t, err)
+	var resolved map[string]interface{}
+	require.Nil(t, json.Unmarshal(contents, &resolved))
+	assert.Equal(t, map[string]interface{}{"prefix": "test.", "interval": float64(10)}, resolved)
+
+	remove()
+	assert.False(t, fileExists(filepath.Dir(jsonFile)))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
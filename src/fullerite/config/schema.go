@@ -0,0 +1,276 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldType is the type of value a configuration key takes, as read by
+// the GetAs helpers: numbers and booleans may also be given as strings.
+type FieldType string
+
+// The types of configuration values
+const (
+	// String is a string, and only a string
+	String FieldType = "string"
+	// Int is a whole number, or a string holding one
+	Int FieldType = "int"
+	// Float is a number, or a string holding one
+	Float FieldType = "float"
+	// Bool is a boolean, or a string holding one
+	Bool FieldType = "bool"
+	// Scalar is a string or a number, e.g. a port
+	Scalar FieldType = "string or number"
+	// StringList is a list of strings, or a string holding its JSON
+	StringList FieldType = "list of strings"
+	// StringOrList is a string or a list of strings
+	StringOrList FieldType = "string or list of strings"
+	// List is a list of anything
+	List FieldType = "list"
+	// StringMap is a map of strings, or a string holding its JSON
+	StringMap FieldType = "map of strings"
+	// Map is a map of anything
+	Map FieldType = "map"
+	// Any is anything
+	Any FieldType = "any"
+)
+
+// Field declares a configuration key of a collector or handler. The
+// values of Secret fields may reference secrets, see Secret, and are never
+// quoted in problems.
+type Field struct {
+	Key         string
+	Type        FieldType
+	Default     interface{}
+	Required    bool
+	Choices     []string
+	Secret      bool
+	Description string
+}
+
+// Schema declares the configuration keys of a collector or handler
+type Schema []Field
+
+// Problem is something wrong with a configuration. Warnings, such as
+// unknown keys, don't stop fullerite from running.
+type Problem struct {
+	File    string
+	Key     string
+	Message string
+	Warning bool
+}
+
+func (p Problem) String() string {
+	severity := "error"
+	if p.Warning {
+		severity = "warning"
+	}
+	location := p.File
+	if p.Key != "" {
+		if location != "" {
+			location += ": "
+		}
+		location += p.Key
+	}
+	if location == "" {
+		return fmt.Sprintf("%s: %s", severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, severity, p.Message)
+}
+
+// Field returns the field declaring a key. A field whose key ends with
+// * declares all the keys starting with what is before it.
+func (s Schema) Field(key string) (Field, bool) {
+	for _, field := range s {
+		if field.Key == key {
+			return field, true
+		}
+		if strings.HasSuffix(field.Key, "*") && strings.HasPrefix(key, strings.TrimSuffix(field.Key, "*")) {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// Validate returns the problems of a configuration: missing required
+// keys, values of the wrong type or not among the choices, and keys the
+// schema doesn't declare, which are only warnings.
+func (s Schema) Validate(configMap map[string]interface{}) []Problem {
+	problems := []Problem{}
+	for _, field := range s {
+		if _, exists := configMap[field.Key]; field.Required && !exists {
+			problems = append(problems, Problem{Key: field.Key, Message: "is required"})
+		}
+	}
+
+	keys := make([]string, 0, len(configMap))
+	for key := range configMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := configMap[key]
+		field, declared := s.Field(key)
+		switch {
+		case !declared:
+			problems = append(problems, Problem{Key: key, Message: "unknown key", Warning: true})
+		case !field.Type.accepts(value):
+			message := "should be a " + string(field.Type)
+			if !field.Secret {
+				message += ", not " + describeValue(value)
+			}
+			problems = append(problems, Problem{Key: key, Message: message})
+		case len(field.Choices) > 0 && !inChoices(fmt.Sprint(value), field.Choices):
+			problems = append(problems, Problem{
+				Key:     key,
+				Message: fmt.Sprintf("should be one of %s, not %s", strings.Join(field.Choices, ", "), describeValue(value)),
+			})
+		}
+	}
+	return problems
+}
+
+// Redact returns a copy of a configuration where the values of the Secret
+// fields are replaced by <redacted>, unless they reference a secret
+func (s Schema) Redact(configMap map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(configMap))
+	for key, value := range configMap {
+		if field, declared := s.Field(key); declared && field.Secret {
+			value = redactValue(value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if IsSecretReference(v) {
+			return v
+		}
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = redactValue(item)
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = redactValue(item)
+		}
+		return redacted
+	}
+	return "<redacted>"
+}
+
+func inChoices(value string, choices []string) bool {
+	for _, choice := range choices {
+		if value == choice {
+			return true
+		}
+	}
+	return false
+}
+
+// describeValue returns a value as it would be written in JSON
+func describeValue(value interface{}) string {
+	if asJSON, err := json.Marshal(value); err == nil {
+		return string(asJSON)
+	}
+	return fmt.Sprint(value)
+}
+
+func (t FieldType) accepts(value interface{}) bool {
+	switch t {
+	case String:
+		_, ok := value.(string)
+		return ok
+	case Int:
+		switch v := value.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			return v == float64(int64(v))
+		case string:
+			_, err := strconv.ParseInt(v, 10, 64)
+			return err == nil
+		}
+	case Float:
+		switch v := value.(type) {
+		case int, int32, int64, float64:
+			return true
+		case string:
+			_, err := strconv.ParseFloat(v, 64)
+			return err == nil
+		}
+	case Bool:
+		switch v := value.(type) {
+		case bool:
+			return true
+		case string:
+			_, err := strconv.ParseBool(v)
+			return err == nil
+		}
+	case Scalar:
+		switch value.(type) {
+		case string, int, int32, int64, float64:
+			return true
+		}
+	case StringList:
+		if v, ok := value.(string); ok {
+			var list []string
+			return json.Unmarshal([]byte(v), &list) == nil
+		}
+		return isStringList(value)
+	case StringOrList:
+		if _, ok := value.(string); ok {
+			return true
+		}
+		return isStringList(value)
+	case List:
+		_, ok := value.([]interface{})
+		return ok
+	case StringMap:
+		switch v := value.(type) {
+		case string:
+			var m map[string]string
+			return json.Unmarshal([]byte(v), &m) == nil
+		case map[string]string:
+			return true
+		case map[string]interface{}:
+			for _, item := range v {
+				if _, ok := item.(string); !ok {
+					return false
+				}
+			}
+			return true
+		}
+	case Map:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case Any:
+		return true
+	}
+	return false
+}
+
+func isStringList(value interface{}) bool {
+	switch v := value.(type) {
+	case []string:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
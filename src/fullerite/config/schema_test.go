@@ -0,0 +1,118 @@
+package config_test
+
+import (
+	"fullerite/config"
+
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchema = config.Schema{
+	{Key: "server", Type: config.String, Required: true},
+	{Key: "port", Type: config.Scalar},
+	{Key: "count", Type: config.Int},
+	{Key: "ratio", Type: config.Float},
+	{Key: "enabled", Type: config.Bool},
+	{Key: "names", Type: config.StringList},
+	{Key: "dimensions", Type: config.StringMap},
+	{Key: "mode", Type: config.String, Choices: []string{"fast", "slow"}},
+	{Key: "extra_*", Type: config.Any},
+}
+
+func TestSchemaValidateAcceptsValidConfig(t *testing.T) {
+	problems := testSchema.Validate(map[string]interface{}{
+		"server":     "example.com",
+		"port":       2003.0,
+		"count":      "10",
+		"ratio":      0.5,
+		"enabled":    "true",
+		"names":      `["a", "b"]`,
+		"dimensions": map[string]interface{}{"env": "prod"},
+		"mode":       "fast",
+		"extra_key":  []interface{}{1},
+	})
+
+	assert.Empty(t, problems)
+}
+
+func TestSchemaValidateRequired(t *testing.T) {
+	problems := testSchema.Validate(map[string]interface{}{})
+
+	assert.Equal(t, []config.Problem{{Key: "server", Message: "is required"}}, problems)
+}
+
+func TestSchemaValidateTypes(t *testing.T) {
+	problems := testSchema.Validate(map[string]interface{}{
+		"server":     "example.com",
+		"count":      1.5,
+		"enabled":    "maybe",
+		"names":      []interface{}{"a", 1.0},
+		"dimensions": map[string]interface{}{"env": 1.0},
+	})
+
+	assert.Equal(t, []config.Problem{
+		{Key: "count", Message: "should be a int, not 1.5"},
+		{Key: "dimensions", Message: `should be a map of strings, not {"env":1}`},
+		{Key: "enabled", Message: `should be a bool, not "maybe"`},
+		{Key: "names", Message: `should be a list of strings, not ["a",1]`},
+	}, problems)
+}
+
+func TestSchemaValidateChoices(t *testing.T) {
+	problems := testSchema.Validate(map[string]interface{}{"server": "example.com", "mode": "medium"})
+
+	assert.Equal(t, []config.Problem{{Key: "mode", Message: `should be one of fast, slow, not "medium"`}}, problems)
+}
+
+func TestSchemaValidateUnknownKeysAreWarnings(t *testing.T) {
+	problems := testSchema.Validate(map[string]interface{}{"server": "example.com", "sever": "typo"})
+
+	assert.Equal(t, []config.Problem{{Key: "sever", Message: "unknown key", Warning: true}}, problems)
+}
+
+func TestSchemaFieldWildcard(t *testing.T) {
+	field, declared := testSchema.Field("extra_anything")
+	assert.True(t, declared)
+	assert.Equal(t, "extra_*", field.Key)
+
+	_, declared = testSchema.Field("extra")
+	assert.False(t, declared)
+}
+
+func TestProblemString(t *testing.T) {
+	assert.Equal(t, "a.json: port: error: is required", config.Problem{File: "a.json", Key: "port", Message: "is required"}.String())
+	assert.Equal(t, "port: warning: unknown key", config.Problem{Key: "port", Message: "unknown key", Warning: true}.String())
+	assert.Equal(t, "a.json: error: bad", config.Problem{File: "a.json", Message: "bad"}.String())
+	assert.Equal(t, "error: bad", config.Problem{Message: "bad"}.String())
+}
+
+func TestSchemaValidateDoesNotQuoteSecrets(t *testing.T) {
+	schema := config.Schema{{Key: "tokens", Type: config.StringMap, Secret: true}}
+
+	problems := schema.Validate(map[string]interface{}{"tokens": map[string]interface{}{"a": "s3cr3t", "b": 1.0}})
+
+	assert.Equal(t, []config.Problem{{Key: "tokens", Message: "should be a map of strings"}}, problems)
+}
+
+func TestSchemaRedact(t *testing.T) {
+	schema := config.Schema{
+		{Key: "token", Type: config.String, Secret: true},
+		{Key: "tokens", Type: config.StringMap, Secret: true},
+		{Key: "server", Type: config.String},
+	}
+	configMap := map[string]interface{}{
+		"token":  "s3cr3t",
+		"tokens": map[string]interface{}{"a": "s3cr3t", "b": "file:/etc/fullerite/b"},
+		"server": "example.com",
+		"other":  "value",
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"token":  "<redacted>",
+		"tokens": map[string]interface{}{"a": "<redacted>", "b": "file:/etc/fullerite/b"},
+		"server": "example.com",
+		"other":  "value",
+	}, schema.Redact(configMap))
+	assert.Equal(t, "s3cr3t", configMap["token"], "the configuration is left as it is")
+}
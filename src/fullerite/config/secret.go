@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// secretFilePrefix marks a secret read from a file: file:/path
+	secretFilePrefix = "file:"
+	// secretExecPrefix marks a secret printed by a command: exec:/path args
+	secretExecPrefix = "exec:"
+
+	// DefaultSecretTTL is how long a secret read from a file or a command
+	// is used before it is read again
+	DefaultSecretTTL = 5 * time.Minute
+
+	// secretExecTimeout is how long a command printing a secret may run
+	secretExecTimeout = 10 * time.Second
+)
+
+// Secret is a configuration value such as a token or a password. It is
+// either the value itself, file:/path for the contents of a file or
+// exec:/path/to/helper args for what a command prints on its standard
+// output, the command being run without a shell. Both are trimmed of
+// surrounding whitespace and read again once their TTL has passed, so
+// secrets can be rotated without restarting fullerite.
+//
+// A Secret prints as its reference, or as <redacted> when it holds the
+// value itself, so that it can't be logged by mistake.
+type Secret struct {
+	reference string
+	ttl       time.Duration
+
+	mu     sync.Mutex
+	value  string
+	readAt time.Time
+	// read is replaced in tests
+	read func(reference string) (string, error)
+}
+
+// NewSecret returns the secret a configuration value holds or references,
+// read again every ttl when it is referenced
+func NewSecret(reference string, ttl time.Duration) *Secret {
+	if ttl <= 0 {
+		ttl = DefaultSecretTTL
+	}
+	return &Secret{reference: reference, ttl: ttl, read: readSecret}
+}
+
+// IsSecretReference tells whether a configuration value references a
+// secret rather than holds it
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, secretFilePrefix) || strings.HasPrefix(value, secretExecPrefix)
+}
+
+// GetAsSecret returns the secret a configuration value holds or references,
+// or nil when the value isn't a string
+func GetAsSecret(value interface{}, ttl time.Duration) *Secret {
+	asString, ok := value.(string)
+	if !ok {
+		log.Warn("Expected a string secret but got ", reflect.TypeOf(value))
+		return nil
+	}
+	return NewSecret(asString, ttl)
+}
+
+// GetAsSecretMap returns the secrets a map of configuration values holds or
+// references. Unlike GetAsMap, it never logs the values.
+func GetAsSecretMap(value interface{}, ttl time.Duration) map[string]*Secret {
+	result := make(map[string]*Secret)
+
+	var values map[string]interface{}
+	switch realValue := value.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(realValue), &values); err != nil {
+			log.Warn("Failed to read a map of secrets from a string")
+		}
+	case map[string]interface{}:
+		values = realValue
+	case map[string]string:
+		for k, v := range realValue {
+			result[k] = NewSecret(v, ttl)
+		}
+	default:
+		log.Warn("Expected a map of secrets but got ", reflect.TypeOf(value))
+	}
+
+	for k, v := range values {
+		if secret := GetAsSecret(v, ttl); secret != nil {
+			result[k] = secret
+		}
+	}
+	return result
+}
+
+// Value returns the secret, reading it when it is referenced and its TTL
+// has passed. When reading it again fails, the last value read is kept
+// along with the error.
+func (s *Secret) Value() (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	if !IsSecretReference(s.reference) {
+		return s.reference, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.readAt.IsZero() && time.Since(s.readAt) < s.ttl {
+		return s.value, nil
+	}
+
+	value, err := s.read(s.reference)
+	if err != nil {
+		return s.value, fmt.Errorf("failed to read secret %s: %s", s.reference, err)
+	}
+	if !s.readAt.IsZero() && value != s.value {
+		log.Info("Secret ", s.reference, " was rotated")
+	}
+	s.value = value
+	s.readAt = time.Now()
+	return s.value, nil
+}
+
+// String returns the reference of the secret, never the secret itself
+func (s *Secret) String() string {
+	if s == nil || s.reference == "" {
+		return ""
+	}
+	if IsSecretReference(s.reference) {
+		return s.reference
+	}
+	return "<redacted>"
+}
+
+// readSecret reads a secret referenced by file:/path or exec:/path args
+func readSecret(reference string) (string, error) {
+	if strings.HasPrefix(reference, secretFilePrefix) {
+		contents, err := ioutil.ReadFile(strings.TrimPrefix(reference, secretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(contents)), nil
+	}
+
+	args := strings.Fields(strings.TrimPrefix(reference, secretExecPrefix))
+	if len(args) == 0 {
+		return "", fmt.Errorf("no command given")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretExecTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
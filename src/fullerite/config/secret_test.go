@@ -0,0 +1,93 @@
+package config_test
+
+import (
+	"fullerite/config"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretLiteral(t *testing.T) {
+	secret := config.NewSecret("s3cr3t", 0)
+
+	value, err := secret.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+	assert.Equal(t, "<redacted>", secret.String())
+	assert.Equal(t, "<redacted>", fmt.Sprint(secret))
+}
+
+func TestSecretFromFileIsRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite-secret")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+	require.Nil(t, ioutil.WriteFile(path, []byte("first\n"), 0600))
+
+	secret := config.NewSecret("file:"+path, 50*time.Millisecond)
+	assert.Equal(t, "file:"+path, secret.String())
+
+	value, err := secret.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "first", value)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("second\n"), 0600))
+	value, _ = secret.Value()
+	assert.Equal(t, "first", value, "the secret is cached until its TTL passes")
+
+	time.Sleep(60 * time.Millisecond)
+	value, err = secret.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "second", value)
+
+	require.Nil(t, os.Remove(path))
+	time.Sleep(60 * time.Millisecond)
+	value, err = secret.Value()
+	assert.NotNil(t, err)
+	assert.Equal(t, "second", value, "the last value is kept when it can't be read again")
+}
+
+func TestSecretFromCommand(t *testing.T) {
+	secret := config.NewSecret("exec:echo  s3cr3t", 0)
+
+	value, err := secret.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cr3t", value)
+}
+
+func TestSecretFromFailingCommand(t *testing.T) {
+	secret := config.NewSecret("exec:sh -c exit-1", 0)
+
+	value, err := secret.Value()
+	assert.NotNil(t, err)
+	assert.Equal(t, "", value)
+	assert.Contains(t, err.Error(), "exec:sh -c exit-1")
+}
+
+func TestGetAsSecretMap(t *testing.T) {
+	secrets := config.GetAsSecretMap(`{"a": "literal", "b": "exec:echo b"}`, 0)
+	require.Len(t, secrets, 2)
+
+	a, _ := secrets["a"].Value()
+	b, _ := secrets["b"].Value()
+	assert.Equal(t, "literal", a)
+	assert.Equal(t, "b", b)
+
+	assert.Empty(t, config.GetAsSecretMap(12.0, 0))
+}
+
+func TestNilSecret(t *testing.T) {
+	var secret *config.Secret
+
+	value, err := secret.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "", value)
+	assert.Equal(t, "", secret.String())
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML decodes a TOML document into the same values encoding/json
+// decodes JSON into: maps, slices, strings, bools and float64 numbers, so
+// that configurations read the same whatever their format. Dates and
+// times are kept as RFC 3339 strings.
+func parseTOML(contents []byte) (map[string]interface{}, error) {
+	decoded := map[string]interface{}{}
+	if _, err := toml.Decode(string(contents), &decoded); err != nil {
+		return nil, err
+	}
+	return normalizeTOML(decoded).(map[string]interface{}), nil
+}
+
+func normalizeTOML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeTOML(item)
+		}
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeTOML(item)
+		}
+		return list
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeTOML(item)
+		}
+		return v
+	}
+	return value
+}
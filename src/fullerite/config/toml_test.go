@@ -0,0 +1,58 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTOML(t *testing.T) {
+	contents, err := parseTOML([]byte(`
+prefix = "test."
+interval = 10
+ratio = 0.5
+enabled = true
+since = 1979-05-27T07:32:00Z
+collectors = ["Test", "Other"]
+inline = {a = 1, b = "c"}
+
+[handlers.Graphite]
+server = "10.40.11.51"
+timeout = 2
+
+[[routes]]
+handlers = ["Graphite"]
+[routes.dimensions]
+service = "^payments$"
+
+[[routes]]
+name = "^nerve\\."
+`))
+	require.Nil(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"prefix":     "test.",
+		"interval":   float64(10),
+		"ratio":      0.5,
+		"enabled":    true,
+		"since":      "1979-05-27T07:32:00Z",
+		"collectors": []interface{}{"Test", "Other"},
+		"inline":     map[string]interface{}{"a": float64(1), "b": "c"},
+		"handlers": map[string]interface{}{
+			"Graphite": map[string]interface{}{"server": "10.40.11.51", "timeout": float64(2)},
+		},
+		"routes": []interface{}{
+			map[string]interface{}{
+				"handlers":   []interface{}{"Graphite"},
+				"dimensions": map[string]interface{}{"service": "^payments$"},
+			},
+			map[string]interface{}{"name": `^nerve\.`},
+		},
+	}, contents)
+}
+
+func TestParseTOMLError(t *testing.T) {
+	_, err := parseTOML([]byte("a = 1\na = 2"))
+	assert.NotNil(t, err)
+}
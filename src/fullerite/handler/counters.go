@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// How cumulative counters are converted before they are emitted
+const (
+	counterModeRaw   = "raw"
+	counterModeDelta = "delta"
+	counterModeRate  = "rate"
+
+	defaultCounterStateExpiry = 10 * time.Minute
+)
+
+// counterConverter turns cumulative counters into the difference with the
+// previous value of the same series, as a counter, or into that difference
+// per second since the previous value, as a gauge. It is enabled with
+// cumulativeCounterMode set to "delta" or "rate":
+//
+//	"cumulativeCounterMode": "rate",
+//	"counterStateExpiry": 600
+//
+// Series are keyed on their name and dimensions. The first value of a
+// series, and the first after nothing was received for counterStateExpiry
+// seconds, only sets its state. A value lower than the previous one is
+// either a 32 or 64 bit counter wrapping around or, when that would be a
+// huge jump, a counter reset, in which case the value itself is the delta.
+type counterConverter struct {
+	mode   string
+	expiry time.Duration
+
+	mu         sync.Mutex
+	state      map[string]counterSample
+	lastExpire time.Time
+}
+
+type counterSample struct {
+	value float64
+	seen  time.Time
+}
+
+// newCounterConverter returns a converter, or nil in raw mode
+func newCounterConverter(mode string, expiry time.Duration) (*counterConverter, error) {
+	switch mode {
+	case "", counterModeRaw:
+		return nil, nil
+	case counterModeDelta, counterModeRate:
+	default:
+		return nil, fmt.Errorf("unknown cumulativeCounterMode %q", mode)
+	}
+	if expiry <= 0 {
+		expiry = defaultCounterStateExpiry
+	}
+	return &counterConverter{
+		mode:   mode,
+		expiry: expiry,
+		state:  map[string]counterSample{},
+	}, nil
+}
+
+// convert returns the metric to emit in place of m, and false when
+// nothing should be emitted. Metrics that aren't cumulative counters are
+// returned as they are.
+func (c *counterConverter) convert(m metric.Metric, now time.Time) (metric.Metric, bool) {
+	if m.MetricType != metric.CumulativeCounter {
+		return m, true
+	}
+	key := m.SeriesKey()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+	previous, exists := c.state[key]
+	c.state[key] = counterSample{value: m.Value, seen: now}
+	if !exists || now.Sub(previous.seen) > c.expiry {
+		return m, false
+	}
+
+	delta := counterDelta(previous.value, m.Value)
+	if c.mode == counterModeRate {
+		elapsed := now.Sub(previous.seen).Seconds()
+		if elapsed <= 0 {
+			return m, false
+		}
+		m.Value = delta / elapsed
+		m.MetricType = metric.Gauge
+		return m, true
+	}
+	m.Value = delta
+	m.MetricType = metric.Counter
+	return m, true
+}
+
+// expire forgets the series not seen for longer than the expiry, looking
+// at them at most once per expiry
+func (c *counterConverter) expire(now time.Time) {
+	if now.Sub(c.lastExpire) < c.expiry {
+		return
+	}
+	c.lastExpire = now
+	for key, sample := range c.state {
+		if now.Sub(sample.seen) > c.expiry {
+			delete(c.state, key)
+		}
+	}
+}
+
+// series returns the number of series the converter keeps state for
+func (c *counterConverter) series() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.state)
+}
+
+// counterDelta returns how much a counter grew from previous to current
+func counterDelta(previous, current float64) float64 {
+	if current >= previous {
+		return current - previous
+	}
+	for _, limit := range []float64{math.MaxUint32, math.MaxUint64} {
+		if previous > limit {
+			continue
+		}
+		if wrapped := limit - previous + current + 1; wrapped < limit/2 {
+			return wrapped
+		}
+	}
+	return current
+}
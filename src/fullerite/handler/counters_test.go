@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cumCounter(value float64) metric.Metric {
+	m := metric.WithValue("requests", value)
+	m.MetricType = metric.CumulativeCounter
+	m.AddDimension("host", "a")
+	return m
+}
+
+func TestNewCounterConverter(t *testing.T) {
+	converter, err := newCounterConverter(counterModeRaw, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, converter)
+
+	converter, err = newCounterConverter(counterModeDelta, 0)
+	require.Nil(t, err)
+	assert.Equal(t, defaultCounterStateExpiry, converter.expiry)
+
+	_, err = newCounterConverter("derivative", 0)
+	assert.NotNil(t, err)
+}
+
+func TestCounterConverterDelta(t *testing.T) {
+	converter, _ := newCounterConverter(counterModeDelta, time.Minute)
+	now := time.Now()
+
+	_, ok := converter.convert(cumCounter(100), now)
+	assert.False(t, ok, "the first value only sets the state")
+
+	m, ok := converter.convert(cumCounter(150), now.Add(10*time.Second))
+	require.True(t, ok)
+	assert.Equal(t, 50.0, m.Value)
+	assert.Equal(t, metric.Counter, m.MetricType)
+	assert.Equal(t, "a", m.Dimensions["host"])
+
+	gauge := metric.WithValue("requests", 3)
+	m, ok = converter.convert(gauge, now)
+	assert.True(t, ok)
+	assert.Equal(t, gauge, m)
+	assert.Equal(t, 1, converter.series())
+}
+
+func TestCounterConverterRate(t *testing.T) {
+	converter, _ := newCounterConverter(counterModeRate, time.Minute)
+	now := time.Now()
+
+	converter.convert(cumCounter(100), now)
+	m, ok := converter.convert(cumCounter(150), now.Add(10*time.Second))
+	require.True(t, ok)
+	assert.Equal(t, 5.0, m.Value)
+	assert.Equal(t, metric.Gauge, m.MetricType)
+
+	_, ok = converter.convert(cumCounter(200), now.Add(10*time.Second))
+	assert.False(t, ok, "no rate without elapsed time")
+}
+
+func TestCounterConverterExpiry(t *testing.T) {
+	converter, _ := newCounterConverter(counterModeDelta, time.Minute)
+	now := time.Now()
+
+	converter.convert(cumCounter(100), now)
+	_, ok := converter.convert(cumCounter(150), now.Add(2*time.Minute))
+	assert.False(t, ok, "stale state starts over")
+
+	other := cumCounter(1)
+	other.Dimensions["host"] = "b"
+	converter.convert(other, now.Add(5*time.Minute))
+	assert.Equal(t, 1, converter.series(), "stale series are forgotten")
+}
+
+func TestCounterDelta(t *testing.T) {
+	assert.Equal(t, 10.0, counterDelta(5, 15))
+	assert.Equal(t, 7.0, counterDelta(1000, 7), "counter reset")
+	assert.Equal(t, 16.0, counterDelta(math.MaxUint32-5, 10), "32 bit wraparound")
+	assert.Equal(t, 3.0, counterDelta(1<<40, 3), "reset of a large counter")
+}
+
+func TestHandlerConvertsCumulativeCounters(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.configureCommonParams(map[string]interface{}{
+		"cumulativeCounterMode": "delta",
+		"counterStateExpiry":    "30",
+	})
+	require.NotNil(t, base.counters)
+	assert.Equal(t, 30*time.Second, base.counters.expiry)
+	assert.Equal(t, 0.0, base.InternalMetrics().Gauges["counterSeries"])
+
+	base = BaseHandler{log: defaultLog}
+	base.configureCommonParams(map[string]interface{}{"cumulativeCounterMode": "nope"})
+	assert.Nil(t, base.counters)
+}
+
+func TestHandlerRunRatesCumulativeCountersByTheirTime(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.interval = 1
+	base.maxBufferSize = 1
+	base.channel = make(chan metric.Metric)
+	base.configureCommonParams(map[string]interface{}{"cumulativeCounterMode": "rate"})
+
+	emitted := make(chan []metric.Metric, 1)
+	go base.run(func(metrics []metric.Metric) bool {
+		emitted <- metrics
+		return true
+	})
+
+	first := metric.WithValue("bytes", 100)
+	first.MetricType = metric.CumulativeCounter
+	first.Timestamp = time.Now().Add(-10 * time.Second)
+	second := first
+	second.Value = 150
+	second.Timestamp = first.Timestamp.Add(10 * time.Second)
+
+	base.channel <- first
+	base.channel <- second
+	select {
+	case metrics := <-emitted:
+		require.Equal(t, 1, len(metrics))
+		assert.Equal(t, 5.0, metrics[0].Value, "the rate is over the time between the samples")
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing emitted")
+	}
+	close(base.channel)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fullerite/config"
 	"fullerite/metric"
 
 	"bytes"
@@ -9,6 +10,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	l "github.com/Sirupsen/logrus"
@@ -16,13 +18,17 @@ import (
 
 func init() {
 	RegisterHandler("Datadog", newDatadog)
+	RegisterSchema("Datadog", config.Schema{
+		{Key: "apiKey", Type: config.String, Required: true, Secret: true, Description: "Datadog API key"},
+		{Key: "endpoint", Type: config.String, Required: true, Description: "Datadog series API URL"},
+	})
 }
 
 // Datadog handler
 type Datadog struct {
 	BaseHandler
 	endpoint string
-	apiKey   string
+	apiKey   *config.Secret
 }
 
 type datadogPayload struct {
@@ -55,13 +61,16 @@ func newDatadog(
 	inst.timeout = initialTimeout
 	inst.log = log
 	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return jsonPayload(inst.convertToDatadog(m))
+	}
 	return inst
 }
 
 // Configure the Datadog handler
 func (d *Datadog) Configure(configMap map[string]interface{}) {
 	if apiKey, exists := configMap["apiKey"]; exists {
-		d.apiKey = apiKey.(string)
+		d.apiKey = config.GetAsSecret(apiKey, secretTTL(configMap))
 	} else {
 		d.log.Error("There was no API key specified for the Datadog handler, there won't be any emissions")
 	}
@@ -123,7 +132,11 @@ func (d *Datadog) emitMetrics(metrics []metric.Metric) bool {
 		return false
 	}
 
-	apiURL := fmt.Sprintf("%s/series?api_key=%s", d.endpoint, d.apiKey)
+	apiKey, err := d.apiKey.Value()
+	if err != nil {
+		d.log.Error(err)
+	}
+	apiURL := fmt.Sprintf("%s/series?api_key=%s", d.endpoint, apiKey)
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(payload))
 	if err != nil {
 		d.log.Error("Failed to create a request to endpoint ", d.endpoint)
@@ -139,7 +152,11 @@ func (d *Datadog) emitMetrics(metrics []metric.Metric) bool {
 	}
 	rsp, err := client.Do(req)
 	if err != nil {
-		d.log.Error("Failed to complete POST ", err)
+		// the error would quote the URL, which holds the API key
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		d.log.Error("Failed to complete POST to ", d.endpoint, " ", err)
 		return false
 	}
 
@@ -169,6 +186,6 @@ func (d Datadog) serializedDimensions(m metric.Metric) (dimensions []string) {
 }
 
 func makeDatadogPoints(m metric.Metric) []datadogPoint {
-	point := datadogPoint{float64(time.Now().Unix()), m.Value}
+	point := datadogPoint{float64(m.Time().Unix()), m.Value}
 	return []datadogPoint{point}
 }
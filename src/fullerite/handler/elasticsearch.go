@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+	"fullerite/util"
+
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+func init() {
+	RegisterHandler("Elasticsearch", newElasticsearch)
+	RegisterSchema("Elasticsearch", config.Schema{
+		{Key: "endpoint", Type: config.String, Required: true, Description: "Elasticsearch URL"},
+		{Key: "index", Type: config.String, Default: defaultElasticsearchIndex, Description: "Name of the indices"},
+		{Key: "indexDateFormat", Type: config.String, Default: defaultElasticsearchDateFormat, Description: "Go time layout of the date appended to the index name, empty for none"},
+		{Key: "documentType", Type: config.String, Description: "Type of the documents, for Elasticsearch before 7"},
+		{Key: "username", Type: config.String, Secret: true, Description: "User of the basic authentication"},
+		{Key: "password", Type: config.String, Secret: true, Description: "Password of the basic authentication"},
+	})
+}
+
+const (
+	defaultElasticsearchIndex      = "fullerite"
+	defaultElasticsearchDateFormat = "2006.01.02"
+)
+
+// elasticsearchFields are the fields every document has, dimensions
+// with the same name are prefixed with dimension_
+var elasticsearchFields = []string{"name", "type", "value", "timestamp"}
+
+// Elasticsearch type indexes each metric as a document through the bulk
+// API. Documents go to the index named after the index and the day of
+// their timestamp formatted with indexDateFormat, a Go time layout, for
+// example fullerite-2017.07.14; an empty indexDateFormat uses index as
+// it is:
+//
+//	"Elasticsearch": {
+//		"endpoint": "http://localhost:9200",
+//		"index": "fullerite",
+//		"indexDateFormat": "2006.01.02",
+//		"documentType": "metric",
+//		"username": "fullerite",
+//		"password": "secret"
+//	}
+//
+// documentType only needs to be set for Elasticsearch before 7. Items
+// the bulk response reports as failed are counted as dropped.
+type Elasticsearch struct {
+	BaseHandler
+	endpoint        string
+	index           string
+	indexDateFormat string
+	documentType    string
+	username        *config.Secret
+	password        *config.Secret
+	httpClient      *util.HTTPAlive
+}
+
+type elasticsearchBulkAction struct {
+	Index elasticsearchBulkIndex `json:"index"`
+}
+
+type elasticsearchBulkIndex struct {
+	Index string `json:"_index"`
+	Type  string `json:"_type,omitempty"`
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool                                     `json:"errors"`
+	Items  []map[string]elasticsearchBulkItemResult `json:"items"`
+}
+
+type elasticsearchBulkItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// newElasticsearch returns a new Elasticsearch handler.
+func newElasticsearch(
+	channel chan metric.Metric,
+	initialInterval int,
+	initialBufferSize int,
+	initialTimeout time.Duration,
+	log *l.Entry) Handler {
+
+	inst := new(Elasticsearch)
+	inst.name = "Elasticsearch"
+
+	inst.interval = initialInterval
+	inst.maxBufferSize = initialBufferSize
+	inst.timeout = initialTimeout
+	inst.maxIdleConnectionsPerHost = DefaultMaxIdleConnectionsPerHost
+	inst.keepAliveInterval = DefaultKeepAliveInterval
+	inst.log = log
+	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return string(inst.bulkLines(m))
+	}
+
+	inst.index = defaultElasticsearchIndex
+	inst.indexDateFormat = defaultElasticsearchDateFormat
+
+	// Partial failures are reported by emitMetrics
+	inst.OverrideBaseEmissionMetricsReporter()
+
+	return inst
+}
+
+// Configure accepts the different configuration options for the Elasticsearch handler
+func (e *Elasticsearch) Configure(configMap map[string]interface{}) {
+	if endpoint, exists := configMap["endpoint"]; exists {
+		e.endpoint = strings.TrimRight(fmt.Sprint(endpoint), "/")
+	} else {
+		e.log.Error("There was no endpoint specified for the Elasticsearch Handler, there won't be any emissions")
+	}
+
+	if index, exists := configMap["index"]; exists {
+		e.index = fmt.Sprint(index)
+	}
+
+	if dateFormat, exists := configMap["indexDateFormat"]; exists {
+		e.indexDateFormat = fmt.Sprint(dateFormat)
+	}
+
+	if documentType, exists := configMap["documentType"]; exists {
+		e.documentType = fmt.Sprint(documentType)
+	}
+
+	if username, exists := configMap["username"]; exists {
+		e.username = config.GetAsSecret(username, secretTTL(configMap))
+	}
+
+	if password, exists := configMap["password"]; exists {
+		e.password = config.GetAsSecret(password, secretTTL(configMap))
+	}
+
+	e.configureCommonParams(configMap)
+}
+
+// Endpoint returns the Elasticsearch URL the bulk requests are sent to
+func (e Elasticsearch) Endpoint() string {
+	return e.endpoint
+}
+
+// Run runs the handler main loop
+func (e *Elasticsearch) Run() {
+	httpAliveClient := new(util.HTTPAlive)
+	httpAliveClient.Configure(e.timeout,
+		time.Duration(e.KeepAliveInterval())*time.Second,
+		e.MaxIdleConnectionsPerHost())
+	e.httpClient = httpAliveClient
+
+	e.run(e.emitMetrics)
+}
+
+// indexName returns the index a metric with the given timestamp goes to
+func (e Elasticsearch) indexName(timestamp time.Time) string {
+	if e.indexDateFormat == "" {
+		return e.index
+	}
+	return e.index + "-" + timestamp.UTC().Format(e.indexDateFormat)
+}
+
+// document returns the fields of the document indexed for a metric
+func (e Elasticsearch) document(m metric.Metric) map[string]interface{} {
+	document := make(map[string]interface{})
+	for key, value := range m.GetDimensions(e.DefaultDimensions()) {
+		for _, field := range elasticsearchFields {
+			if key == field {
+				key = "dimension_" + key
+				break
+			}
+		}
+		document[key] = value
+	}
+	document["name"] = e.Prefix() + m.Name
+	document["type"] = m.MetricType
+	document["value"] = m.Value
+	document["timestamp"] = m.Time().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	return document
+}
+
+// bulkLines returns the action and document lines indexing a metric
+func (e Elasticsearch) bulkLines(m metric.Metric) []byte {
+	action, err := json.Marshal(elasticsearchBulkAction{
+		elasticsearchBulkIndex{Index: e.indexName(m.Time()), Type: e.documentType},
+	})
+	if err != nil {
+		e.log.Warn("Failed to marshal the action for ", m.Name, ": ", err)
+		return nil
+	}
+	document, err := json.Marshal(e.document(m))
+	if err != nil {
+		e.log.Warn("Failed to marshal ", m.Name, ": ", err)
+		return nil
+	}
+
+	var lines bytes.Buffer
+	lines.Write(action)
+	lines.WriteByte('\n')
+	lines.Write(document)
+	lines.WriteByte('\n')
+	return lines.Bytes()
+}
+
+// failedItems returns how many items of a bulk response weren't indexed,
+// and the error of the first of them
+func failedItems(body []byte) (int, string, error) {
+	var response elasticsearchBulkResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, "", err
+	}
+	if !response.Errors {
+		return 0, "", nil
+	}
+
+	failed := 0
+	firstError := ""
+	for _, item := range response.Items {
+		for _, result := range item {
+			if result.Status < 300 && len(result.Error) == 0 {
+				continue
+			}
+			failed++
+			if firstError == "" {
+				firstError = string(result.Error)
+			}
+		}
+	}
+	return failed, firstError, nil
+}
+
+func (e *Elasticsearch) emitMetrics(metrics []metric.Metric) bool {
+	e.log.Info("Starting to emit ", len(metrics), " metrics")
+
+	if len(metrics) == 0 {
+		e.log.Warn("Skipping send because of an empty payload")
+		return false
+	}
+
+	start := time.Now()
+	result, sent := e.emitBulk(metrics)
+	timing := emissionTiming{
+		timestamp:      time.Now(),
+		duration:       time.Since(start),
+		metricsSent:    sent,
+		metricsDropped: len(metrics) - sent,
+	}
+	if !result {
+		timing.metricsSent = len(metrics)
+	}
+	e.reportEmissionMetrics(result, timing)
+	return result
+}
+
+// emitBulk sends the metrics in a bulk request, returning whether it
+// succeeded and how many metrics were indexed
+func (e *Elasticsearch) emitBulk(metrics []metric.Metric) (bool, int) {
+	if e.endpoint == "" {
+		e.log.Warn("Skipping emission because there is no endpoint")
+		return false, 0
+	}
+
+	var body bytes.Buffer
+	lines := 0
+	for _, m := range metrics {
+		if line := e.bulkLines(m); line != nil {
+			body.Write(line)
+			lines++
+		}
+	}
+
+	headers := map[string]string{"Content-Type": "application/x-ndjson"}
+	if e.username != nil {
+		username, err := e.username.Value()
+		if err != nil {
+			e.log.Error(err)
+		}
+		password, err := e.password.Value()
+		if err != nil {
+			e.log.Error(err)
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		headers["Authorization"] = "Basic " + credentials
+	}
+
+	rsp, err := e.httpClient.MakeRequest("POST", e.endpoint+"/_bulk", &body, headers)
+	if err != nil {
+		e.log.Error("Failed to make request ", err,
+			" to endpoint ", e.endpoint)
+		return false, 0
+	}
+
+	if rsp.StatusCode != 200 {
+		e.log.Error("Failed to post to ", e.endpoint,
+			" status was ", rsp.StatusCode,
+			" rsp body was ", string(rsp.Body))
+		return false, 0
+	}
+
+	failed, firstError, err := failedItems(rsp.Body)
+	if err != nil {
+		e.log.Warn("Failed to parse the bulk response, assuming all metrics were indexed: ", err)
+	} else if failed > 0 {
+		e.log.Error(failed, " of ", lines, " metrics were not indexed, the first error was ", firstError)
+	}
+	return true, lines - failed
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"fullerite/metric"
+	"fullerite/util"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestElasticsearchHandler(interval, buffsize, timeoutsec int) *Elasticsearch {
+	testChannel := make(chan metric.Metric)
+	testLog := l.WithField("testing", "elasticsearch_handler")
+	timeout := time.Duration(timeoutsec) * time.Second
+
+	e := newElasticsearch(testChannel, interval, buffsize, timeout, testLog).(*Elasticsearch)
+	e.httpClient = new(util.HTTPAlive)
+	e.httpClient.Configure(timeout, time.Second, 1)
+	e.emissionTimingChannel = make(chan emissionTiming, 10)
+	return e
+}
+
+func TestElasticsearchConfigureEmptyConfig(t *testing.T) {
+	e := getTestElasticsearchHandler(12, 13, 14)
+	e.Configure(map[string]interface{}{})
+
+	assert.Equal(t, 12, e.Interval())
+	assert.Equal(t, 13, e.MaxBufferSize())
+	assert.Equal(t, "", e.Endpoint())
+	assert.True(t, e.UseCustomEmissionMetricsReporter())
+	assert.Equal(t, "fullerite-2017.07.14", e.indexName(time.Date(2017, 7, 14, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestElasticsearchConfigure(t *testing.T) {
+	e := getTestElasticsearchHandler(12, 13, 14)
+	e.Configure(map[string]interface{}{
+		"endpoint":        "http://localhost:9200/",
+		"index":           "metrics",
+		"indexDateFormat": "2006.01",
+		"documentType":    "metric",
+	})
+
+	assert.Equal(t, "http://localhost:9200", e.Endpoint())
+	assert.Equal(t, "metric", e.documentType)
+	assert.Equal(t, "metrics-2017.07", e.indexName(time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC)))
+
+	e.Configure(map[string]interface{}{"indexDateFormat": ""})
+	assert.Equal(t, "metrics", e.indexName(time.Now()))
+}
+
+func TestElasticsearchPayload(t *testing.T) {
+	e := getTestElasticsearchHandler(12, 13, 14)
+	e.Configure(map[string]interface{}{
+		"defaultDimensions": map[string]interface{}{"env": "test"},
+	})
+
+	m := metric.WithValue("cpu.idle", 97.5)
+	m.AddDimension("host", "a")
+	m.AddDimension("name", "cpu0")
+	m.Timestamp = time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+	scanner := bufio.NewScanner(bytes.NewBufferString(e.Payload(m)))
+	require.True(t, scanner.Scan())
+	assert.Equal(t, `{"index":{"_index":"fullerite-2017.07.14"}}`, scanner.Text())
+	require.True(t, scanner.Scan())
+	var document map[string]interface{}
+	require.Nil(t, json.Unmarshal(scanner.Bytes(), &document))
+	assert.Equal(t, map[string]interface{}{
+		"name":           "cpu.idle",
+		"type":           "gauge",
+		"value":          97.5,
+		"timestamp":      "2017-07-14T02:40:00.000Z",
+		"host":           "a",
+		"env":            "test",
+		"dimension_name": "cpu0",
+	}, document)
+	assert.False(t, scanner.Scan())
+}
+
+func TestElasticsearchFailedItems(t *testing.T) {
+	failed, firstError, err := failedItems([]byte(`{"errors": false, "items": [{"index": {"status": 201}}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, "", firstError)
+
+	failed, firstError, err = failedItems([]byte(`{"errors": true, "items": [
+		{"index": {"status": 201}},
+		{"index": {"status": 400, "error": {"type": "mapper_parsing_exception"}}},
+		{"index": {"status": 429, "error": {"type": "es_rejected_execution_exception"}}}
+	]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, failed)
+	assert.Equal(t, `{"type": "mapper_parsing_exception"}`, firstError)
+
+	_, _, err = failedItems([]byte("not json"))
+	assert.NotNil(t, err)
+}
+
+func TestElasticsearchEmitMetricsPartialFailure(t *testing.T) {
+	var (
+		path  string
+		auth  string
+		lines int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		lines = bytes.Count(body, []byte("\n"))
+		w.Write([]byte(`{"errors": true, "items": [
+			{"index": {"status": 201}},
+			{"index": {"status": 201}},
+			{"index": {"status": 400, "error": {"type": "mapper_parsing_exception"}}}
+		]}`))
+	}))
+	defer ts.Close()
+
+	e := getTestElasticsearchHandler(12, 13, 14)
+	e.Configure(map[string]interface{}{
+		"endpoint": ts.URL,
+		"username": "user",
+		"password": "pass",
+	})
+
+	metrics := []metric.Metric{metric.New("a"), metric.New("b"), metric.New("c")}
+	assert.True(t, e.emitMetrics(metrics))
+	assert.Equal(t, "/_bulk", path)
+	assert.Equal(t, "Basic dXNlcjpwYXNz", auth)
+	assert.Equal(t, 6, lines)
+	assert.Equal(t, uint64(2), e.metricsSent)
+	assert.Equal(t, uint64(1), e.metricsDropped)
+}
+
+func TestElasticsearchEmitMetricsFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	e := getTestElasticsearchHandler(12, 13, 14)
+	e.Configure(map[string]interface{}{"endpoint": ts.URL})
+
+	assert.False(t, e.emitMetrics([]metric.Metric{metric.New("a"), metric.New("b")}))
+	assert.Equal(t, uint64(0), e.metricsSent)
+	assert.Equal(t, uint64(2), e.metricsDropped)
+}
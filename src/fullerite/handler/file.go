@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+func init() {
+	RegisterHandler("File", newFile)
+	RegisterSchema("File", config.Schema{
+		{Key: "path", Type: config.String, Required: true, Description: "File the metrics are written to"},
+		{Key: "format", Type: config.String, Default: fileFormatJSON, Choices: []string{fileFormatJSON, fileFormatGraphite, fileFormatInflux}, Description: "Format of the lines"},
+		{Key: "maxFileSize", Type: config.Int, Default: defaultFileMaxSize, Description: "Bytes after which the file is rotated"},
+		{Key: "rotateInterval", Type: config.Int, Default: 0, Description: "Seconds after which the file is rotated, 0 to only rotate on size"},
+		{Key: "maxFiles", Type: config.Int, Default: defaultFileMaxFiles, Description: "Rotated files kept"},
+		{Key: "compress", Type: config.Bool, Default: true, Description: "Gzips the rotated files"},
+	})
+}
+
+// Formats the File handler can write
+const (
+	fileFormatJSON     = "json"
+	fileFormatGraphite = "graphite"
+	fileFormatInflux   = "influx"
+
+	defaultFileMaxSize  = 100 * 1024 * 1024
+	defaultFileMaxFiles = 5
+)
+
+// File type writes metrics to a local file, as JSON lines, Graphite
+// plaintext or InfluxDB line protocol. The file is rotated once it gets
+// larger than maxFileSize bytes or older than rotateInterval seconds,
+// keeping maxFiles rotated files, gzipped unless compress is false.
+type File struct {
+	BaseHandler
+	path           string
+	format         string
+	maxFileSize    int64
+	rotateInterval time.Duration
+	maxFiles       int
+	compress       bool
+
+	// fileMu guards opening file, emissions run concurrently
+	fileMu sync.Mutex
+	file   *rotatingFile
+}
+
+// fileJSONMetric is a line of a file in the JSON format
+type fileJSONMetric struct {
+	Name       string            `json:"name"`
+	MetricType string            `json:"type"`
+	Value      float64           `json:"value"`
+	Dimensions map[string]string `json:"dimensions"`
+	Timestamp  int64             `json:"timestamp"`
+}
+
+// newFile returns a new File handler.
+func newFile(
+	channel chan metric.Metric,
+	initialInterval int,
+	initialBufferSize int,
+	initialTimeout time.Duration,
+	log *l.Entry) Handler {
+
+	inst := new(File)
+	inst.name = "File"
+
+	inst.interval = initialInterval
+	inst.maxBufferSize = initialBufferSize
+	inst.timeout = initialTimeout
+	inst.log = log
+	inst.channel = channel
+	inst.formatPayload = inst.convertToFormat
+
+	inst.format = fileFormatJSON
+	inst.maxFileSize = defaultFileMaxSize
+	inst.maxFiles = defaultFileMaxFiles
+	inst.compress = true
+
+	return inst
+}
+
+// Configure accepts the different configuration options for the File handler
+func (f *File) Configure(configMap map[string]interface{}) {
+	if path, exists := configMap["path"]; exists {
+		f.path = fmt.Sprint(path)
+	} else {
+		f.log.Error("There was no path specified for the File Handler, there won't be any emissions")
+	}
+
+	if format, exists := configMap["format"]; exists {
+		switch fmt.Sprint(format) {
+		case fileFormatJSON, fileFormatGraphite, fileFormatInflux:
+			f.format = fmt.Sprint(format)
+		default:
+			f.log.Error("Unknown format ", format, " for the File Handler, writing ", f.format)
+		}
+	}
+	if size, exists := configMap["maxFileSize"]; exists {
+		f.maxFileSize = int64(config.GetAsInt(size, defaultFileMaxSize))
+	}
+	if interval, exists := configMap["rotateInterval"]; exists {
+		f.rotateInterval = time.Duration(config.GetAsInt(interval, 0)) * time.Second
+	}
+	if files, exists := configMap["maxFiles"]; exists {
+		f.maxFiles = config.GetAsInt(files, defaultFileMaxFiles)
+	}
+	if compress, exists := configMap["compress"]; exists {
+		f.compress = config.GetAsBool(compress, true)
+	}
+	f.configureCommonParams(configMap)
+}
+
+// Path returns the file the metrics are written to
+func (f *File) Path() string {
+	return f.path
+}
+
+// Format returns the format the metrics are written in
+func (f *File) Format() string {
+	return f.format
+}
+
+// Run runs the handler main loop
+func (f *File) Run() {
+	f.run(f.emitMetrics)
+}
+
+func (f *File) openFile() (*rotatingFile, error) {
+	f.fileMu.Lock()
+	defer f.fileMu.Unlock()
+
+	if f.file != nil {
+		return f.file, nil
+	}
+	file, err := newRotatingFile(f.path, f.maxFileSize, f.maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	file.maxAge = f.rotateInterval
+	file.compress = f.compress
+	f.file = file
+	return file, nil
+}
+
+func (f *File) convertToFormat(incomingMetric metric.Metric) string {
+	now := incomingMetric.Time()
+	switch f.format {
+	case fileFormatGraphite:
+		return graphiteLine(f.Prefix(), incomingMetric, f.DefaultDimensions(), now.Unix())
+	case fileFormatInflux:
+		return influxLine(f.Prefix(), incomingMetric, f.DefaultDimensions(), now.UnixNano())
+	}
+	line, err := json.Marshal(fileJSONMetric{
+		Name:       f.Prefix() + incomingMetric.Name,
+		MetricType: incomingMetric.MetricType,
+		Value:      incomingMetric.Value,
+		Dimensions: incomingMetric.GetDimensions(f.DefaultDimensions()),
+		Timestamp:  now.Unix(),
+	})
+	if err != nil {
+		f.log.Warn("Cannot marshal ", incomingMetric, ": ", err)
+		return ""
+	}
+	return string(line) + "\n"
+}
+
+func (f *File) emitMetrics(metrics []metric.Metric) bool {
+	f.log.Info("Starting to emit ", len(metrics), " metrics")
+
+	if len(metrics) == 0 {
+		f.log.Warn("Skipping send because of an empty payload")
+		return false
+	}
+	if f.path == "" {
+		return false
+	}
+	file, err := f.openFile()
+	if err != nil {
+		f.log.Error("Failed to open ", f.path, ": ", err)
+		return false
+	}
+
+	// the batch is written at once so that it isn't split by a rotation
+	var batch bytes.Buffer
+	for _, m := range metrics {
+		batch.WriteString(f.convertToFormat(m))
+	}
+	if _, err := file.Write(batch.Bytes()); err != nil {
+		f.log.Error("Failed to write to ", f.path, ": ", err)
+		return false
+	}
+	if err := file.Sync(); err != nil {
+		f.log.Error("Failed to sync ", f.path, ": ", err)
+		return false
+	}
+	return true
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// influxLine formats a metric in the InfluxDB line protocol, with its
+// dimensions as tags and its value as the value field
+func influxLine(prefix string, incomingMetric metric.Metric, defaultDimensions map[string]string, timestamp int64) string {
+	dimensions := incomingMetric.GetDimensions(defaultDimensions)
+	keys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := influxMeasurementEscaper.Replace(prefix + incomingMetric.Name)
+	for _, k := range keys {
+		if dimensions[k] == "" {
+			continue
+		}
+		line += "," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(dimensions[k])
+	}
+	value := strconv.FormatFloat(incomingMetric.Value, 'f', -1, 64)
+	return fmt.Sprintf("%s value=%s %d\n", line, value, timestamp)
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestFileHandler(interval, buffsize, timeoutsec int) *File {
+	testChannel := make(chan metric.Metric)
+	testLog := l.WithField("testing", "file_handler")
+	timeout := time.Duration(timeoutsec) * time.Second
+
+	return newFile(testChannel, interval, buffsize, timeout, testLog).(*File)
+}
+
+func testFileDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	return dir
+}
+
+func TestFileConfigureEmptyConfig(t *testing.T) {
+	f := getTestFileHandler(12, 13, 14)
+	f.Configure(map[string]interface{}{})
+
+	assert.Equal(t, 12, f.Interval())
+	assert.Equal(t, "", f.Path())
+	assert.Equal(t, fileFormatJSON, f.Format())
+	assert.Equal(t, int64(defaultFileMaxSize), f.maxFileSize)
+	assert.Equal(t, defaultFileMaxFiles, f.maxFiles)
+	assert.True(t, f.compress)
+	assert.False(t, f.emitMetrics([]metric.Metric{metric.New("test")}), "nothing is written without a path")
+}
+
+func TestFileConfigure(t *testing.T) {
+	f := getTestFileHandler(12, 13, 14)
+	f.Configure(map[string]interface{}{
+		"path":           "/tmp/metrics.log",
+		"format":         "influx",
+		"maxFileSize":    "1024",
+		"rotateInterval": 3600,
+		"maxFiles":       2,
+		"compress":       false,
+	})
+
+	assert.Equal(t, "/tmp/metrics.log", f.Path())
+	assert.Equal(t, fileFormatInflux, f.Format())
+	assert.Equal(t, int64(1024), f.maxFileSize)
+	assert.Equal(t, time.Hour, f.rotateInterval)
+	assert.Equal(t, 2, f.maxFiles)
+	assert.False(t, f.compress)
+
+	f.Configure(map[string]interface{}{"format": "xml"})
+	assert.Equal(t, fileFormatInflux, f.Format(), "unknown formats are ignored")
+}
+
+func TestFileConvertToFormat(t *testing.T) {
+	f := getTestFileHandler(12, 13, 14)
+	f.SetPrefix("px.")
+	f.SetDefaultDimensions(map[string]string{"host": "dev 1"})
+	m := metric.WithValue("cpu.idle", 1.5)
+	m.AddDimension("core", "0")
+	m.Timestamp = time.Unix(1465839830, 100)
+
+	var line fileJSONMetric
+	require.Nil(t, json.Unmarshal([]byte(f.convertToFormat(m)), &line))
+	assert.Equal(t, fileJSONMetric{
+		Name:       "px.cpu.idle",
+		MetricType: "gauge",
+		Value:      1.5,
+		Dimensions: map[string]string{"core": "0", "host": "dev 1"},
+		Timestamp:  1465839830,
+	}, line)
+
+	f.format = fileFormatGraphite
+	assert.Equal(t, "px.cpu_idle.core.0.host.dev_1 1.500000 1465839830\n", f.convertToFormat(m))
+
+	f.format = fileFormatInflux
+	assert.Equal(t, "px.cpu.idle,core=0,host=dev\\ 1 value=1.5 1465839830000000100\n", f.convertToFormat(m))
+}
+
+func TestFileEmitMetricsRotates(t *testing.T) {
+	dir := testFileDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+
+	f := getTestFileHandler(12, 13, 14)
+	f.Configure(map[string]interface{}{"path": path, "maxFileSize": 100, "maxFiles": 1})
+
+	assert.True(t, f.emitMetrics([]metric.Metric{metric.New("first"), metric.New("second")}))
+	assert.True(t, f.emitMetrics([]metric.Metric{metric.New("third")}))
+	f.file.Close()
+
+	current, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 1, strings.Count(string(current), "\n"))
+	assert.Contains(t, string(current), `"name":"third"`)
+
+	rotated, err := os.Open(path + ".1.gz")
+	require.Nil(t, err)
+	defer rotated.Close()
+	unzipped, err := gzip.NewReader(rotated)
+	require.Nil(t, err)
+	contents, _ := ioutil.ReadAll(unzipped)
+	assert.Equal(t, 2, strings.Count(string(contents), "\n"), "batches aren't split")
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := testFileDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.log")
+
+	f, err := newRotatingFile(path, 0, 1)
+	require.Nil(t, err)
+	f.maxAge = time.Minute
+	f.Write([]byte("old\n"))
+	f.opened = time.Now().Add(-2 * time.Minute)
+	f.Write([]byte("new\n"))
+	f.Close()
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "new\n", string(contents))
+	contents, _ = ioutil.ReadFile(path + ".1")
+	assert.Equal(t, "old\n", string(contents))
+}
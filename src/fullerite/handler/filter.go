@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// metricFilter matches metrics on their name, type and dimensions.
+// Filters are configured as lists under metricWhiteList and
+// metricBlackList, for example:
+//
+//	"metricBlackList": [
+//		{"name": "^procstatus\\.", "dimensions": {"pid": ".+"}},
+//		{"type": "cumcounter"}
+//	]
+//
+// name and the dimension values are regular expressions, type is one of
+// the metric types. A metric matches a filter when it matches every part
+// the filter sets; a dimension only matches when the metric has it. The
+// dimensions are those of the metric itself, not the handler defaults.
+type metricFilter struct {
+	name       *regexp.Regexp
+	metricType string
+	dimensions map[string]*regexp.Regexp
+}
+
+// parseMetricFilters reads a metricWhiteList or metricBlackList
+func parseMetricFilters(value interface{}) ([]metricFilter, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("should be a list of filters, not %v", value)
+	}
+
+	filters := []metricFilter{}
+	for i, item := range list {
+		filterMap, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("filter %d should be an object, not %v", i, item)
+		}
+		filter, err := parseMetricFilter(filterMap)
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %s", i, err)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func parseMetricFilter(filterMap map[string]interface{}) (metricFilter, error) {
+	filter := metricFilter{dimensions: map[string]*regexp.Regexp{}}
+	for key, value := range filterMap {
+		switch key {
+		case "name":
+			re, err := regexp.Compile(fmt.Sprint(value))
+			if err != nil {
+				return filter, err
+			}
+			filter.name = re
+		case "type":
+			filter.metricType = strings.ToLower(fmt.Sprint(value))
+		case "dimensions":
+			dimensions, ok := value.(map[string]interface{})
+			if !ok {
+				return filter, fmt.Errorf("dimensions should be an object, not %v", value)
+			}
+			for dimension, expr := range dimensions {
+				re, err := regexp.Compile(fmt.Sprint(expr))
+				if err != nil {
+					return filter, err
+				}
+				filter.dimensions[dimension] = re
+			}
+		default:
+			return filter, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return filter, nil
+}
+
+func (filter metricFilter) matches(m metric.Metric) bool {
+	if filter.name != nil && !filter.name.MatchString(m.Name) {
+		return false
+	}
+	if filter.metricType != "" && filter.metricType != m.MetricType {
+		return false
+	}
+	for dimension, re := range filter.dimensions {
+		value, exists := m.Dimensions[dimension]
+		if !exists || !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyFilterMatches returns true if one of the filters matches the metric
+func anyFilterMatches(filters []metricFilter, m metric.Metric) bool {
+	for _, filter := range filters {
+		if filter.matches(m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func filtersFromJSON(t *testing.T, filtersJSON string) []metricFilter {
+	var value interface{}
+	require.Nil(t, json.Unmarshal([]byte(filtersJSON), &value))
+	filters, err := parseMetricFilters(value)
+	require.Nil(t, err)
+	return filters
+}
+
+func procStatusMetric(pid string) metric.Metric {
+	m := metric.New("procstatus.VmRSS")
+	if pid != "" {
+		m.AddDimension("pid", pid)
+	}
+	return m
+}
+
+func TestMetricFilterMatches(t *testing.T) {
+	filters := filtersFromJSON(t, `[{"name": "^procstatus\\.", "type": "GAUGE", "dimensions": {"pid": "^[0-9]+$"}}]`)
+	require.Equal(t, 1, len(filters))
+	filter := filters[0]
+
+	assert.True(t, filter.matches(procStatusMetric("42")))
+	assert.False(t, filter.matches(procStatusMetric("")), "a missing dimension does not match")
+	assert.False(t, filter.matches(procStatusMetric("self")))
+
+	counter := procStatusMetric("42")
+	counter.MetricType = metric.Counter
+	assert.False(t, filter.matches(counter))
+
+	other := metric.New("cpu.idle")
+	other.AddDimension("pid", "42")
+	assert.False(t, filter.matches(other))
+
+	assert.True(t, metricFilter{}.matches(other), "an empty filter matches everything")
+}
+
+func TestParseMetricFiltersErrors(t *testing.T) {
+	for _, filtersJSON := range []string{
+		`{"name": "cpu"}`,
+		`["cpu"]`,
+		`[{"name": "("}]`,
+		`[{"dimensions": {"pid": "("}}]`,
+		`[{"dimensions": "pid"}]`,
+		`[{"nmae": "cpu"}]`,
+	} {
+		var value interface{}
+		require.Nil(t, json.Unmarshal([]byte(filtersJSON), &value))
+		_, err := parseMetricFilters(value)
+		assert.NotNil(t, err, filtersJSON)
+	}
+}
+
+func TestIsMetricAllowed(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	assert.True(t, base.isMetricAllowed(procStatusMetric("42")), "everything is allowed without filters")
+
+	base.configureCommonParams(map[string]interface{}{
+		"metricBlackList": []interface{}{
+			map[string]interface{}{"dimensions": map[string]interface{}{"pid": ".+"}},
+		},
+	})
+	assert.False(t, base.isMetricAllowed(procStatusMetric("42")))
+	assert.True(t, base.isMetricAllowed(procStatusMetric("")))
+
+	base.configureCommonParams(map[string]interface{}{
+		"metricWhiteList": []interface{}{
+			map[string]interface{}{"name": "^procstatus"},
+		},
+	})
+	assert.True(t, base.isMetricAllowed(procStatusMetric("")))
+	assert.False(t, base.isMetricAllowed(procStatusMetric("42")), "the blacklist wins over the whitelist")
+	assert.False(t, base.isMetricAllowed(metric.New("cpu.idle")))
+}
+
+func TestBaseHandlerIgnoresInvalidMetricFilters(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.configureCommonParams(map[string]interface{}{
+		"metricWhiteList": "procstatus",
+		"metricBlackList": []interface{}{map[string]interface{}{"name": "("}},
+	})
+	assert.Empty(t, base.metricWhiteList)
+	assert.Empty(t, base.metricBlackList)
+}
+
+func TestHandlerRunFiltersMetrics(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.interval = 1
+	base.maxBufferSize = 1
+	base.channel = make(chan metric.Metric)
+	base.configureCommonParams(map[string]interface{}{
+		"metricBlackList": []interface{}{map[string]interface{}{"name": "^filtered$"}},
+	})
+
+	emitted := make(chan []metric.Metric, 2)
+	go base.run(func(metrics []metric.Metric) bool {
+		emitted <- metrics
+		return true
+	})
+
+	base.channel <- metric.New("filtered")
+	base.channel <- metric.New("kept")
+	select {
+	case metrics := <-emitted:
+		require.Equal(t, 1, len(metrics))
+		assert.Equal(t, "kept", metrics[0].Name)
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing emitted")
+	}
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&base.metricsFiltered))
+	assert.Equal(t, 1.0, base.InternalMetrics().Counters["metricsFiltered"])
+	base.channel <- metric.Metric{}
+}
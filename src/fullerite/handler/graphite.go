@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"fullerite/config"
 	"fullerite/metric"
 	"fullerite/util"
 	"net"
@@ -13,6 +14,10 @@ import (
 
 func init() {
 	RegisterHandler("Graphite", newGraphite)
+	RegisterSchema("Graphite", config.Schema{
+		{Key: "server", Type: config.String, Required: true, Description: "Graphite host"},
+		{Key: "port", Type: config.Scalar, Required: true, Description: "Graphite plaintext port"},
+	})
 }
 
 // Graphite type
@@ -41,6 +46,9 @@ func newGraphite(
 	inst.timeout = initialTimeout
 	inst.log = log
 	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return inst.convertToGraphite(m)
+	}
 
 	return inst
 }
@@ -77,25 +85,30 @@ func (g *Graphite) Run() {
 }
 
 func (g Graphite) convertToGraphite(incomingMetric metric.Metric) (datapoint string) {
+	return graphiteLine(g.Prefix(), incomingMetric, g.DefaultDimensions(), incomingMetric.Time().Unix())
+}
+
+// graphiteLine formats a metric in the Graphite plaintext protocol, with
+// its sorted dimensions appended to its name
+func graphiteLine(prefix string, incomingMetric metric.Metric, defaultDimensions map[string]string, timestamp int64) string {
 	//orders dimensions so datapoint keeps consistent name
 	var keys []string
-	dimensions := g.getSanitizedDimensions(incomingMetric)
+	dimensions := graphiteSanitizedDimensions(incomingMetric, defaultDimensions)
 	for k := range dimensions {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 
-	datapoint = g.Prefix() + graphiteSanitize(incomingMetric.Name)
+	datapoint := prefix + graphiteSanitize(incomingMetric.Name)
 	for _, key := range keys {
 		datapoint = fmt.Sprintf("%s.%s.%s", datapoint, key, dimensions[key])
 	}
-	datapoint = fmt.Sprintf("%s %f %d\n", datapoint, incomingMetric.Value, time.Now().Unix())
-	return datapoint
+	return fmt.Sprintf("%s %f %d\n", datapoint, incomingMetric.Value, timestamp)
 }
 
-func (g Graphite) getSanitizedDimensions(incomingMetric metric.Metric) map[string]string {
+func graphiteSanitizedDimensions(incomingMetric metric.Metric, defaultDimensions map[string]string) map[string]string {
 	dimSanitized := make(map[string]string)
-	dimensions := incomingMetric.GetDimensions(g.DefaultDimensions())
+	dimensions := incomingMetric.GetDimensions(defaultDimensions)
 	for key, value := range dimensions {
 		dimSanitized[graphiteSanitize(key)] = graphiteSanitize(value)
 	}
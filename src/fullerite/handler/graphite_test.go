@@ -90,3 +90,12 @@ func TestGraphiteSanitation(t *testing.T) {
 
 	assert.Equal(t, strings.Split(datapoint1, " ")[0], datapoint2, "the two metrics should be the same")
 }
+
+func TestGraphiteKeepsTimestamps(t *testing.T) {
+	s := getTestGraphiteHandler(12, 12, 12)
+
+	m := metric.WithValue("test", 1)
+	m.Timestamp = time.Unix(1465839830, 0)
+
+	assert.Equal(t, "test 1.000000 1465839830\n", s.convertToGraphite(m))
+}
@@ -55,7 +55,9 @@ func New(name string) Handler {
 	realName := strings.Split(name, " ")[0]
 
 	if f, exists := handlerConstructs[realName]; exists {
-		return f(channel, DefaultInterval, DefaultBufferSize, timeout, handlerLog)
+		handler := f(channel, DefaultInterval, DefaultBufferSize, timeout, handlerLog)
+		handler.SetCanonicalName(name)
+		return handler
 	}
 
 	defaultLog.Error("Cannot create handler ", realName)
@@ -76,6 +78,8 @@ type Handler interface {
 	Name() string
 	String() string
 	Channel() chan metric.Metric
+	CanonicalName() string
+	SetCanonicalName(string)
 
 	CollectorEndpoints() map[string]CollectorEnd
 	SetCollectorEndpoints(map[string]CollectorEnd)
@@ -109,6 +113,14 @@ type Handler interface {
 	SetCollectorWhiteList([]string)
 	CollectorWhiteList() map[string]bool
 	IsCollectorWhiteListed(string) (bool, bool)
+	IsCollectorAllowed(string) bool
+
+	// A metric the way the handler sends it
+	Payload(metric.Metric) string
+
+	// Samples of what the handler emitted,
+	// nil unless a tee is configured
+	TeeSamples() []TeeSample
 
 	// Return true if handler implementation
 	// takes care of reporting emission metrics
@@ -120,6 +132,8 @@ type emissionTiming struct {
 	timestamp   time.Time
 	duration    time.Duration
 	metricsSent int
+	// metrics rejected by the backend although the emission succeeded
+	metricsDropped int
 }
 
 // BaseHandler is class to handle the boiler plate parts of the handlers
@@ -127,6 +141,7 @@ type BaseHandler struct {
 	channel            chan metric.Metric
 	collectorEndpoints map[string]CollectorEnd
 	name               string
+	canonicalName      string
 	prefix             string
 	defaultDimensions  map[string]string
 	log                *l.Entry
@@ -153,10 +168,14 @@ type BaseHandler struct {
 	useCustomEmissionMetricsReporter bool
 
 	// for tracking
-	emissionTimes  list.List
-	totalEmissions uint64
-	metricsSent    uint64
-	metricsDropped uint64
+	emissionTimes   list.List
+	totalEmissions  uint64
+	metricsSent     uint64
+	metricsDropped  uint64
+	metricsFiltered uint64
+	// metricsAbsorbed are taken in by the counter conversion, the
+	// aggregation or the cardinality limit rather than emitted as they are
+	metricsAbsorbed uint64
 
 	// List of blacklisted collectors
 	// the handler won't accept metrics from
@@ -165,6 +184,29 @@ type BaseHandler struct {
 	// List of whitelisted collectors
 	// the handler will accept metrics from
 	whiteListedCollectors map[string]bool
+
+	// Filters on the metrics the handler accepts
+	metricWhiteList []metricFilter
+	metricBlackList []metricFilter
+
+	// Rules reshaping the metrics before they are emitted
+	rewriteRules []rewriteRule
+
+	// Limits the unique series the handler emits, nil without a limit
+	cardinality *metric.CardinalityLimiter
+
+	// Converts cumulative counters, nil to emit them as they are
+	counters *counterConverter
+
+	// Aggregates metrics before they are emitted, nil when not configured
+	aggregator *metric.Aggregator
+
+	// Samples what the handler emits, nil when not configured
+	tee *tee
+
+	// Formats a metric the way the handler sends it, set by the handlers
+	// with a format of their own
+	formatPayload func(metric.Metric) string
 }
 
 // SetMaxBufferSize : set the buffer size
@@ -224,6 +266,20 @@ func (base *BaseHandler) Name() string {
 	return base.name
 }
 
+// CanonicalName : the name of the handler in the configuration, which
+// tells apart handlers of the same kind
+func (base *BaseHandler) CanonicalName() string {
+	if base.canonicalName == "" {
+		return base.name
+	}
+	return base.canonicalName
+}
+
+// SetCanonicalName : set the name of the handler in the configuration
+func (base *BaseHandler) SetCanonicalName(name string) {
+	base.canonicalName = name
+}
+
 // MaxBufferSize : the maximum number of metrics that should be buffered before sending
 func (base *BaseHandler) MaxBufferSize() int {
 	return base.maxBufferSize
@@ -292,6 +348,34 @@ func (base *BaseHandler) CollectorWhiteList() map[string]bool {
 	return base.whiteListedCollectors
 }
 
+// IsCollectorAllowed returns true if the metrics of collectorName are
+// emitted by the handler
+func (base *BaseHandler) IsCollectorAllowed(collectorName string) bool {
+	// If the handler's whitelist is set, then only metrics from collectors in it will be emitted. If the same
+	// collector is also in the blacklist, it will be skipped.
+	// If the handler's whitelist is not set and its blacklist is not empty, only metrics from collectors not in
+	// the blacklist will be emitted.
+	isWhiteListed, _ := base.IsCollectorWhiteListed(collectorName)
+	isBlackListed, _ := base.IsCollectorBlackListed(collectorName)
+
+	// If the handler's whitelist is not nil and not empty, only the whitelisted collectors should be considered
+	if len(base.CollectorWhiteList()) > 0 {
+		return isWhiteListed && !isBlackListed
+	}
+	// If the handler's whitelist is nil, all collector except the ones in the blacklist are enabled
+	return !isBlackListed
+}
+
+// isMetricAllowed returns true if the metric passes the handler's metric
+// whitelist and blacklist. When the whitelist is set a metric has to match
+// one of its filters, a metric matching a blacklist filter is never allowed.
+func (base *BaseHandler) isMetricAllowed(m metric.Metric) bool {
+	if len(base.metricWhiteList) > 0 && !anyFilterMatches(base.metricWhiteList, m) {
+		return false
+	}
+	return !anyFilterMatches(base.metricBlackList, m)
+}
+
 // MaxIdleConnectionsPerHost : return max idle connections per host
 func (base *BaseHandler) MaxIdleConnectionsPerHost() int {
 	return base.maxIdleConnectionsPerHost
@@ -302,23 +386,8 @@ func (base *BaseHandler) InitListeners(globalConfig config.Config) {
 	collectorEndpoints := make(map[string]CollectorEnd)
 	for _, c := range append(globalConfig.Collectors, globalConfig.DiamondCollectors...) {
 
-		// If the handler's whitelist is set, then only metrics from collectors in it will be emitted. If the same
-		// collector is also in the blacklist, it will be skipped.
-		// If the handler's whitelist is not set and its blacklist is not empty, only metrics from collectors not in
-		// the blacklist will be emitted.
-		isWhiteListed, _ := base.IsCollectorWhiteListed(c)
-		isBlackListed, _ := base.IsCollectorBlackListed(c)
-
-		// If the handler's whitelist is not nil and not empty, only the whitelisted collectors should be considered
-		if base.CollectorWhiteList() != nil && len(base.CollectorWhiteList()) > 0 {
-			if !isWhiteListed || isBlackListed {
-				continue
-			}
-		} else {
-			// If the handler's whitelist is nil, all collector except the ones in the blacklist are enabled
-			if isBlackListed {
-				continue
-			}
+		if !base.IsCollectorAllowed(c) {
+			continue
 		}
 		collectorEndpoints[c] = CollectorEnd{
 			make(chan metric.Metric, 1),
@@ -366,15 +435,25 @@ func (base *BaseHandler) InternalMetrics() metric.InternalMetrics {
 	mu.Lock()
 	defer mu.Unlock()
 	counters := map[string]float64{
-		"totalEmissions": float64(base.totalEmissions),
-		"metricsDropped": float64(base.metricsDropped),
-		"metricsSent":    float64(base.metricsSent),
+		"totalEmissions":  float64(base.totalEmissions),
+		"metricsDropped":  float64(base.metricsDropped),
+		"metricsSent":     float64(base.metricsSent),
+		"metricsFiltered": float64(atomic.LoadUint64(&base.metricsFiltered)),
+		"metricsAbsorbed": float64(atomic.LoadUint64(&base.metricsAbsorbed)),
 	}
 	gauges := map[string]float64{
 		"intervalLength":    float64(base.interval),
 		"emissionsInWindow": float64(base.emissionTimes.Len()),
 	}
 
+	if base.counters != nil {
+		gauges["counterSeries"] = float64(base.counters.series())
+	}
+	if base.cardinality != nil {
+		gauges["uniqueSeries"] = float64(base.cardinality.Series())
+		gauges["uniqueSeriesLimit"] = float64(base.cardinality.Limit())
+	}
+
 	// now we calculate the average emission seconds for
 	if base.emissionTimes.Len() > 0 {
 		avg := 0.0
@@ -440,6 +519,77 @@ func (base *BaseHandler) configureCommonParams(configMap map[string]interface{})
 		whiteList := config.GetAsSlice(asInterface)
 		base.SetCollectorWhiteList(whiteList)
 	}
+
+	if asInterface, exists := configMap["metricWhiteList"]; exists {
+		filters, err := parseMetricFilters(asInterface)
+		if err != nil {
+			base.log.Error("Ignoring the metric whitelist: ", err)
+		} else {
+			base.metricWhiteList = filters
+		}
+	}
+
+	if asInterface, exists := configMap["metricBlackList"]; exists {
+		filters, err := parseMetricFilters(asInterface)
+		if err != nil {
+			base.log.Error("Ignoring the metric blacklist: ", err)
+		} else {
+			base.metricBlackList = filters
+		}
+	}
+
+	if _, exists := configMap["cardinalityLimit"]; exists {
+		base.cardinality = metric.NewCardinalityLimiter(metric.ParseCardinalityConfig(configMap), base.String(), base.log)
+	}
+
+	if asInterface, exists := configMap["cumulativeCounterMode"]; exists {
+		expiry := defaultCounterStateExpiry
+		if value, exists := configMap["counterStateExpiry"]; exists {
+			expiry = time.Duration(config.GetAsInt(value, int(defaultCounterStateExpiry.Seconds()))) * time.Second
+		}
+		converter, err := newCounterConverter(fmt.Sprint(asInterface), expiry)
+		if err != nil {
+			base.log.Error("Emitting cumulative counters as they are: ", err)
+		} else {
+			base.counters = converter
+		}
+	}
+
+	if asInterface, exists := configMap["aggregation"]; exists {
+		aggregation, err := metric.ParseAggregationConfig(asInterface)
+		if err != nil {
+			base.log.Error("Ignoring the aggregation: ", err)
+		} else {
+			base.aggregator = metric.NewAggregator(aggregation)
+		}
+	}
+
+	if asInterface, exists := configMap["tee"]; exists {
+		t, err := parseTee(asInterface)
+		if err != nil {
+			base.log.Error("Ignoring the tee: ", err)
+		} else {
+			base.tee = t
+		}
+	}
+
+	if asInterface, exists := configMap["rewriteRules"]; exists {
+		rules, err := parseRewriteRules(asInterface)
+		if err != nil {
+			base.log.Error("Ignoring the rewrite rules: ", err)
+		} else {
+			base.rewriteRules = rules
+		}
+	}
+}
+
+// secretTTL returns how long the secrets of a handler configuration are
+// used before they are read again from their files or commands
+func secretTTL(configMap map[string]interface{}) time.Duration {
+	if asInterface, exists := configMap["secretTTL"]; exists {
+		return time.Duration(config.GetAsInt(asInterface, int(config.DefaultSecretTTL.Seconds()))) * time.Second
+	}
+	return config.DefaultSecretTTL
 }
 
 func (base *BaseHandler) run(emitFunc func([]metric.Metric) bool) {
@@ -450,7 +600,16 @@ func (base *BaseHandler) run(emitFunc func([]metric.Metric) bool) {
 
 	defaultCollectorEnd := CollectorEnd{base.Channel(), base.MaxBufferSize()}
 
-	go base.listenForMetrics(emitFunc, defaultCollectorEnd, "")
+	stopAggregating := make(chan struct{})
+	if base.aggregator != nil {
+		go base.emitAggregates(emitFunc, stopAggregating)
+	}
+
+	go func() {
+		base.listenForMetrics(emitFunc, defaultCollectorEnd, "")
+		// the handler's channel is closed, the aggregation stops with it
+		close(stopAggregating)
+	}()
 	for k := range base.CollectorEndpoints() {
 		go base.listenForMetrics(emitFunc, base.CollectorEndpoints()[k], k)
 	}
@@ -468,6 +627,12 @@ func (base *BaseHandler) listenForMetrics(
 	flusher := ticker.C
 
 	flushFunction := func() {
+		if exceeded := base.cardinalityExceeded(); exceeded != nil {
+			metrics = append(metrics, *exceeded)
+		}
+		if base.cardinality != nil {
+			metrics = append(metrics, base.cardinality.TakeOverflow()...)
+		}
 		go base.emitAndTime(metrics, emitFunc)
 
 		// will get copied into this call, meaning it's ok to clear it
@@ -492,6 +657,32 @@ stopReading:
 				continue
 			}
 
+			if !base.isMetricAllowed(incomingMetric) {
+				atomic.AddUint64(&base.metricsFiltered, 1)
+				continue
+			}
+
+			if base.counters != nil {
+				var ok bool
+				if incomingMetric, ok = base.counters.convert(incomingMetric, incomingMetric.Time()); !ok {
+					atomic.AddUint64(&base.metricsAbsorbed, 1)
+					continue
+				}
+			}
+
+			if base.aggregator != nil && base.aggregator.Add(incomingMetric) {
+				atomic.AddUint64(&base.metricsAbsorbed, 1)
+				continue
+			}
+
+			if base.cardinality != nil {
+				var ok bool
+				if incomingMetric, ok = base.cardinality.Check(incomingMetric); !ok {
+					atomic.AddUint64(&base.metricsAbsorbed, 1)
+					continue
+				}
+			}
+
 			base.log.Debug(base.Name(), " metric: ", incomingMetric)
 			metrics = append(metrics, incomingMetric)
 			currentBufferSize++
@@ -511,6 +702,58 @@ stopReading:
 
 }
 
+// emitAggregates emits the aggregated metrics of every collector at the
+// end of each aggregation window, and what was aggregated so far once
+// stop is closed
+func (base *BaseHandler) emitAggregates(emitFunc func([]metric.Metric) bool, stop <-chan struct{}) {
+	ticker := time.NewTicker(base.aggregator.Window())
+	defer ticker.Stop()
+	for stopped := false; !stopped; {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			stopped = true
+		}
+		if metrics := base.aggregator.Flush(); len(metrics) > 0 {
+			go base.emitAndTime(metrics, emitFunc)
+		}
+	}
+}
+
+// TeeSamples : samples of what the handler emitted, nil without a tee
+func (base *BaseHandler) TeeSamples() []TeeSample {
+	if base.tee == nil {
+		return nil
+	}
+	return base.tee.Samples()
+}
+
+// Payload : a metric the way the handler sends it, by default as JSON with
+// the default dimensions
+func (base *BaseHandler) Payload(m metric.Metric) string {
+	if base.formatPayload != nil {
+		return base.formatPayload(m)
+	}
+	m.Dimensions = m.GetDimensions(base.DefaultDimensions())
+	return jsonPayload(m)
+}
+
+// cardinalityExceeded returns a fullerite.cardinality_exceeded counter
+// of the metrics over the cardinality limit since the last flush, if any
+func (base *BaseHandler) cardinalityExceeded() *metric.Metric {
+	if base.cardinality == nil {
+		return nil
+	}
+	exceeded := base.cardinality.TakeExceeded()
+	if exceeded == 0 {
+		return nil
+	}
+	m := metric.WithValue(metric.CardinalityExceeded, float64(exceeded))
+	m.MetricType = metric.Counter
+	m.AddDimension("handler", base.Name())
+	return &m
+}
+
 // manages the rolling window of emissions
 // the emissions are a timesorted list, and we purge things older than
 // the base handler's interval
@@ -550,12 +793,17 @@ func (base *BaseHandler) reportEmissionMetrics(emissionResult bool, timing emiss
 			),
 		)
 		atomic.AddUint64(&base.metricsSent, uint64(timing.metricsSent))
+		atomic.AddUint64(&base.metricsDropped, uint64(timing.metricsDropped))
 	} else {
 		atomic.AddUint64(&base.metricsDropped, uint64(timing.metricsSent))
 	}
 }
 
 func (base *BaseHandler) emitAndTime(metrics []metric.Metric, emitFunc func([]metric.Metric) bool) {
+	metrics = rewriteMetrics(base.rewriteRules, metrics, base.DefaultDimensions())
+	if base.tee != nil {
+		base.tee.sample(metrics, base.Payload)
+	}
 	start := time.Now()
 	result := emitFunc(metrics)
 	elapsed := time.Since(start)
@@ -568,3 +816,71 @@ func (base *BaseHandler) emitAndTime(metrics []metric.Metric, emitFunc func([]me
 		base.reportEmissionMetrics(result, timing)
 	}
 }
+
+// emitBatches emits the metrics in a single batch, or in a batch per value
+// of dimension, concurrently. Each batch is timed and reported by the
+// handlers using a custom emission metrics reporter.
+func (base *BaseHandler) emitBatches(
+	metrics []metric.Metric,
+	dimension string,
+	emitBatch func(string, []metric.Metric) bool) bool {
+
+	if len(metrics) == 0 {
+		base.log.Warn("Skipping send because of an empty payload")
+		return false
+	}
+
+	if dimension == "" {
+		// If batchByDimension key is NOT defined,
+		// then emit all metrics in a single batch
+		return base.emitBatchAndTime("", metrics, emitBatch)
+	}
+
+	// If batchByDimension key is defined,
+	// then divide the list of metrics into batches,
+	// emit them concurrently (or parallely, if GOMAXPROCS is > 1)
+	for batchName, metricBatch := range makeBatches(metrics, dimension) {
+		go base.emitBatchAndTime(batchName, metricBatch, emitBatch)
+	}
+	return true
+}
+
+func (base *BaseHandler) emitBatchAndTime(
+	batchName string,
+	metrics []metric.Metric,
+	emitBatch func(string, []metric.Metric) bool) bool {
+
+	start := time.Now()
+	emissionResult := emitBatch(batchName, metrics)
+	elapsed := time.Since(start)
+
+	// Report emission metrics if emission tracker is disabled in base handler
+	if base.UseCustomEmissionMetricsReporter() {
+		timing := emissionTiming{
+			timestamp:   time.Now(),
+			duration:    elapsed,
+			metricsSent: len(metrics),
+		}
+		base.reportEmissionMetrics(emissionResult, timing)
+	}
+
+	return emissionResult
+}
+
+// makeBatches splits the metrics by the value of their dimension
+func makeBatches(metrics []metric.Metric, dimension string) map[string][]metric.Metric {
+	m := make(map[string][]metric.Metric)
+
+	// If batchByDimension key is not defined,
+	// do not examine each metric
+	if dimension == "" {
+		m[""] = metrics
+		return m
+	}
+
+	for _, metric := range metrics {
+		dimValue := metric.Dimensions[dimension]
+		m[dimValue] = append(m[dimValue], metric)
+	}
+	return m
+}
@@ -135,11 +135,11 @@ func TestRecordTimings(t *testing.T) {
 	now := time.Now()
 
 	// create a list of emissions in order with some older than 1 second
-	base.emissionTimes.PushBack(emissionTiming{now.Add(minusSixSec), someDur, 0})
-	base.emissionTimes.PushBack(emissionTiming{now.Add(minusFiveSec), someDur, 0})
+	base.emissionTimes.PushBack(emissionTiming{timestamp: now.Add(minusSixSec), duration: someDur})
+	base.emissionTimes.PushBack(emissionTiming{timestamp: now.Add(minusFiveSec), duration: someDur})
 
 	go func() {
-		base.emissionTimingChannel <- emissionTiming{now, someDur, 0}
+		base.emissionTimingChannel <- emissionTiming{timestamp: now, duration: someDur}
 		close(base.emissionTimingChannel)
 	}()
 
@@ -297,19 +297,21 @@ func TestInternalMetrics(t *testing.T) {
 	base.metricsSent = 2
 	base.interval = 4
 
-	timing := emissionTiming{time.Now(), 5 * time.Second, 0}
+	timing := emissionTiming{timestamp: time.Now(), duration: 5 * time.Second}
 	base.emissionTimes.PushBack(timing)
-	timing = emissionTiming{time.Now(), 10 * time.Second, 0}
+	timing = emissionTiming{timestamp: time.Now(), duration: 10 * time.Second}
 	base.emissionTimes.PushBack(timing)
-	timing = emissionTiming{time.Now(), 6 * time.Second, 0}
+	timing = emissionTiming{timestamp: time.Now(), duration: 6 * time.Second}
 	base.emissionTimes.PushBack(timing)
 
 	results := base.InternalMetrics()
 	expected := metric.InternalMetrics{
 		Counters: map[string]float64{
-			"metricsDropped": 100,
-			"metricsSent":    2,
-			"totalEmissions": 10,
+			"metricsDropped":  100,
+			"metricsSent":     2,
+			"metricsFiltered": 0,
+			"metricsAbsorbed": 0,
+			"totalEmissions":  10,
 		},
 		Gauges: map[string]float64{
 			"averageEmissionTiming": 7,
@@ -326,9 +328,11 @@ func TestInternalMetricsWithNan(t *testing.T) {
 
 	expected := metric.InternalMetrics{
 		Counters: map[string]float64{
-			"metricsDropped": 0,
-			"metricsSent":    0,
-			"totalEmissions": 0,
+			"metricsDropped":  0,
+			"metricsSent":     0,
+			"metricsFiltered": 0,
+			"metricsAbsorbed": 0,
+			"totalEmissions":  0,
 		},
 		// specifically missing the averageEmissionTiming
 		// because we have no emissions yet
@@ -347,3 +351,103 @@ func TestKeepAliveConfig(t *testing.T) {
 	assert.Equal(t, 0, base.KeepAliveInterval())
 	assert.Equal(t, 0, base.MaxIdleConnectionsPerHost())
 }
+
+func TestHandlerRunLimitsCardinality(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.name = "Test"
+	base.interval = 1
+	base.maxBufferSize = 3
+	base.channel = make(chan metric.Metric)
+	base.configureCommonParams(map[string]interface{}{"cardinalityLimit": 1})
+
+	emitted := make(chan []metric.Metric, 2)
+	go base.run(func(metrics []metric.Metric) bool {
+		emitted <- metrics
+		return true
+	})
+
+	base.channel <- metric.New("first")
+	base.channel <- metric.New("second")
+	base.channel <- metric.New("first")
+	base.channel <- metric.New("first")
+	select {
+	case metrics := <-emitted:
+		names := []string{}
+		for _, m := range metrics {
+			names = append(names, m.Name)
+		}
+		assert.Equal(t, []string{"first", "first", "first", metric.CardinalityExceeded}, names)
+		exceeded := metrics[len(metrics)-1]
+		assert.Equal(t, metric.Counter, exceeded.MetricType)
+		assert.Equal(t, 1.0, exceeded.Value)
+		assert.Equal(t, "Test", exceeded.Dimensions["handler"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing emitted")
+	}
+	assert.Equal(t, 1.0, base.InternalMetrics().Gauges["uniqueSeries"])
+	assert.Equal(t, 1.0, base.InternalMetrics().Gauges["uniqueSeriesLimit"])
+	assert.Equal(t, 1.0, base.InternalMetrics().Counters["metricsAbsorbed"], "the metric over the limit")
+	base.channel <- metric.Metric{}
+}
+
+func TestHandlerRunAggregates(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.interval = 1
+	base.maxBufferSize = 1
+	base.channel = make(chan metric.Metric)
+	base.configureCommonParams(map[string]interface{}{
+		"aggregation": map[string]interface{}{
+			"metrics": "^requests$",
+			"window":  1.0,
+			"stats":   []interface{}{"sum"},
+		},
+	})
+
+	emitted := make(chan []metric.Metric, 2)
+	go base.run(func(metrics []metric.Metric) bool {
+		emitted <- metrics
+		return true
+	})
+
+	for _, worker := range []string{"1", "2"} {
+		m := metric.WithValue("requests", 3)
+		m.AddDimension("worker", worker)
+		base.channel <- m
+	}
+	select {
+	case metrics := <-emitted:
+		assert.Equal(t, []metric.Metric{metric.WithValue("requests.sum", 6)}, metrics)
+	case <-time.After(3 * time.Second):
+		t.Fatal("nothing emitted")
+	}
+	base.channel <- metric.Metric{}
+}
+
+func TestHandlerRunStopsAggregatingWithItsChannel(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.interval = 1
+	base.maxBufferSize = 1
+	base.channel = make(chan metric.Metric)
+	base.configureCommonParams(map[string]interface{}{
+		"aggregation": map[string]interface{}{
+			"metrics": "^requests$",
+			"window":  3600.0,
+			"stats":   []interface{}{"sum"},
+		},
+	})
+
+	emitted := make(chan []metric.Metric, 2)
+	go base.run(func(metrics []metric.Metric) bool {
+		emitted <- metrics
+		return true
+	})
+
+	base.channel <- metric.WithValue("requests", 3)
+	close(base.channel)
+	select {
+	case metrics := <-emitted:
+		assert.Equal(t, []metric.Metric{metric.WithValue("requests.sum", 3)}, metrics, "the aggregates are emitted when the channel closes")
+	case <-time.After(3 * time.Second):
+		t.Fatal("the aggregation didn't stop with the channel")
+	}
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+	"fullerite/util"
+
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"text/template"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+func init() {
+	RegisterHandler("HTTP", newHTTP)
+	RegisterSchema("HTTP", config.Schema{
+		{Key: "endpoint", Type: config.String, Required: true, Description: "URL the batches are sent to"},
+		{Key: "method", Type: config.String, Default: "POST", Description: "HTTP method of the requests"},
+		{Key: "template", Type: config.String, Default: defaultHTTPTemplate, Description: "Go template of the request body over the batch"},
+		{Key: "headers", Type: config.StringMap, Secret: true, Description: "Headers of the requests, the values may reference secrets"},
+		{Key: "gzip", Type: config.Bool, Default: false, Description: "Gzips the request bodies"},
+		{Key: "batchByDimension", Type: config.String, Description: "Dimension the metrics are batched by"},
+		{Key: "successStatusCodes", Type: config.List, Description: "Status codes of the successful requests, any 2xx by default"},
+	})
+}
+
+// defaultHTTPTemplate posts the batch as a JSON list of metrics
+const defaultHTTPTemplate = "{{json .Metrics}}"
+
+// HTTP type posts batches of metrics to any HTTP endpoint. The body is
+// a Go template over the batch, for example:
+//
+//	"HTTP": {
+//		"endpoint": "https://metrics.example.com/v1/points",
+//		"template": "{\"points\": [{{range $i, $m := .Metrics}}{{if $i}},{{end}}{\"metric\": {{json $m.Name}}, \"value\": {{$m.Value}}}{{end}}]}",
+//		"headers": {"Authorization": "Bearer ${METRICS_API_TOKEN}"},
+//		"gzip": true,
+//		"batchByDimension": "service",
+//		"successStatusCodes": [200, 202]
+//	}
+//
+// Templates get the Batch, the value of batchByDimension the batch was
+// made for, and the Metrics, each with its Name, Type, Value, Dimensions,
+// including the default ones, and Timestamp in Unix seconds; json is
+// available to quote values. The default template posts the metrics as
+// a JSON list. Header values may reference secrets such as
+// file:/etc/fullerite/token, see config.Secret; ${VARIABLE}s are replaced
+// by the environment variables when the configuration is read. Any 2xx
+// status is a success unless successStatusCodes is set.
+type HTTP struct {
+	BaseHandler
+	endpoint           string
+	method             string
+	template           *template.Template
+	headers            map[string]string
+	secretHeaders      map[string]*config.Secret
+	gzip               bool
+	batchByDimension   string
+	successStatusCodes []int
+	httpClient         *util.HTTPAlive
+}
+
+// httpTemplateData is what body templates are executed on
+type httpTemplateData struct {
+	Batch   string
+	Metrics []httpTemplateMetric
+}
+
+type httpTemplateMetric struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Value      float64           `json:"value"`
+	Dimensions map[string]string `json:"dimensions"`
+	Timestamp  int64             `json:"timestamp"`
+}
+
+var httpTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+}
+
+// newHTTP returns a new HTTP handler.
+func newHTTP(
+	channel chan metric.Metric,
+	initialInterval int,
+	initialBufferSize int,
+	initialTimeout time.Duration,
+	log *l.Entry) Handler {
+
+	inst := new(HTTP)
+	inst.name = "HTTP"
+
+	inst.interval = initialInterval
+	inst.maxBufferSize = initialBufferSize
+	inst.timeout = initialTimeout
+	inst.maxIdleConnectionsPerHost = DefaultMaxIdleConnectionsPerHost
+	inst.keepAliveInterval = DefaultKeepAliveInterval
+	inst.log = log
+	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		body, _ := inst.renderBody("", []metric.Metric{m})
+		return string(body)
+	}
+
+	inst.method = "POST"
+	inst.template = template.Must(template.New("body").Funcs(httpTemplateFuncs).Parse(defaultHTTPTemplate))
+	inst.headers = map[string]string{"Content-Type": "application/json"}
+
+	return inst
+}
+
+// Configure accepts the different configuration options for the HTTP handler
+func (h *HTTP) Configure(configMap map[string]interface{}) {
+	if endpoint, exists := configMap["endpoint"]; exists {
+		h.endpoint = fmt.Sprint(endpoint)
+	} else {
+		h.log.Error("There was no endpoint specified for the HTTP Handler, there won't be any emissions")
+	}
+
+	if method, exists := configMap["method"]; exists {
+		h.method = fmt.Sprint(method)
+	}
+
+	if body, exists := configMap["template"]; exists {
+		tmpl, err := template.New("body").Funcs(httpTemplateFuncs).Option("missingkey=zero").Parse(fmt.Sprint(body))
+		if err != nil {
+			h.log.Error("Invalid template for the HTTP Handler, posting the metrics as JSON: ", err)
+		} else {
+			h.template = tmpl
+		}
+	}
+
+	if headers, exists := configMap["headers"]; exists {
+		for key, value := range config.GetAsMap(headers) {
+			if !config.IsSecretReference(value) {
+				h.headers[key] = value
+				continue
+			}
+			if h.secretHeaders == nil {
+				h.secretHeaders = make(map[string]*config.Secret)
+			}
+			h.secretHeaders[key] = config.NewSecret(value, secretTTL(configMap))
+		}
+	}
+
+	if gzipped, exists := configMap["gzip"]; exists {
+		h.gzip = config.GetAsBool(gzipped, false)
+	}
+
+	if codes, exists := configMap["successStatusCodes"]; exists {
+		h.successStatusCodes = []int{}
+		if list, ok := codes.([]interface{}); ok {
+			for _, code := range list {
+				h.successStatusCodes = append(h.successStatusCodes, config.GetAsInt(code, 0))
+			}
+		} else {
+			h.log.Error("successStatusCodes should be a list, not ", codes)
+		}
+	}
+
+	if batchByDimension, exists := configMap["batchByDimension"]; exists {
+		h.batchByDimension = fmt.Sprint(batchByDimension)
+		h.log.Info("Batching metrics by dimension: ", h.batchByDimension)
+
+		// Use custom emission time reporting when
+		// employing any fancy batching mechanism
+		h.OverrideBaseEmissionMetricsReporter()
+	}
+
+	h.configureCommonParams(configMap)
+}
+
+// Endpoint returns the URL the metrics are sent to
+func (h HTTP) Endpoint() string {
+	return h.endpoint
+}
+
+// Run runs the handler main loop
+func (h *HTTP) Run() {
+	httpAliveClient := new(util.HTTPAlive)
+	httpAliveClient.Configure(h.timeout,
+		time.Duration(h.KeepAliveInterval())*time.Second,
+		h.MaxIdleConnectionsPerHost())
+	h.httpClient = httpAliveClient
+
+	h.run(h.emitMetrics)
+}
+
+// renderBody executes the template over a batch
+func (h *HTTP) renderBody(batchName string, metrics []metric.Metric) ([]byte, error) {
+	data := httpTemplateData{
+		Batch:   batchName,
+		Metrics: make([]httpTemplateMetric, 0, len(metrics)),
+	}
+	for _, m := range metrics {
+		data.Metrics = append(data.Metrics, httpTemplateMetric{
+			Name:       h.Prefix() + m.Name,
+			Type:       m.MetricType,
+			Value:      m.Value,
+			Dimensions: m.GetDimensions(h.DefaultDimensions()),
+			Timestamp:  m.Time().Unix(),
+		})
+	}
+
+	var body bytes.Buffer
+	if err := h.template.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+func (h *HTTP) isSuccess(statusCode int) bool {
+	if h.successStatusCodes == nil {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, code := range h.successStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HTTP) emitBatch(batchName string, metrics []metric.Metric) bool {
+	h.log.Info("Starting to emit ", len(metrics), " metrics")
+
+	if h.endpoint == "" {
+		h.log.Warn("Skipping emission because there is no endpoint")
+		return false
+	}
+
+	body, err := h.renderBody(batchName, metrics)
+	if err != nil {
+		h.log.Error("Failed to render the body: ", err)
+		return false
+	}
+
+	headers := make(map[string]string, len(h.headers)+len(h.secretHeaders)+1)
+	for key, value := range h.headers {
+		headers[key] = value
+	}
+	for key, secret := range h.secretHeaders {
+		value, err := secret.Value()
+		if err != nil {
+			h.log.Error(err)
+		}
+		headers[key] = value
+	}
+	if h.gzip {
+		var zipped bytes.Buffer
+		writer := gzip.NewWriter(&zipped)
+		writer.Write(body)
+		writer.Close()
+		body = zipped.Bytes()
+		headers["Content-Encoding"] = "gzip"
+	}
+
+	rsp, err := h.httpClient.MakeRequest(h.method, h.endpoint, bytes.NewBuffer(body), headers)
+	if err != nil {
+		h.log.Error("Failed to make request ", err,
+			" to endpoint ", h.endpoint)
+		return false
+	}
+
+	if !h.isSuccess(rsp.StatusCode) {
+		h.log.Error("Failed to post to ", h.endpoint,
+			" status was ", rsp.StatusCode,
+			" rsp body was ", string(rsp.Body))
+		return false
+	}
+
+	h.log.Info("Successfully sent ", len(metrics), " datapoints to ", h.endpoint)
+	return true
+}
+
+func (h *HTTP) emitMetrics(metrics []metric.Metric) bool {
+	return h.emitBatches(metrics, h.batchByDimension, h.emitBatch)
+}
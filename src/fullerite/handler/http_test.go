@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"fullerite/metric"
+	"fullerite/util"
+
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestHTTPHandler(interval, buffsize, timeoutsec int) *HTTP {
+	testChannel := make(chan metric.Metric)
+	testLog := l.WithField("testing", "http_handler")
+	timeout := time.Duration(timeoutsec) * time.Second
+
+	h := newHTTP(testChannel, interval, buffsize, timeout, testLog).(*HTTP)
+	h.httpClient = new(util.HTTPAlive)
+	h.httpClient.Configure(timeout, time.Second, 1)
+	return h
+}
+
+func TestHTTPConfigureEmptyConfig(t *testing.T) {
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{})
+
+	assert.Equal(t, 12, h.Interval())
+	assert.Equal(t, 13, h.MaxBufferSize())
+	assert.Equal(t, "", h.Endpoint())
+	assert.Equal(t, "POST", h.method)
+	assert.False(t, h.emitMetrics([]metric.Metric{metric.New("test")}))
+}
+
+func TestHTTPConfigureHeaders(t *testing.T) {
+	os.Setenv("FULLERITE_TEST_HTTP_TOKEN", "secret")
+	defer os.Unsetenv("FULLERITE_TEST_HTTP_TOKEN")
+
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{
+		"endpoint": "http://example.com",
+		"method":   "PUT",
+		"headers":  map[string]interface{}{"Authorization": "Bearer ${FULLERITE_TEST_HTTP_TOKEN}"},
+	})
+
+	assert.Equal(t, "http://example.com", h.Endpoint())
+	assert.Equal(t, "PUT", h.method)
+	assert.Equal(t, "Bearer ${FULLERITE_TEST_HTTP_TOKEN}", h.headers["Authorization"], "the configuration interpolates the environment, not the handler")
+	assert.Equal(t, "application/json", h.headers["Content-Type"])
+}
+
+func TestHTTPDefaultPayload(t *testing.T) {
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{
+		"defaultDimensions": map[string]interface{}{"env": "test"},
+	})
+
+	m := metric.WithValue("cpu.idle", 3.5)
+	m.AddDimension("host", "a")
+	m.Timestamp = time.Unix(1500000000, 0)
+
+	var payload []map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(h.Payload(m)), &payload))
+	require.Len(t, payload, 1)
+	assert.Equal(t, "cpu.idle", payload[0]["name"])
+	assert.Equal(t, "gauge", payload[0]["type"])
+	assert.Equal(t, 3.5, payload[0]["value"])
+	assert.Equal(t, float64(1500000000), payload[0]["timestamp"])
+	assert.Equal(t, map[string]interface{}{"env": "test", "host": "a"}, payload[0]["dimensions"])
+}
+
+func TestHTTPTemplate(t *testing.T) {
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{
+		"template": `{{range $i, $m := .Metrics}}{{if $i}};{{end}}{{$m.Name}}={{$m.Value}}@{{json $m.Dimensions.host}}{{end}}`,
+	})
+
+	m1 := metric.WithValue("a", 1)
+	m1.AddDimension("host", "h1")
+	m2 := metric.WithValue("b", 2)
+
+	body, err := h.renderBody("", []metric.Metric{m1, m2})
+	require.Nil(t, err)
+	assert.Equal(t, `a=1@"h1";b=2@""`, string(body))
+}
+
+func TestHTTPInvalidTemplateKeepsDefault(t *testing.T) {
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{"template": "{{range"})
+
+	assert.Contains(t, h.Payload(metric.New("test")), `"name":"test"`)
+}
+
+func TestHTTPEmitGzipped(t *testing.T) {
+	var (
+		encoding string
+		auth     string
+		body     []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		auth = r.Header.Get("Authorization")
+		reader, err := gzip.NewReader(r.Body)
+		if err == nil {
+			body, _ = ioutil.ReadAll(reader)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{
+		"endpoint": ts.URL,
+		"gzip":     true,
+		"headers":  map[string]interface{}{"Authorization": "Basic abc"},
+		"template": "{{len .Metrics}} metrics",
+	})
+
+	assert.True(t, h.emitMetrics([]metric.Metric{metric.New("a"), metric.New("b")}))
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, "Basic abc", auth)
+	assert.Equal(t, "2 metrics", string(body))
+}
+
+func TestHTTPSecretHeaders(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{
+		"endpoint": ts.URL,
+		"headers":  map[string]interface{}{"Authorization": "exec:echo Bearer rotated"},
+	})
+
+	_, exists := h.headers["Authorization"]
+	assert.False(t, exists)
+	assert.True(t, h.emitMetrics([]metric.Metric{metric.New("a")}))
+	assert.Equal(t, "Bearer rotated", auth)
+}
+
+func TestHTTPSuccessStatusCodes(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{"endpoint": ts.URL})
+	metrics := []metric.Metric{metric.New("test")}
+
+	assert.True(t, h.emitMetrics(metrics))
+	status = http.StatusInternalServerError
+	assert.False(t, h.emitMetrics(metrics))
+
+	h.Configure(map[string]interface{}{
+		"endpoint":           ts.URL,
+		"successStatusCodes": []interface{}{float64(500)},
+	})
+	assert.True(t, h.emitMetrics(metrics))
+	status = http.StatusOK
+	assert.False(t, h.emitMetrics(metrics))
+}
+
+func TestHTTPBatchByDimension(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		batches []string
+	)
+	received := make(chan bool, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		batches = append(batches, string(body))
+		lock.Unlock()
+		received <- true
+	}))
+	defer ts.Close()
+
+	h := getTestHTTPHandler(12, 13, 14)
+	h.Configure(map[string]interface{}{
+		"endpoint":         ts.URL,
+		"batchByDimension": "service",
+		"template":         "{{.Batch}}:{{len .Metrics}}",
+	})
+	h.emissionTimingChannel = make(chan emissionTiming, 2)
+	assert.True(t, h.UseCustomEmissionMetricsReporter())
+
+	m1 := metric.New("a")
+	m1.AddDimension("service", "web")
+	m2 := metric.New("b")
+	m2.AddDimension("service", "web")
+	m3 := metric.New("c")
+	m3.AddDimension("service", "db")
+	assert.True(t, h.emitMetrics([]metric.Metric{m1, m2, m3}))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Failed to receive both batches after 2 seconds")
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	sort.Strings(batches)
+	assert.Equal(t, []string{"db:1", "web:2"}, batches)
+}
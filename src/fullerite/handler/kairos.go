@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fullerite/config"
 	"fullerite/metric"
 	"fullerite/util"
 
@@ -19,6 +20,10 @@ import (
 
 func init() {
 	RegisterHandler("Kairos", newKairos)
+	RegisterSchema("Kairos", config.Schema{
+		{Key: "server", Type: config.String, Required: true, Description: "KairosDB host"},
+		{Key: "port", Type: config.Scalar, Required: true, Description: "KairosDB HTTP port"},
+	})
 }
 
 // Kairos handler
@@ -55,6 +60,9 @@ func newKairos(
 	inst.timeout = initialTimeout
 	inst.log = log
 	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return jsonPayload(inst.convertToKairos(m))
+	}
 
 	return inst
 }
@@ -95,7 +103,7 @@ func (k Kairos) convertToKairos(incomingMetric metric.Metric) (datapoint KairosM
 	km.Name = k.Prefix() + kairosSanitize(incomingMetric.Name)
 	km.Value = incomingMetric.Value
 	km.MetricType = "double"
-	km.Timestamp = time.Now().Unix() * 1000 // Kairos require timestamps to be milliseconds
+	km.Timestamp = incomingMetric.Time().Unix() * 1000 // Kairos require timestamps to be milliseconds
 	km.Tags = make(map[string]string)
 	for key, value := range incomingMetric.GetDimensions(k.DefaultDimensions()) {
 		km.Tags[kairosSanitize(key)] = kairosSanitize(value)
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fullerite/config"
 	"fullerite/metric"
 
 	"encoding/json"
@@ -12,6 +13,7 @@ import (
 
 func init() {
 	RegisterHandler("Log", newLog)
+	RegisterSchema("Log", config.Schema{})
 }
 
 // Log type
@@ -34,6 +36,10 @@ func newLog(
 	inst.maxBufferSize = initialBufferSize
 	inst.log = log
 	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		out, _ := inst.convertToLog(m)
+		return out
+	}
 
 	return inst
 }
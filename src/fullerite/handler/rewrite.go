@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"text/template"
+)
+
+// Actions of a rewrite rule
+const (
+	rewriteRename          = "rename"
+	rewriteTemplate        = "template"
+	rewriteDropDimension   = "dropDimension"
+	rewriteRenameDimension = "renameDimension"
+	rewriteHashDimension   = "hashDimension"
+
+	defaultRewriteHashLength = 16
+)
+
+// rewriteRule reshapes metrics before a handler emits them. Rules are
+// configured as a list under rewriteRules, for example:
+//
+//	"rewriteRules": [
+//		{"action": "rename", "match": "^cpu\\.(.*)", "replace": "processor.$1"},
+//		{"action": "dropDimension", "dimension": "collector"},
+//		{"action": "renameDimension", "dimension": "iface", "to": "interface"},
+//		{"action": "hashDimension", "dimension": "container_id", "maxLength": 64, "length": 12},
+//		{"action": "template", "match": "^loadavg", "template": "{{.Dimensions.host}}.{{.Name}}"}
+//	]
+//
+// match is a regular expression on the metric name that limits which
+// metrics a rule applies to; every metric when it is left out.
+//
+// Templates are Go templates given the metric's Name, Type, Value and
+// Dimensions. The handler's default dimensions are available there too,
+// but the other rules only see the dimensions of the metric itself.
+type rewriteRule struct {
+	action    string
+	match     *regexp.Regexp
+	replace   string
+	dimension string
+	to        string
+	template  *template.Template
+	length    int
+	maxLength int
+}
+
+// rewriteTemplateData is what name templates are executed on
+type rewriteTemplateData struct {
+	Name       string
+	Type       string
+	Value      float64
+	Dimensions map[string]string
+}
+
+// parseRewriteRules reads the rewriteRules of a handler configuration
+func parseRewriteRules(value interface{}) ([]rewriteRule, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rewriteRules should be a list of rules, not %v", value)
+	}
+
+	rules := []rewriteRule{}
+	for i, item := range list {
+		ruleMap, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rewrite rule %d should be an object, not %v", i, item)
+		}
+		rule, err := parseRewriteRule(ruleMap)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite rule %d: %s", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRewriteRule(ruleMap map[string]interface{}) (rewriteRule, error) {
+	rule := rewriteRule{length: defaultRewriteHashLength}
+	get := func(key string) string {
+		if value, exists := ruleMap[key]; exists {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+
+	rule.action = get("action")
+	if expr := get("match"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return rule, err
+		}
+		rule.match = re
+	}
+	rule.replace = get("replace")
+	rule.dimension = get("dimension")
+	rule.to = get("to")
+	if value, exists := ruleMap["length"]; exists {
+		rule.length = config.GetAsInt(value, defaultRewriteHashLength)
+	}
+	if value, exists := ruleMap["maxLength"]; exists {
+		rule.maxLength = config.GetAsInt(value, 0)
+	}
+
+	switch rule.action {
+	case rewriteRename:
+		if rule.match == nil {
+			return rule, fmt.Errorf("%s needs a match", rule.action)
+		}
+	case rewriteTemplate:
+		tmpl, err := template.New("name").Option("missingkey=zero").Parse(get("template"))
+		if err != nil {
+			return rule, err
+		}
+		rule.template = tmpl
+	case rewriteDropDimension, rewriteHashDimension:
+		if rule.dimension == "" {
+			return rule, fmt.Errorf("%s needs a dimension", rule.action)
+		}
+	case rewriteRenameDimension:
+		if rule.dimension == "" || rule.to == "" {
+			return rule, fmt.Errorf("%s needs a dimension and to", rule.action)
+		}
+	default:
+		return rule, fmt.Errorf("unknown action %q", rule.action)
+	}
+	return rule, nil
+}
+
+// rewriteMetrics applies the rules in order to copies of the metrics.
+// The dimensions of a metric are shared with the other handlers, so they
+// are copied before being changed.
+func rewriteMetrics(rules []rewriteRule, metrics []metric.Metric, defaultDimensions map[string]string) []metric.Metric {
+	if len(rules) == 0 {
+		return metrics
+	}
+
+	rewritten := make([]metric.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		dimensions := make(map[string]string, len(m.Dimensions))
+		for k, v := range m.Dimensions {
+			dimensions[k] = v
+		}
+		m.Dimensions = dimensions
+
+		for _, rule := range rules {
+			rule.apply(&m, defaultDimensions)
+		}
+		rewritten = append(rewritten, m)
+	}
+	return rewritten
+}
+
+func (rule rewriteRule) apply(m *metric.Metric, defaultDimensions map[string]string) {
+	if rule.match != nil && !rule.match.MatchString(m.Name) {
+		return
+	}
+
+	switch rule.action {
+	case rewriteRename:
+		m.Name = rule.match.ReplaceAllString(m.Name, rule.replace)
+	case rewriteTemplate:
+		data := rewriteTemplateData{
+			Name:       m.Name,
+			Type:       m.MetricType,
+			Value:      m.Value,
+			Dimensions: m.GetDimensions(defaultDimensions),
+		}
+		var name bytes.Buffer
+		if err := rule.template.Execute(&name, data); err == nil {
+			m.Name = name.String()
+		} else {
+			defaultLog.Warn("Cannot template the name of ", m.Name, ": ", err)
+		}
+	case rewriteDropDimension:
+		delete(m.Dimensions, rule.dimension)
+	case rewriteRenameDimension:
+		if value, exists := m.Dimensions[rule.dimension]; exists {
+			delete(m.Dimensions, rule.dimension)
+			m.Dimensions[rule.to] = value
+		}
+	case rewriteHashDimension:
+		if value, exists := m.Dimensions[rule.dimension]; exists && len(value) > rule.maxLength {
+			m.Dimensions[rule.dimension] = hashDimensionValue(value, rule.length)
+		}
+	}
+}
+
+// hashDimensionValue returns the first length hex digits of the SHA-1 of
+// value
+func hashDimensionValue(value string, length int) string {
+	sum := sha1.Sum([]byte(value))
+	digest := hex.EncodeToString(sum[:])
+	if length > 0 && length < len(digest) {
+		return digest[:length]
+	}
+	return digest
+}
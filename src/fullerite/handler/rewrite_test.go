@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rulesFromJSON(t *testing.T, rulesJSON string) []rewriteRule {
+	var value interface{}
+	require.Nil(t, json.Unmarshal([]byte(rulesJSON), &value))
+	rules, err := parseRewriteRules(value)
+	require.Nil(t, err)
+	return rules
+}
+
+func TestRewriteRename(t *testing.T) {
+	rules := rulesFromJSON(t, `[{"action": "rename", "match": "^cpu\\.(.*)", "replace": "processor.$1"}]`)
+
+	metrics := rewriteMetrics(rules, []metric.Metric{metric.New("cpu.idle"), metric.New("memory.free")}, nil)
+	assert.Equal(t, "processor.idle", metrics[0].Name)
+	assert.Equal(t, "memory.free", metrics[1].Name)
+}
+
+func TestRewriteDimensions(t *testing.T) {
+	rules := rulesFromJSON(t, `[
+		{"action": "dropDimension", "dimension": "collector"},
+		{"action": "renameDimension", "dimension": "iface", "to": "interface"},
+		{"action": "hashDimension", "dimension": "container", "length": 8},
+		{"action": "hashDimension", "dimension": "short", "maxLength": 10}
+	]`)
+
+	m := metric.New("net.rx_bytes")
+	m.AddDimensions(map[string]string{
+		"collector": "network",
+		"iface":     "eth0",
+		"container": "0123456789abcdef",
+		"short":     "abc",
+	})
+
+	metrics := rewriteMetrics(rules, []metric.Metric{m}, nil)
+	assert.Equal(t, map[string]string{
+		"interface": "eth0",
+		"container": hashDimensionValue("0123456789abcdef", 8),
+		"short":     "abc",
+	}, metrics[0].Dimensions)
+	assert.Equal(t, 8, len(metrics[0].Dimensions["container"]))
+
+	assert.Equal(t, "network", m.Dimensions["collector"], "the original dimensions are shared with other handlers")
+	assert.Equal(t, "eth0", m.Dimensions["iface"])
+}
+
+func TestRewriteTemplate(t *testing.T) {
+	rules := rulesFromJSON(t, `[
+		{"action": "template", "match": "^loadavg", "template": "{{.Dimensions.host}}.{{.Dimensions.missing}}{{.Name}}"}
+	]`)
+
+	m := metric.New("loadavg.01")
+	other := metric.New("cpu.idle")
+	metrics := rewriteMetrics(rules, []metric.Metric{m, other}, map[string]string{"host": "web1"})
+	assert.Equal(t, "web1.loadavg.01", metrics[0].Name)
+	assert.Equal(t, "cpu.idle", metrics[1].Name)
+}
+
+func TestRewriteRulesApplyInOrder(t *testing.T) {
+	rules := rulesFromJSON(t, `[
+		{"action": "renameDimension", "dimension": "iface", "to": "interface"},
+		{"action": "template", "template": "{{.Name}}.{{.Dimensions.interface}}"},
+		{"action": "rename", "match": "\\.eth0$", "replace": ".primary"}
+	]`)
+
+	m := metric.New("net.rx")
+	m.AddDimension("iface", "eth0")
+	assert.Equal(t, "net.rx.primary", rewriteMetrics(rules, []metric.Metric{m}, nil)[0].Name)
+}
+
+func TestParseRewriteRulesErrors(t *testing.T) {
+	for _, rulesJSON := range []string{
+		`{"action": "rename"}`,
+		`["rename"]`,
+		`[{"action": "explode"}]`,
+		`[{"action": "rename", "replace": "x"}]`,
+		`[{"action": "rename", "match": "(", "replace": "x"}]`,
+		`[{"action": "dropDimension"}]`,
+		`[{"action": "renameDimension", "dimension": "a"}]`,
+		`[{"action": "template", "template": "{{.Name"}]`,
+	} {
+		var value interface{}
+		require.Nil(t, json.Unmarshal([]byte(rulesJSON), &value))
+		_, err := parseRewriteRules(value)
+		assert.NotNil(t, err, rulesJSON)
+	}
+}
+
+func TestBaseHandlerRewritesBeforeEmitting(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.useCustomEmissionMetricsReporter = true
+	base.configureCommonParams(map[string]interface{}{
+		"rewriteRules": []interface{}{
+			map[string]interface{}{"action": "rename", "match": "^test", "replace": "rewritten"},
+		},
+	})
+
+	var emitted []metric.Metric
+	base.emitAndTime([]metric.Metric{metric.New("testMetric")}, func(metrics []metric.Metric) bool {
+		emitted = metrics
+		return true
+	})
+	require.Equal(t, 1, len(emitted))
+	assert.Equal(t, "rewrittenMetric", emitted[0].Name)
+}
+
+func TestBaseHandlerIgnoresInvalidRewriteRules(t *testing.T) {
+	base := BaseHandler{log: defaultLog}
+	base.configureCommonParams(map[string]interface{}{"rewriteRules": "rename everything"})
+	assert.Empty(t, base.rewriteRules)
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// rotatingFile is a file that is rotated once writing to it would make it
+// larger than maxSize, or once it is older than maxAge: path is renamed
+// path.1, path.1 path.2 and so on, keeping at most maxFiles rotated
+// files. With compress set the rotated files are gzipped, path.1.gz and
+// so on.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if needed
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, fmt.Errorf("%s is closed", f.path)
+	}
+	var rotateErr error
+	if f.size > 0 && f.needsRotation(int64(len(p))) {
+		if rotateErr = f.rotate(); rotateErr != nil && f.file == nil {
+			return 0, rotateErr
+		}
+	}
+	// when the rotation failed the file was reopened, p is still written
+	// to it and the rotation tried again on the next write
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil && rotateErr != nil {
+		err = fmt.Errorf("failed to rotate %s: %s", f.path, rotateErr)
+	}
+	return n, err
+}
+
+func (f *rotatingFile) needsRotation(size int64) bool {
+	if f.maxSize > 0 && f.size+size > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && time.Since(f.opened) > f.maxAge
+}
+
+// rotate moves the file aside and opens a new one. Whatever fails, path is
+// opened again, appended to when it couldn't be moved, so that the file is
+// only left closed when path can't be opened at all.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err == nil {
+		err = f.shift()
+	}
+	if openErr := f.open(); err == nil {
+		err = openErr
+	}
+	return err
+}
+
+// shift moves path to path.1, path.1 to path.2 and so on, or removes it
+// when no rotated files are kept
+func (f *rotatingFile) shift() error {
+	if f.maxFiles > 0 {
+		ext := ""
+		if f.compress {
+			ext = ".gz"
+		}
+		os.Remove(fmt.Sprintf("%s.%d%s", f.path, f.maxFiles, ext))
+		for i := f.maxFiles - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d%s", f.path, i, ext), fmt.Sprintf("%s.%d%s", f.path, i+1, ext))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+		if f.compress {
+			return gzipFile(f.path + ".1")
+		}
+		return nil
+	}
+	return os.Remove(f.path)
+}
+
+// Sync flushes the file to disk
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// gzipFile replaces path with path.gz
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zipped := gzip.NewWriter(out)
+	if _, err = io.Copy(zipped, in); err == nil {
+		err = zipped.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
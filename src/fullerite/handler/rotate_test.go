@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.log")
+
+	f, err := newRotatingFile(path, 10, 2)
+	require.Nil(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+	require.Nil(t, f.Close())
+
+	read := func(name string) string {
+		contents, _ := ioutil.ReadFile(name)
+		return string(contents)
+	}
+	assert.Equal(t, "fourth\n", read(path))
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "only maxFiles rotated files are kept")
+
+	_, err = f.Write([]byte("closed"))
+	assert.NotNil(t, err)
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.log")
+	ioutil.WriteFile(path, []byte("existing\n"), 0644)
+
+	f, err := newRotatingFile(path, 12, 0)
+	require.Nil(t, err)
+	f.Write([]byte("new\n"))
+	f.Close()
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "new\n", string(contents), "the existing size counts, without rotated files it starts over")
+}
+
+func TestRotatingFileReopensOnFailedRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.log")
+	// path can't be renamed over a directory that isn't empty
+	require.Nil(t, os.MkdirAll(filepath.Join(path+".1", "taken"), 0755))
+
+	f, err := newRotatingFile(path, 10, 1)
+	require.Nil(t, err)
+	_, err = f.Write([]byte("first\n"))
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("second\n"))
+	assert.NotNil(t, err)
+	require.NotNil(t, f.file, "the file is reopened")
+
+	require.Nil(t, os.RemoveAll(path+".1"))
+	_, err = f.Write([]byte("third\n"))
+	assert.Nil(t, err)
+	f.Close()
+
+	read := func(name string) string {
+		contents, _ := ioutil.ReadFile(name)
+		return string(contents)
+	}
+	assert.Equal(t, "third\n", read(path))
+	assert.Equal(t, "first\nsecond\n", read(path+".1"))
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"strings"
+)
+
+// handlerSchemas holds the configuration keys of each handler, besides
+// the common ones
+var handlerSchemas = map[string]config.Schema{}
+
+// commonSchema declares the keys configureCommonParams reads
+var commonSchema = append(config.Schema{
+	{Key: "interval", Type: config.Int, Default: DefaultInterval, Description: "Seconds between emissions, the global interval by default"},
+	{Key: "timeout", Type: config.Float, Default: DefaultTimeoutSec, Description: "Seconds an emission may take"},
+	{Key: "max_buffer_size", Type: config.Int, Default: DefaultBufferSize, Description: "Metrics buffered before they are emitted, whatever the interval"},
+	{Key: "defaultDimensions", Type: config.StringMap, Description: "Dimensions added to every metric, over the global ones"},
+	{Key: "keepAliveInterval", Type: config.Int, Default: DefaultKeepAliveInterval, Description: "Seconds HTTP connections are kept alive"},
+	{Key: "maxIdleConnectionsPerHost", Type: config.Int, Default: DefaultMaxIdleConnectionsPerHost, Description: "Idle HTTP connections kept open"},
+	{Key: "collectorBlackList", Type: config.StringList, Description: "Collectors whose metrics are not emitted"},
+	{Key: "collectorWhiteList", Type: config.StringList, Description: "Only collectors whose metrics are emitted"},
+	{Key: "metricWhiteList", Type: config.List, Description: "Filters on the name and dimensions of the only metrics emitted"},
+	{Key: "metricBlackList", Type: config.List, Description: "Filters on the name and dimensions of the metrics not emitted"},
+	{Key: "cumulativeCounterMode", Type: config.String, Default: counterModeRaw, Choices: []string{counterModeRaw, counterModeDelta, counterModeRate}, Description: "Whether cumulative counters are emitted as they are, as deltas or as rates"},
+	{Key: "counterStateExpiry", Type: config.Int, Default: int(defaultCounterStateExpiry.Seconds()), Description: "Seconds a cumulative counter is remembered without new values"},
+	{Key: "aggregation", Type: config.Map, Description: "Aggregates the matching metrics over a window before emitting them"},
+	{Key: "rewriteRules", Type: config.List, Description: "Rules renaming metrics and rewriting dimensions before emission"},
+	{Key: "tee", Type: config.Map, Description: "Samples the emitted payloads for debugging"},
+	{Key: "secretTTL", Type: config.Int, Default: int(config.DefaultSecretTTL.Seconds()), Description: "Seconds a secret read from a file or a command is used before it is read again"},
+}, metric.CardinalitySchema...)
+
+// teeSchema declares the keys of the tee configuration
+var teeSchema = config.Schema{
+	{Key: "sampleRate", Type: config.Float, Default: 1, Description: "Fraction of the batches sampled"},
+	{Key: "metrics", Type: config.List, Description: "Filters on the name and dimensions of the metrics sampled"},
+	{Key: "bufferSize", Type: config.Int, Default: defaultTeeBufferSize, Description: "Samples kept for the internal server"},
+	{Key: "file", Type: config.String, Description: "File the samples are also written to"},
+	{Key: "maxFileSize", Type: config.Int, Default: defaultTeeMaxFileSize, Description: "Bytes after which the file is rotated"},
+	{Key: "maxFiles", Type: config.Int, Default: defaultTeeMaxFiles, Description: "Rotated files kept"},
+}
+
+// RegisterSchema declares the configuration keys of a handler, besides
+// the common ones
+func RegisterSchema(name string, schema config.Schema) {
+	handlerSchemas[name] = schema
+}
+
+// Schema returns the configuration schema of a handler, and false when
+// there is no such handler. Like handler names, the name may have an
+// instance suffix.
+func Schema(name string) (config.Schema, bool) {
+	realName := strings.Split(name, " ")[0]
+	if _, exists := handlerConstructs[realName]; !exists {
+		return nil, false
+	}
+	return append(append(config.Schema{}, commonSchema...), handlerSchemas[realName]...), true
+}
+
+// ValidateConfig returns the problems of a handler configuration: those
+// its schema finds and those of its filters, rewrite rules, aggregation
+// and tee.
+func ValidateConfig(name string, configMap map[string]interface{}) []config.Problem {
+	schema, exists := Schema(name)
+	if !exists {
+		return []config.Problem{{Message: "unknown handler " + name}}
+	}
+	problems := schema.Validate(configMap)
+	invalid := map[string]bool{}
+	for _, problem := range problems {
+		invalid[problem.Key] = !problem.Warning
+	}
+	nested := func(key string, err error) {
+		if _, exists := configMap[key]; exists && !invalid[key] && err != nil {
+			problems = append(problems, config.Problem{Key: key, Message: err.Error()})
+		}
+	}
+
+	for _, key := range []string{"metricWhiteList", "metricBlackList"} {
+		_, err := parseMetricFilters(configMap[key])
+		nested(key, err)
+	}
+	_, err := parseRewriteRules(configMap["rewriteRules"])
+	nested("rewriteRules", err)
+	_, err = metric.ParseAggregationConfig(configMap["aggregation"])
+	nested("aggregation", err)
+
+	if tee, ok := configMap["tee"].(map[string]interface{}); ok {
+		for _, problem := range teeSchema.Validate(tee) {
+			problem.Key = "tee." + problem.Key
+			problems = append(problems, problem)
+		}
+		if filters, ok := tee["metrics"].([]interface{}); ok {
+			if _, err := parseMetricFilters(filters); err != nil {
+				problems = append(problems, config.Problem{Key: "tee.metrics", Message: err.Error()})
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fullerite/config"
+
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaIncludesCommonKeys(t *testing.T) {
+	schema, exists := Schema("Graphite second")
+	assert.True(t, exists)
+
+	_, declared := schema.Field("server")
+	assert.True(t, declared)
+	_, declared = schema.Field("max_buffer_size")
+	assert.True(t, declared)
+
+	_, exists = Schema("NoSuchHandler")
+	assert.False(t, exists)
+}
+
+func TestValidateConfig(t *testing.T) {
+	problems := ValidateConfig("Graphite", map[string]interface{}{
+		"timeout": "soon",
+		"typo":    true,
+	})
+
+	assert.Equal(t, []config.Problem{
+		{Key: "server", Message: "is required"},
+		{Key: "port", Message: "is required"},
+		{Key: "timeout", Message: `should be a float, not "soon"`},
+		{Key: "typo", Message: "unknown key", Warning: true},
+	}, problems)
+}
+
+func TestValidateConfigNested(t *testing.T) {
+	problems := ValidateConfig("Log", map[string]interface{}{
+		"metricWhiteList": []interface{}{map[string]interface{}{"bad": 1.0}},
+		"tee":             map[string]interface{}{"sampleRate": "often"},
+	})
+
+	assert.Equal(t, []config.Problem{
+		{Key: "metricWhiteList", Message: `filter 0: unknown key "bad"`},
+		{Key: "tee.sampleRate", Message: `should be a float, not "often"`},
+	}, problems)
+}
+
+func TestValidateConfigUnknownHandler(t *testing.T) {
+	problems := ValidateConfig("NoSuchHandler", map[string]interface{}{})
+
+	assert.Equal(t, []config.Problem{{Message: "unknown handler NoSuchHandler"}}, problems)
+}
@@ -16,6 +16,11 @@ import (
 
 func init() {
 	RegisterHandler("Scribe", newScribe)
+	RegisterSchema("Scribe", config.Schema{
+		{Key: "endpoint", Type: config.String, Default: defaultScribeEndpoint, Description: "Scribe host"},
+		{Key: "port", Type: config.Int, Default: defaultScribePort, Description: "Scribe port"},
+		{Key: "streamName", Type: config.String, Default: defaultScribeStreamName, Description: "Scribe category the metrics are logged to"},
+	})
 }
 
 type fulleriteScribeClient interface {
@@ -61,6 +66,9 @@ func newScribe(
 	inst.timeout = initialTimeout
 	inst.log = log
 	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return jsonPayload(inst.createScribeMetric(m))
+	}
 
 	inst.endpoint = defaultScribeEndpoint
 	inst.port = defaultScribePort
@@ -150,7 +158,7 @@ func (s Scribe) createScribeMetric(m metric.Metric) scribeMetric {
 		Name:       m.Name,
 		Value:      m.Value,
 		MetricType: m.MetricType,
-		Timestamp:  time.Now().Unix(),
+		Timestamp:  m.Time().Unix(),
 		Dimensions: m.GetDimensions(s.DefaultDimensions()),
 	}
 
@@ -14,13 +14,19 @@ import (
 
 func init() {
 	RegisterHandler("SignalFx", newSignalFx)
+	RegisterSchema("SignalFx", config.Schema{
+		{Key: "authToken", Type: config.String, Required: true, Secret: true, Description: "SignalFx access token"},
+		{Key: "endpoint", Type: config.String, Required: true, Description: "SignalFx datapoint API URL"},
+		{Key: "batchByDimension", Type: config.String, Description: "Dimension the metrics are batched by"},
+		{Key: "perBatchAuthToken", Type: config.StringMap, Secret: true, Description: "Access tokens by value of batchByDimension"},
+	})
 }
 
 // SignalFx Handler
 type SignalFx struct {
 	BaseHandler
 	endpoint   string
-	authToken  string
+	authToken  *config.Secret
 	httpClient *util.HTTPAlive
 
 	// If the following dimension exists,
@@ -29,7 +35,7 @@ type SignalFx struct {
 
 	// When emitting batches made from "batchByDimension"
 	// config, use the following auth token
-	perBatchAuthToken map[string]string
+	perBatchAuthToken map[string]*config.Secret
 }
 
 var allowedNamePuncts = []rune{}
@@ -53,6 +59,9 @@ func newSignalFx(
 	inst.keepAliveInterval = DefaultKeepAliveInterval
 	inst.log = log
 	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return proto.CompactTextString(inst.convertToProto(m))
+	}
 
 	return inst
 }
@@ -60,7 +69,7 @@ func newSignalFx(
 // Configure accepts the different configuration options for the signalfx handler
 func (s *SignalFx) Configure(configMap map[string]interface{}) {
 	if authToken, exists := configMap["authToken"]; exists {
-		s.authToken = authToken.(string)
+		s.authToken = config.GetAsSecret(authToken, secretTTL(configMap))
 	} else {
 		s.log.Error("There was no auth key specified for the SignalFx Handler, there won't be any emissions")
 	}
@@ -76,7 +85,7 @@ func (s *SignalFx) Configure(configMap map[string]interface{}) {
 
 		// Checking if authtoken for batches are specified
 		if perBatchAuthToken, exists := configMap["perBatchAuthToken"]; exists {
-			s.perBatchAuthToken = config.GetAsMap(perBatchAuthToken)
+			s.perBatchAuthToken = config.GetAsSecretMap(perBatchAuthToken, secretTTL(configMap))
 			s.log.Info("Loaded authkeys for batches")
 		} else {
 			s.log.Info("Using default authToken for all batches")
@@ -119,7 +128,7 @@ func (s SignalFx) convertToProto(incomingMetric metric.Metric) *DataPoint {
 	outname := s.Prefix() + signalFxValueSanitize(incomingMetric.Name)
 	value := incomingMetric.Value
 
-	now := time.Now().UnixNano() / int64(time.Millisecond)
+	now := incomingMetric.Time().UnixNano() / int64(time.Millisecond)
 	datapoint := new(DataPoint)
 	datapoint.Timestamp = &now
 	datapoint.Metric = &outname
@@ -166,7 +175,7 @@ func (s SignalFx) getSanitizedDimensions(incomingMetric metric.Metric) map[strin
 
 // getAuthTokenForBatch will return an AuthToken associated with a batchname
 // if no such batch name exists, the default auth token will be returned.
-func (s *SignalFx) getAuthTokenForBatch(batchName string) string {
+func (s *SignalFx) getAuthTokenForBatch(batchName string) *config.Secret {
 	if authToken, exists := s.perBatchAuthToken[batchName]; exists {
 		return authToken
 	}
@@ -174,23 +183,6 @@ func (s *SignalFx) getAuthTokenForBatch(batchName string) string {
 	return s.authToken
 }
 
-func (s *SignalFx) makeBatches(metrics []metric.Metric) map[string][]metric.Metric {
-	m := make(map[string][]metric.Metric)
-
-	// If batchByDimension key is not defined,
-	// do not examine each metric
-	if s.batchByDimension == "" {
-		m[""] = metrics
-		return m
-	}
-
-	for _, metric := range metrics {
-		dimValue := metric.Dimensions[s.batchByDimension]
-		m[dimValue] = append(m[dimValue], metric)
-	}
-	return m
-}
-
 func (s *SignalFx) emitBatch(batchName string, metrics []metric.Metric) bool {
 	s.log.Info("Starting to emit ", len(metrics), " metrics")
 
@@ -203,7 +195,10 @@ func (s *SignalFx) emitBatch(batchName string, metrics []metric.Metric) bool {
 	payload.Datapoints = datapoints
 
 	// Get auth token to be used for batch
-	authToken := s.getAuthTokenForBatch(batchName)
+	authToken, err := s.getAuthTokenForBatch(batchName).Value()
+	if err != nil {
+		s.log.Error(err)
+	}
 	if authToken == "" || s.endpoint == "" {
 		s.log.Warn("Skipping emission because we're missing the auth token ",
 			"or the endpoint, payload would have been ", payload)
@@ -246,42 +241,6 @@ func (s *SignalFx) emitBatch(batchName string, metrics []metric.Metric) bool {
 	return true
 }
 
-func (s *SignalFx) emitAndTime(batchName string, metrics []metric.Metric) bool {
-	start := time.Now()
-	emissionResult := s.emitBatch(batchName, metrics)
-	elapsed := time.Since(start)
-
-	// Report emission metrics if emission tracker is disabled in base handler
-	if s.UseCustomEmissionMetricsReporter() {
-		timing := emissionTiming{
-			timestamp:   time.Now(),
-			duration:    elapsed,
-			metricsSent: len(metrics),
-		}
-		s.reportEmissionMetrics(emissionResult, timing)
-	}
-
-	return emissionResult
-}
-
 func (s *SignalFx) emitMetrics(metrics []metric.Metric) bool {
-
-	if len(metrics) == 0 {
-		s.log.Warn("Skipping send because of an empty payload")
-		return false
-	}
-
-	if s.batchByDimension == "" {
-		// If batchByDimension key is NOT defined,
-		// then emit all metrics in a single batch with the default token
-		return s.emitAndTime("", metrics)
-	}
-
-	// If batchByDimension key is defined,
-	// then divide the list of metrics into batches,
-	// emit them concurrently (or parallely, if GOMAXPROCS is > 1)
-	for batchName, metricBatch := range s.makeBatches(metrics) {
-		go s.emitAndTime(batchName, metricBatch)
-	}
-	return true
+	return s.emitBatches(metrics, s.batchByDimension, s.emitBatch)
 }
@@ -95,6 +95,26 @@ func TestSignalFxRun(t *testing.T) {
 	}
 }
 
+func TestSignalFxAuthTokenForBatch(t *testing.T) {
+	s := getTestSignalfxHandler(12, 12, 12)
+	s.Configure(map[string]interface{}{
+		"authToken":         "secret",
+		"endpoint":          "signalfx.server",
+		"batchByDimension":  "team",
+		"perBatchAuthToken": map[string]interface{}{"infra": "exec:echo infra-secret"},
+	})
+
+	token, err := s.getAuthTokenForBatch("infra").Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "infra-secret", token)
+
+	token, err = s.getAuthTokenForBatch("other").Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", token)
+
+	assert.Equal(t, "<redacted>", s.authToken.String())
+}
+
 func TestSignalFxDimensionsOverwriting(t *testing.T) {
 	s := getTestSignalfxHandler(12, 12, 12)
 
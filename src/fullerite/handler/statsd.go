@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+func init() {
+	RegisterHandler("StatsD", newStatsD)
+	RegisterSchema("StatsD", config.Schema{
+		{Key: "server", Type: config.String, Required: true, Description: "StatsD host"},
+		{Key: "port", Type: config.Scalar, Default: defaultStatsDPort, Description: "StatsD UDP port"},
+		{Key: "dogstatsd", Type: config.Bool, Default: true, Description: "Sends the dimensions as DogStatsD tags instead of in the name"},
+		{Key: "mtu", Type: config.Int, Default: defaultStatsDMTU, Description: "Most bytes per datagram"},
+	})
+}
+
+const (
+	defaultStatsDPort = "8125"
+	defaultStatsDMTU  = 1432
+)
+
+// statsdReplacer strips the characters separating the fields of a datagram
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", "\n", "_")
+
+// StatsD type sends metrics as StatsD datagrams over UDP, usually to a
+// local agent or relay. Gauges are sent as |g and counters as |c; as
+// StatsD only takes increments, cumulative counters are sent as the
+// difference with their previous value unless cumulativeCounterMode is
+// "rate". Dimensions are sent as DogStatsD tags, or appended to the
+// name like Graphite does when dogstatsd is false. As many metrics as
+// fit in mtu bytes are sent in each datagram:
+//
+//	"StatsD": {
+//		"server": "localhost",
+//		"port": 8125,
+//		"dogstatsd": true,
+//		"mtu": 1432
+//	}
+type StatsD struct {
+	BaseHandler
+	server    string
+	port      string
+	dogstatsd bool
+	mtu       int
+}
+
+// newStatsD returns a new StatsD handler.
+func newStatsD(
+	channel chan metric.Metric,
+	initialInterval int,
+	initialBufferSize int,
+	initialTimeout time.Duration,
+	log *l.Entry) Handler {
+
+	inst := new(StatsD)
+	inst.name = "StatsD"
+
+	inst.interval = initialInterval
+	inst.maxBufferSize = initialBufferSize
+	inst.timeout = initialTimeout
+	inst.log = log
+	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return inst.convertToStatsD(m)
+	}
+
+	inst.port = defaultStatsDPort
+	inst.dogstatsd = true
+	inst.mtu = defaultStatsDMTU
+
+	return inst
+}
+
+// Server returns the StatsD server's name or IP
+func (s StatsD) Server() string {
+	return s.server
+}
+
+// Port returns the StatsD server's port number
+func (s StatsD) Port() string {
+	return s.port
+}
+
+// Configure accepts the different configuration options for the StatsD handler
+func (s *StatsD) Configure(configMap map[string]interface{}) {
+	if server, exists := configMap["server"]; exists {
+		s.server = fmt.Sprint(server)
+	} else {
+		s.log.Error("There was no server specified for the StatsD Handler, there won't be any emissions")
+	}
+
+	if port, exists := configMap["port"]; exists {
+		s.port = fmt.Sprint(port)
+	}
+
+	if dogstatsd, exists := configMap["dogstatsd"]; exists {
+		s.dogstatsd = config.GetAsBool(dogstatsd, true)
+	}
+
+	if mtu, exists := configMap["mtu"]; exists {
+		s.mtu = config.GetAsInt(mtu, defaultStatsDMTU)
+	}
+
+	s.configureCommonParams(configMap)
+
+	// StatsD has no cumulative counters, so they are turned into
+	// increments unless a rate was asked for
+	if s.counters == nil {
+		expiry := defaultCounterStateExpiry
+		if value, exists := configMap["counterStateExpiry"]; exists {
+			expiry = time.Duration(config.GetAsInt(value, int(defaultCounterStateExpiry.Seconds()))) * time.Second
+		}
+		s.counters, _ = newCounterConverter(counterModeDelta, expiry)
+	}
+}
+
+// Run runs the handler main loop
+func (s *StatsD) Run() {
+	s.run(s.emitMetrics)
+}
+
+// convertToStatsD formats a metric as the lines of a StatsD datagram
+func (s StatsD) convertToStatsD(m metric.Metric) string {
+	metricType := "g"
+	if m.MetricType == metric.Counter {
+		metricType = "c"
+	}
+
+	dimensions := m.GetDimensions(s.DefaultDimensions())
+	keys := make([]string, 0, len(dimensions))
+	for key := range dimensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	name := s.Prefix() + m.Name
+	if !s.dogstatsd {
+		for _, key := range keys {
+			name = fmt.Sprintf("%s.%s.%s", name, key, dimensions[key])
+		}
+	}
+	name = statsdReplacer.Replace(name)
+
+	line := fmt.Sprintf("%s:%s|%s", name, strconv.FormatFloat(m.Value, 'f', -1, 64), metricType)
+	if s.dogstatsd && len(keys) > 0 {
+		tags := make([]string, 0, len(keys))
+		for _, key := range keys {
+			tags = append(tags, statsdReplacer.Replace(key)+":"+statsdReplacer.Replace(dimensions[key]))
+		}
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	// StatsD reads a signed gauge as a change to its current value
+	if !s.dogstatsd && metricType == "g" && m.Value < 0 {
+		line = fmt.Sprintf("%s:0|g\n%s", name, line)
+	}
+	return line
+}
+
+// makeDatagrams packs the lines into datagrams of at most mtu bytes, a
+// line larger than that being sent on its own
+func (s StatsD) makeDatagrams(metrics []metric.Metric) [][]byte {
+	var (
+		datagrams [][]byte
+		current   bytes.Buffer
+	)
+	for _, m := range metrics {
+		line := s.convertToStatsD(m)
+		if current.Len() > 0 && current.Len()+1+len(line) > s.mtu {
+			datagrams = append(datagrams, append([]byte{}, current.Bytes()...))
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		datagrams = append(datagrams, current.Bytes())
+	}
+	return datagrams
+}
+
+func (s *StatsD) emitMetrics(metrics []metric.Metric) bool {
+	s.log.Info("Starting to emit ", len(metrics), " metrics")
+
+	if len(metrics) == 0 {
+		s.log.Warn("Skipping send because of an empty payload")
+		return false
+	}
+
+	addr := net.JoinHostPort(s.server, s.port)
+	conn, err := net.DialTimeout("udp", addr, s.timeout)
+	if err != nil {
+		s.log.Error("Failed to connect ", addr)
+		return false
+	}
+	defer conn.Close()
+
+	for _, datagram := range s.makeDatagrams(metrics) {
+		if _, err := conn.Write(datagram); err != nil {
+			s.log.Error("Failed to send to ", addr, ": ", err)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestStatsDHandler(interval, buffsize, timeoutsec int) *StatsD {
+	testChannel := make(chan metric.Metric)
+	testLog := l.WithField("testing", "statsd_handler")
+	timeout := time.Duration(timeoutsec) * time.Second
+
+	return newStatsD(testChannel, interval, buffsize, timeout, testLog).(*StatsD)
+}
+
+func TestStatsDConfigureEmptyConfig(t *testing.T) {
+	s := getTestStatsDHandler(12, 13, 14)
+	s.Configure(map[string]interface{}{})
+
+	assert.Equal(t, 12, s.Interval())
+	assert.Equal(t, 13, s.MaxBufferSize())
+	assert.Equal(t, "8125", s.Port())
+	assert.True(t, s.dogstatsd)
+	assert.Equal(t, defaultStatsDMTU, s.mtu)
+	require.NotNil(t, s.counters)
+	assert.Equal(t, counterModeDelta, s.counters.mode)
+}
+
+func TestStatsDConfigure(t *testing.T) {
+	s := getTestStatsDHandler(12, 13, 14)
+	s.Configure(map[string]interface{}{
+		"server":                "localhost",
+		"port":                  9125,
+		"dogstatsd":             false,
+		"mtu":                   512,
+		"cumulativeCounterMode": "rate",
+	})
+
+	assert.Equal(t, "localhost", s.Server())
+	assert.Equal(t, "9125", s.Port())
+	assert.False(t, s.dogstatsd)
+	assert.Equal(t, 512, s.mtu)
+	assert.Equal(t, counterModeRate, s.counters.mode)
+}
+
+func TestStatsDConvert(t *testing.T) {
+	s := getTestStatsDHandler(12, 13, 14)
+	s.Configure(map[string]interface{}{
+		"defaultDimensions": map[string]interface{}{"env": "prod"},
+	})
+
+	gauge := metric.WithValue("cpu.idle", 97.5)
+	gauge.AddDimension("host", "web|1")
+	assert.Equal(t, "cpu.idle:97.5|g|#env:prod,host:web_1", s.Payload(gauge))
+
+	counter := metric.WithValue("requests", 3)
+	counter.MetricType = metric.Counter
+	assert.Equal(t, "requests:3|c|#env:prod", s.Payload(counter))
+
+	s.dogstatsd = false
+	assert.Equal(t, "cpu.idle.env.prod.host.web_1:97.5|g", s.Payload(gauge))
+
+	negative := metric.WithValue("temperature", -4)
+	assert.Equal(t, "temperature.env.prod:0|g\ntemperature.env.prod:-4|g", s.Payload(negative))
+}
+
+func TestStatsDCumulativeCounterDelta(t *testing.T) {
+	s := getTestStatsDHandler(12, 13, 14)
+	s.Configure(map[string]interface{}{})
+
+	m := metric.WithValue("bytes", 100)
+	m.MetricType = metric.CumulativeCounter
+	now := time.Now()
+
+	_, ok := s.counters.convert(m, now)
+	assert.False(t, ok)
+
+	m.Value = 150
+	converted, ok := s.counters.convert(m, now.Add(time.Second))
+	require.True(t, ok)
+	assert.Equal(t, "bytes:50|c", s.Payload(converted))
+}
+
+func TestStatsDMakeDatagrams(t *testing.T) {
+	s := getTestStatsDHandler(12, 13, 14)
+	s.Configure(map[string]interface{}{"mtu": 20})
+
+	metrics := []metric.Metric{
+		metric.WithValue("a", 1),
+		metric.WithValue("b", 2),
+		metric.WithValue("c", 3),
+		metric.WithValue("a_very_long_metric_name", 4),
+	}
+	datagrams := s.makeDatagrams(metrics)
+
+	require.Len(t, datagrams, 2)
+	assert.Equal(t, "a:1|g\nb:2|g\nc:3|g", string(datagrams[0]))
+	assert.Equal(t, "a_very_long_metric_name:4|g", string(datagrams[1]))
+}
+
+func TestStatsDEmitMetrics(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+
+	s := getTestStatsDHandler(12, 13, 1)
+	host, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	s.Configure(map[string]interface{}{"server": host, "port": port})
+
+	assert.True(t, s.emitMetrics([]metric.Metric{metric.WithValue("a", 1), metric.WithValue("b", 2)}))
+
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a:1|g", "b:2|g"}, strings.Split(string(buf[:n]), "\n"))
+
+	assert.False(t, s.emitMetrics([]metric.Metric{}))
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the tee configuration
+const (
+	defaultTeeBufferSize  = 100
+	defaultTeeMaxFileSize = 10 * 1024 * 1024
+	defaultTeeMaxFiles    = 3
+)
+
+// TeeSample is a metric as a handler sent it
+type TeeSample struct {
+	Time    time.Time `json:"time"`
+	Payload string    `json:"payload"`
+}
+
+// tee keeps samples of what a handler emits, in the form the handler
+// sends them in, for debugging. It is configured with the tee key of a
+// handler:
+//
+//	"tee": {
+//		"sampleRate": 0.01,
+//		"metrics": [{"name": "^cpu\\."}],
+//		"bufferSize": 100,
+//		"file": "/var/log/fullerite/signalfx.tee",
+//		"maxFileSize": 10485760,
+//		"maxFiles": 3
+//	}
+//
+// sampleRate is the fraction of the batches sampled, all of them by
+// default. metrics are filters like those of metricWhiteList; when set,
+// only the metrics matching one of them are sampled. The last bufferSize
+// samples are kept in memory and served by the internal server under
+// /tee; when file is set they are also written there.
+type tee struct {
+	sampleRate float64
+	filters    []metricFilter
+	file       *rotatingFile
+
+	mu      sync.Mutex
+	random  *rand.Rand
+	samples []TeeSample
+	next    int
+	full    bool
+}
+
+// parseTee reads the tee configuration of a handler
+func parseTee(value interface{}) (*tee, error) {
+	configMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("tee should be an object, not %v", value)
+	}
+
+	t := &tee{
+		sampleRate: 1,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if rate, exists := configMap["sampleRate"]; exists {
+		t.sampleRate = config.GetAsFloat(rate, 1)
+	}
+	if filters, exists := configMap["metrics"]; exists {
+		parsed, err := parseMetricFilters(filters)
+		if err != nil {
+			return nil, err
+		}
+		t.filters = parsed
+	}
+	bufferSize := defaultTeeBufferSize
+	if size, exists := configMap["bufferSize"]; exists {
+		bufferSize = config.GetAsInt(size, defaultTeeBufferSize)
+	}
+	if bufferSize <= 0 {
+		return nil, fmt.Errorf("bufferSize should be positive, not %d", bufferSize)
+	}
+	t.samples = make([]TeeSample, bufferSize)
+
+	if path, exists := configMap["file"]; exists {
+		maxFileSize := defaultTeeMaxFileSize
+		if size, exists := configMap["maxFileSize"]; exists {
+			maxFileSize = config.GetAsInt(size, defaultTeeMaxFileSize)
+		}
+		maxFiles := defaultTeeMaxFiles
+		if files, exists := configMap["maxFiles"]; exists {
+			maxFiles = config.GetAsInt(files, defaultTeeMaxFiles)
+		}
+		file, err := newRotatingFile(fmt.Sprint(path), int64(maxFileSize), maxFiles)
+		if err != nil {
+			return nil, err
+		}
+		t.file = file
+	}
+	return t, nil
+}
+
+// sample keeps the payloads of the metrics of a batch, if the batch is
+// sampled
+func (t *tee) sample(metrics []metric.Metric, payload func(metric.Metric) string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.random.Float64() >= t.sampleRate {
+		return
+	}
+	now := time.Now()
+	for _, m := range metrics {
+		if len(t.filters) > 0 && !anyFilterMatches(t.filters, m) {
+			continue
+		}
+		s := TeeSample{Time: now, Payload: strings.TrimRight(payload(m), "\n")}
+		t.samples[t.next] = s
+		t.next = (t.next + 1) % len(t.samples)
+		if t.next == 0 {
+			t.full = true
+		}
+		if t.file != nil {
+			fmt.Fprintf(t.file, "%s %s\n", s.Time.Format(time.RFC3339), s.Payload)
+		}
+	}
+}
+
+// jsonPayload is the payload of the handlers sending metrics as JSON
+func jsonPayload(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
+
+// Samples returns the samples in memory, oldest first
+func (t *tee) Samples() []TeeSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		return append([]TeeSample{}, t.samples[:t.next]...)
+	}
+	return append(append([]TeeSample{}, t.samples[t.next:]...), t.samples[:t.next]...)
+}
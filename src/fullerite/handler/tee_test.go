@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fullerite/metric"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTee(t *testing.T) {
+	tee, err := parseTee(map[string]interface{}{})
+	require.Nil(t, err)
+	assert.Equal(t, 1.0, tee.sampleRate)
+	assert.Equal(t, defaultTeeBufferSize, len(tee.samples))
+	assert.Nil(t, tee.file)
+
+	for _, value := range []interface{}{
+		"all",
+		map[string]interface{}{"bufferSize": 0},
+		map[string]interface{}{"metrics": []interface{}{map[string]interface{}{"name": "("}}},
+		map[string]interface{}{"file": "/nonexistent/dir/tee.log"},
+	} {
+		_, err := parseTee(value)
+		assert.NotNil(t, err, "%v", value)
+	}
+}
+
+func TestTeeSamples(t *testing.T) {
+	tee, _ := parseTee(map[string]interface{}{
+		"bufferSize": 2,
+		"metrics":    []interface{}{map[string]interface{}{"name": "^cpu"}},
+	})
+	name := func(m metric.Metric) string { return m.Name + "\n" }
+
+	tee.sample([]metric.Metric{metric.New("cpu.idle"), metric.New("memory.free")}, name)
+	require.Equal(t, 1, len(tee.Samples()))
+	assert.Equal(t, "cpu.idle", tee.Samples()[0].Payload, "only matching metrics are kept, without trailing newlines")
+
+	tee.sample([]metric.Metric{metric.New("cpu.user"), metric.New("cpu.system")}, name)
+	samples := tee.Samples()
+	require.Equal(t, 2, len(samples))
+	assert.Equal(t, "cpu.user", samples[0].Payload, "the oldest samples go first")
+	assert.Equal(t, "cpu.system", samples[1].Payload)
+
+	tee.sampleRate = 0
+	tee.sample([]metric.Metric{metric.New("cpu.nice")}, name)
+	assert.Equal(t, "cpu.system", tee.Samples()[1].Payload, "unsampled batches are skipped")
+}
+
+func TestTeeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tee.log")
+
+	tee, err := parseTee(map[string]interface{}{"file": path})
+	require.Nil(t, err)
+	tee.sample([]metric.Metric{metric.New("cpu.idle")}, func(m metric.Metric) string { return m.Name })
+	tee.file.Close()
+
+	contents, _ := ioutil.ReadFile(path)
+	assert.True(t, strings.HasSuffix(string(contents), " cpu.idle\n"), string(contents))
+}
+
+func TestHandlerTeeUsesHandlerFormat(t *testing.T) {
+	g := getTestGraphiteHandler(12, 13, 14)
+	g.Configure(map[string]interface{}{"tee": map[string]interface{}{}})
+	assert.Nil(t, getTestGraphiteHandler(12, 13, 14).TeeSamples())
+
+	g.OverrideBaseEmissionMetricsReporter()
+	g.emitAndTime([]metric.Metric{metric.WithValue("cpu.idle", 1)}, func([]metric.Metric) bool { return true })
+	samples := g.TeeSamples()
+	require.Equal(t, 1, len(samples))
+	assert.True(t, strings.HasPrefix(samples[0].Payload, "cpu_idle 1.000000 "), samples[0].Payload)
+
+	base := BaseHandler{log: defaultLog}
+	base.SetDefaultDimensions(map[string]string{"host": "a"})
+	assert.Equal(t, `{"name":"cpu","type":"gauge","value":0,"dimensions":{"host":"a"}}`, base.Payload(metric.New("cpu")))
+}
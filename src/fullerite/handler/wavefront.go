@@ -18,13 +18,22 @@ import (
 
 func init() {
 	RegisterHandler("Wavefront", newWavefront)
+	RegisterSchema("Wavefront", config.Schema{
+		{Key: "proxyFlag", Type: config.String, Required: true, Choices: []string{"true", "false"}, Description: "Whether the metrics go through a Wavefront proxy, as a string"},
+		{Key: "apiKey", Type: config.String, Secret: true, Description: "Wavefront API token, without a proxy"},
+		{Key: "endpoint", Type: config.String, Description: "Wavefront API URL, without a proxy"},
+		{Key: "proxyServer", Type: config.String, Description: "Wavefront proxy host"},
+		{Key: "port", Type: config.String, Description: "Wavefront proxy port, as a string"},
+		{Key: "default_point_tags", Type: config.StringMap, Description: "Tags added to every point"},
+		{Key: "batchByDimension", Type: config.String, Description: "Dimension the metrics are batched by"},
+	})
 }
 
 // Wavefront handler
 type Wavefront struct {
 	BaseHandler
 	endpoint    string
-	apiKey      string
+	apiKey      *config.Secret
 	proxyServer string
 	port        string
 	proxyFlag   bool
@@ -64,6 +73,9 @@ func newWavefront(
 	inst.maxBufferSize = initialBufferSize
 	inst.interval = initialInterval
 	inst.channel = channel
+	inst.formatPayload = func(m metric.Metric) string {
+		return inst.wavefrontPayloadToString(wavefrontPayload{Series: []wavefrontMetric{inst.convertToWavefront(m)}})
+	}
 
 	return inst
 }
@@ -156,7 +168,7 @@ func (w *Wavefront) Configure(configMap map[string]interface{}) {
 // Configure the Wavefront Handler for Direct Ingestion
 func (w *Wavefront) configureForDirectIngestion(configMap map[string]interface{}) {
 	if apiKey, exists := configMap["apiKey"]; exists {
-		w.apiKey = apiKey.(string)
+		w.apiKey = config.GetAsSecret(apiKey, secretTTL(configMap))
 	} else {
 		w.log.Error("There was no API key specified for the Wavefront handler, there won't be any emissions")
 	}
@@ -297,7 +309,11 @@ func (w Wavefront) emitMetricsForDirectIngestion(metrics []metric.Metric, pStr s
 		return false
 	}
 	req.Header.Set("Accept", "application/json")
-	bearerAPIKey := fmt.Sprintf("Bearer %s", w.apiKey)
+	apiKey, err := w.apiKey.Value()
+	if err != nil {
+		w.log.Error(err)
+	}
+	bearerAPIKey := fmt.Sprintf("Bearer %s", apiKey)
 	req.Header.Set("Authorization", bearerAPIKey)
 
 	transport := http.Transport{
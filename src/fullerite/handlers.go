@@ -19,6 +19,8 @@ func createHandler(name string, globalConfig config.Config, instanceConfig map[s
 		return nil
 	}
 
+	logConfigProblems(handler.ValidateConfig(name, instanceConfig), "Handler "+name)
+
 	// apply any global configs
 	handlerInst.SetInterval(config.GetAsInt(globalConfig.Interval, handler.DefaultInterval))
 	handlerInst.SetPrefix(globalConfig.Prefix)
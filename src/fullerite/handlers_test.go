@@ -6,6 +6,7 @@ import (
 	"fullerite/metric"
 
 	"fmt"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -100,3 +101,18 @@ func TestCanSendMetrics(t *testing.T) {
 	checkEmission(t, "coll2", h, true)
 	checkEmission(t, "coll3", h, true)
 }
+
+func TestTeeRequestHandler(t *testing.T) {
+	logrus.SetLevel(logrus.PanicLevel)
+	teed := handler.New("Log teed")
+	teed.Configure(map[string]interface{}{"tee": map[string]interface{}{}})
+	handlers := []handler.Handler{teed, handler.New("Log")}
+
+	rsp := httptest.NewRecorder()
+	teeRequestHandler(handlers)(rsp, httptest.NewRequest("GET", "/tee", nil))
+	assert.JSONEq(t, `{"Log teed": []}`, rsp.Body.String())
+
+	rsp = httptest.NewRecorder()
+	teeRequestHandler(handlers)(rsp, httptest.NewRequest("GET", "/tee?handler=Log", nil))
+	assert.JSONEq(t, `{}`, rsp.Body.String())
+}
@@ -0,0 +1,266 @@
+package internalserver
+
+import (
+	"fullerite/config"
+	"fullerite/metric"
+
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+const adminPath = "/admin/"
+
+// ErrNotFound is returned by an Admin for a collector or handler it
+// doesn't have
+var ErrNotFound = errors.New("not found")
+
+// Admin is what the admin API controls: the collectors and handlers of
+// fullerite
+type Admin interface {
+	Collectors() []ComponentState
+	Handlers() []ComponentState
+
+	PauseCollector(name string) error
+	ResumeCollector(name string) error
+	// Collect makes a collector collect now, whatever its interval
+	Collect(name string) error
+	// FlushHandler makes a handler emit the metrics it buffered
+	FlushHandler(name string) error
+}
+
+// ComponentState is a collector or handler as the admin API lists it
+type ComponentState struct {
+	Name     string                 `json:"name"`
+	Type     string                 `json:"type"`
+	Interval int                    `json:"interval"`
+	Paused   bool                   `json:"paused,omitempty"`
+	Config   map[string]interface{} `json:"config"`
+	Stats    metric.InternalMetrics `json:"stats"`
+}
+
+// adminConfig is the admin section of the internal server configuration:
+//
+//	"internalServer": {
+//		"port": 19090,
+//		"admin": {
+//			"enabled": true,
+//			"socket": "/var/run/fullerite/admin.sock",
+//			"token": "file:/etc/fullerite/admin_token"
+//		}
+//	}
+//
+// The admin API is served on the unix socket, only accessible to the user
+// running fullerite, or without one on the internal server port, where it
+// requires the token. Requests give it as Authorization: Bearer <token>.
+type adminConfig struct {
+	enabled bool
+	socket  string
+	token   *config.Secret
+}
+
+func parseAdminConfig(value interface{}) adminConfig {
+	cfg := adminConfig{}
+	configMap, ok := value.(map[string]interface{})
+	if !ok {
+		return cfg
+	}
+	if enabled, exists := configMap["enabled"]; exists {
+		cfg.enabled = config.GetAsBool(enabled, false)
+	}
+	if socket, exists := configMap["socket"]; exists {
+		cfg.socket = fmt.Sprint(socket)
+	}
+	if token, exists := configMap["token"]; exists {
+		cfg.token = config.GetAsSecret(token, config.DefaultSecretTTL)
+	}
+	return cfg
+}
+
+// SetAdmin serves the admin API over admin when the configuration enables
+// it, it has to be called before Run
+func (srv *InternalServer) SetAdmin(admin Admin) {
+	srv.admin = admin
+}
+
+// runAdmin serves the admin API on its unix socket, or registers it on the
+// internal server port
+func (srv *InternalServer) runAdmin() {
+	if !srv.adminConfig.enabled || srv.admin == nil {
+		return
+	}
+	handler := srv.adminHandler()
+
+	if srv.adminConfig.socket == "" {
+		if srv.adminConfig.token == nil {
+			srv.log.Error("Not serving the admin API on port ", srv.port, " without a token")
+			return
+		}
+		srv.log.Info("Serving the admin API on port ", srv.port)
+		http.Handle(adminPath, handler)
+		return
+	}
+
+	ln, err := listenPrivateUnix(srv.adminConfig.socket)
+	if err != nil {
+		srv.log.Error("Failed to serve the admin API: ", err)
+		return
+	}
+	srv.log.Info("Serving the admin API on ", srv.adminConfig.socket)
+
+	mux := http.NewServeMux()
+	mux.Handle(adminPath, handler)
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			srv.log.Error("Failed to serve the admin API: ", err)
+		}
+	}()
+}
+
+// listenPrivateUnix listens on a unix socket only the user can connect to.
+// The socket is made in a new directory only the user can access, and
+// restricted there before it is moved in place, so that nobody can connect
+// to it in between.
+func listenPrivateUnix(socket string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(socket), ".fullerite-admin")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "admin.sock")
+	ln, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, err
+	}
+	if unix, ok := ln.(*net.UnixListener); ok {
+		unix.SetUnlinkOnClose(false)
+	}
+	if err := os.Chmod(private, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	// a socket left behind by a previous run
+	os.Remove(socket)
+	if err := os.Rename(private, socket); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// adminHandler serves:
+//
+//	GET  /admin/collectors                 the collectors and their state
+//	GET  /admin/handlers                   the handlers and their state
+//	POST /admin/collectors/<name>/pause    stops collecting until resumed
+//	POST /admin/collectors/<name>/resume
+//	POST /admin/collectors/<name>/collect  collects now
+//	POST /admin/handlers/<name>/flush      emits the buffered metrics now
+//	GET  /admin/loglevel                   the log level
+//	POST /admin/loglevel?level=debug       changes the log level
+func (srv *InternalServer) adminHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if !srv.authorized(req) {
+			http.Error(writer, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, adminPath), "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "collectors" && req.Method == "GET":
+			writeJSON(writer, srv.admin.Collectors())
+		case len(parts) == 1 && parts[0] == "handlers" && req.Method == "GET":
+			writeJSON(writer, srv.admin.Handlers())
+		case len(parts) == 1 && parts[0] == "loglevel":
+			srv.handleLogLevel(writer, req)
+		case len(parts) == 3 && req.Method == "POST":
+			srv.handleAction(writer, parts[0], parts[1], parts[2])
+		case len(parts) == 3:
+			http.Error(writer, "use POST", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(writer, req)
+		}
+	})
+}
+
+// authorized tells whether a request has the admin token, when there is one
+func (srv *InternalServer) authorized(req *http.Request) bool {
+	if srv.adminConfig.token == nil {
+		return true
+	}
+	token, err := srv.adminConfig.token.Value()
+	if err != nil {
+		srv.log.Error(err)
+	}
+	if token == "" {
+		return false
+	}
+	given := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func (srv *InternalServer) handleAction(writer http.ResponseWriter, kind, name, action string) {
+	actions := map[string]map[string]func(string) error{
+		"collectors": {
+			"pause":   srv.admin.PauseCollector,
+			"resume":  srv.admin.ResumeCollector,
+			"collect": srv.admin.Collect,
+		},
+		"handlers": {
+			"flush": srv.admin.FlushHandler,
+		},
+	}
+	f, exists := actions[kind][action]
+	if !exists {
+		http.Error(writer, fmt.Sprintf("unknown action %s on %s", action, kind), http.StatusNotFound)
+		return
+	}
+
+	srv.log.Info("Admin API: ", action, " ", strings.TrimSuffix(kind, "s"), " ", name)
+	switch err := f(name); err {
+	case nil:
+		writeJSON(writer, map[string]string{"status": "ok"})
+	case ErrNotFound:
+		http.Error(writer, fmt.Sprintf("no %s named %s", strings.TrimSuffix(kind, "s"), name), http.StatusNotFound)
+	default:
+		http.Error(writer, err.Error(), http.StatusConflict)
+	}
+}
+
+func (srv *InternalServer) handleLogLevel(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+	case "POST", "PUT":
+		name := req.URL.Query().Get("level")
+		if name == "" {
+			body, _ := ioutil.ReadAll(req.Body)
+			name = strings.TrimSpace(string(body))
+		}
+		level, err := l.ParseLevel(name)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		srv.log.Info("Admin API: log level set to ", level)
+		l.SetLevel(level)
+	default:
+		http.Error(writer, "use GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(writer, map[string]string{"level": l.GetLevel().String()})
+}
+
+func writeJSON(writer http.ResponseWriter, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(value)
+}
@@ -0,0 +1,177 @@
+package internalserver
+
+import (
+	"fullerite/config"
+
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAdmin struct {
+	actions []string
+}
+
+func (a *testAdmin) Collectors() []ComponentState {
+	return []ComponentState{{Name: "Test", Type: "collector", Interval: 10, Paused: true}}
+}
+
+func (a *testAdmin) Handlers() []ComponentState {
+	return []ComponentState{{Name: "Graphite", Type: "Graphite", Interval: 10}}
+}
+
+func (a *testAdmin) PauseCollector(name string) error  { return a.act("pause " + name) }
+func (a *testAdmin) ResumeCollector(name string) error { return a.act("resume " + name) }
+func (a *testAdmin) Collect(name string) error         { return a.act("collect " + name) }
+func (a *testAdmin) FlushHandler(name string) error    { return a.act("flush " + name) }
+
+func (a *testAdmin) act(action string) error {
+	switch action {
+	case "collect Listener":
+		return errors.New("listeners collect continuously")
+	case "pause Missing", "flush Missing":
+		return ErrNotFound
+	}
+	a.actions = append(a.actions, action)
+	return nil
+}
+
+func getTestAdminServer(token string) (*InternalServer, *testAdmin) {
+	srv := new(InternalServer)
+	srv.log = l.WithFields(l.Fields{"app": "fullerite", "pkg": "internalserver"})
+	srv.adminConfig = adminConfig{enabled: true}
+	if token != "" {
+		srv.adminConfig.token = config.NewSecret(token, 0)
+	}
+	admin := &testAdmin{}
+	srv.SetAdmin(admin)
+	return srv, admin
+}
+
+func adminRequest(srv *InternalServer, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rsp := httptest.NewRecorder()
+	srv.adminHandler().ServeHTTP(rsp, req)
+	return rsp
+}
+
+func TestParseAdminConfig(t *testing.T) {
+	cfg := parseAdminConfig(map[string]interface{}{
+		"enabled": true,
+		"socket":  "/tmp/admin.sock",
+		"token":   "file:/etc/fullerite/admin_token",
+	})
+
+	assert.True(t, cfg.enabled)
+	assert.Equal(t, "/tmp/admin.sock", cfg.socket)
+	assert.Equal(t, "file:/etc/fullerite/admin_token", cfg.token.String())
+
+	assert.False(t, parseAdminConfig(nil).enabled)
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	srv, _ := getTestAdminServer("s3cr3t")
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(srv, "GET", "/admin/collectors", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(srv, "GET", "/admin/collectors", "wrong").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(srv, "GET", "/admin/collectors", "s3cr3t").Code)
+}
+
+func TestAdminListsCollectorsAndHandlers(t *testing.T) {
+	srv, _ := getTestAdminServer("s3cr3t")
+
+	var collectors, handlers []ComponentState
+	rsp := adminRequest(srv, "GET", "/admin/collectors", "s3cr3t")
+	require.Nil(t, json.Unmarshal(rsp.Body.Bytes(), &collectors))
+	rsp = adminRequest(srv, "GET", "/admin/handlers/", "s3cr3t")
+	require.Nil(t, json.Unmarshal(rsp.Body.Bytes(), &handlers))
+
+	assert.Equal(t, []ComponentState{{Name: "Test", Type: "collector", Interval: 10, Paused: true}}, collectors)
+	assert.Equal(t, []ComponentState{{Name: "Graphite", Type: "Graphite", Interval: 10}}, handlers)
+}
+
+func TestAdminActions(t *testing.T) {
+	srv, admin := getTestAdminServer("s3cr3t")
+
+	assert.Equal(t, http.StatusOK, adminRequest(srv, "POST", "/admin/collectors/Test/pause", "s3cr3t").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(srv, "POST", "/admin/collectors/Test%20other/resume", "s3cr3t").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(srv, "POST", "/admin/collectors/Test/collect", "s3cr3t").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(srv, "POST", "/admin/handlers/Graphite/flush", "s3cr3t").Code)
+	assert.Equal(t, []string{"pause Test", "resume Test other", "collect Test", "flush Graphite"}, admin.actions)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, adminRequest(srv, "GET", "/admin/collectors/Test/pause", "s3cr3t").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(srv, "POST", "/admin/collectors/Missing/pause", "s3cr3t").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(srv, "POST", "/admin/handlers/Missing/flush", "s3cr3t").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(srv, "POST", "/admin/handlers/Graphite/pause", "s3cr3t").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(srv, "GET", "/admin/unknown", "s3cr3t").Code)
+
+	rsp := adminRequest(srv, "POST", "/admin/collectors/Listener/collect", "s3cr3t")
+	assert.Equal(t, http.StatusConflict, rsp.Code)
+	assert.Contains(t, rsp.Body.String(), "listeners collect continuously")
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	defer l.SetLevel(l.GetLevel())
+	l.SetLevel(l.InfoLevel)
+	srv, _ := getTestAdminServer("s3cr3t")
+
+	rsp := adminRequest(srv, "GET", "/admin/loglevel", "s3cr3t")
+	assert.JSONEq(t, `{"level": "info"}`, rsp.Body.String())
+
+	rsp = adminRequest(srv, "POST", "/admin/loglevel?level=debug", "s3cr3t")
+	assert.JSONEq(t, `{"level": "debug"}`, rsp.Body.String())
+	assert.Equal(t, l.DebugLevel, l.GetLevel())
+
+	assert.Equal(t, http.StatusBadRequest, adminRequest(srv, "POST", "/admin/loglevel?level=loud", "s3cr3t").Code)
+	assert.Equal(t, l.DebugLevel, l.GetLevel())
+}
+
+func TestAdminOnUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite-admin")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "admin.sock")
+
+	srv, _ := getTestAdminServer("")
+	srv.adminConfig.socket = socket
+	srv.runAdmin()
+
+	info, err := os.Stat(socket)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, entries, 1, "the private directory the socket was made in is removed")
+
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	rsp, err := client.Get("http://fullerite/admin/handlers")
+	require.Nil(t, err)
+	defer rsp.Body.Close()
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+}
+
+func TestAdminNotServedOnPortWithoutToken(t *testing.T) {
+	srv, _ := getTestAdminServer("")
+	srv.runAdmin()
+
+	// the admin API would have been registered on the default mux
+	_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest("GET", "/admin/collectors", nil))
+	assert.NotEqual(t, adminPath, pattern)
+}
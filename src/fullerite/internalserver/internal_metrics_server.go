@@ -26,6 +26,9 @@ type InternalServer struct {
 	collectorStatFunc InternalStatFunc
 	port              int
 	path              string
+	extraHandlers     map[string]http.HandlerFunc
+	admin             Admin
+	adminConfig       adminConfig
 }
 
 // InternalStatFunc can be used to extract metrics
@@ -44,6 +47,7 @@ func New(cfg config.Config, h InternalStatFunc, c InternalStatFunc) *InternalSer
 	srv.log = l.WithFields(l.Fields{"app": "fullerite", "pkg": "internalserver"})
 	srv.handlerStatFunc = h
 	srv.collectorStatFunc = c
+	srv.extraHandlers = map[string]http.HandlerFunc{}
 	srv.configure(cfg.InternalServerConfig)
 	return srv
 }
@@ -52,6 +56,10 @@ func New(cfg config.Config, h InternalStatFunc, c InternalStatFunc) *InternalSer
 func (srv *InternalServer) Run() {
 	srv.log.Info(fmt.Sprintf("Starting to run internal metrics server on port %d on path %s", srv.port, srv.path))
 	http.HandleFunc(srv.path, srv.handleInternalMetricsRequest)
+	for path, f := range srv.extraHandlers {
+		http.HandleFunc(path, f)
+	}
+	srv.runAdmin()
 
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", srv.port))
 	if err != nil {
@@ -65,6 +73,11 @@ func (srv *InternalServer) Run() {
 	}
 }
 
+// HandleFunc serves path with f as well, it has to be called before Run
+func (srv *InternalServer) HandleFunc(path string, f http.HandlerFunc) {
+	srv.extraHandlers[path] = f
+}
+
 func (srv *InternalServer) configure(cfgMap map[string]interface{}) {
 
 	if val, exists := (cfgMap)["port"]; exists {
@@ -78,6 +91,8 @@ func (srv *InternalServer) configure(cfgMap map[string]interface{}) {
 	} else {
 		srv.path = defaultMetricsPath
 	}
+
+	srv.adminConfig = parseAdminConfig(cfgMap["admin"])
 }
 
 // this is what services the request. The response will be JSON formatted like this:
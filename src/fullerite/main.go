@@ -1,13 +1,19 @@
 package main
 
 import (
+	"fullerite/collector"
 	"fullerite/config"
 	"fullerite/handler"
 	"fullerite/internalserver"
 	"fullerite/metric"
 
+	"encoding/json"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -23,6 +29,42 @@ const (
 
 var log = logrus.WithFields(logrus.Fields{"app": "fullerite"})
 
+// exitFuncs run when fullerite is stopped by a signal
+var exitFuncs = struct {
+	sync.Mutex
+	funcs []func()
+}{}
+
+// atExit runs f when fullerite is stopped by a signal, e.g. to remove the
+// files it created
+func atExit(f func()) {
+	exitFuncs.Lock()
+	defer exitFuncs.Unlock()
+	exitFuncs.funcs = append(exitFuncs.funcs, f)
+}
+
+// exitOnSignal runs the exit functions and exits when fullerite is
+// interrupted or terminated
+func exitOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Info("Stopping fullerite on ", sig)
+		runExitFuncs()
+		os.Exit(0)
+	}()
+}
+
+func runExitFuncs() {
+	exitFuncs.Lock()
+	defer exitFuncs.Unlock()
+	for _, f := range exitFuncs.funcs {
+		f()
+	}
+	exitFuncs.funcs = nil
+}
+
 func initLogrus(ctx *cli.Context) {
 	logrus.SetFormatter(&logrus.TextFormatter{
 		DisableColors:   true,
@@ -49,7 +91,7 @@ func main() {
 		cli.StringFlag{
 			Name:  "config, c",
 			Value: "/etc/fullerite.conf",
-			Usage: "JSON formatted configuration file",
+			Usage: "JSON, YAML or TOML configuration file",
 		},
 		cli.StringFlag{
 			Name:  "log_level, l",
@@ -94,6 +136,73 @@ func main() {
 				"NOTE: Make sure you flush out all your metrics either as a list OR individually separated\n" +
 				"with a newline '\\n'otherwise your metrics will not be parsed and will be IGNORED\n",
 		},
+		{
+			Name:   "replay",
+			Action: replay,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "format, f",
+					Value: replayFormatAuto,
+					Usage: "Format of the files: json, graphite or auto",
+				},
+				cli.IntFlag{
+					Name:  "rate, r",
+					Usage: "Maximum number of metrics replayed per second, 0 for no limit",
+				},
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "Only replay the metrics from this time, in Unix seconds or RFC 3339",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "Only replay the metrics until this time, in Unix seconds or RFC 3339",
+				},
+				cli.StringSliceFlag{
+					Name:  "handler",
+					Usage: "Only replay to this handler, can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "prefix",
+					Usage: "Prefix stripped from the metric names, by default the prefix of the File handler",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "Print what would be sent to each handler instead of sending it",
+				},
+				cli.IntFlag{
+					Name:  "wait, w",
+					Value: 30,
+					Usage: "How long (in seconds) to wait for the handlers to send the metrics",
+				},
+			}, app.Flags...),
+			Usage:     "re-send metrics from files to the configured handlers",
+			ArgsUsage: "FILE...",
+			UsageText: "Reads metrics from files written by the File handler, as JSON lines\n" +
+				"or Graphite plaintext, gzipped or not, and sends them to the handlers\n" +
+				"of the configuration. Handlers whose backend takes timestamps get the\n" +
+				"original ones. Use - to read from the standard input.\n",
+		},
+		{
+			Name:   "check-config",
+			Action: checkConfig,
+			Flags: []cli.Flag{
+				app.Flags[0],
+				cli.StringFlag{
+					Name:  "log_level, l",
+					Value: "warn",
+					Usage: "Logging level (debug, info, warn, error, fatal, panic)",
+				},
+				cli.StringFlag{
+					Name:  "describe",
+					Usage: "Print the configuration keys of this collector or handler instead",
+				},
+			},
+			Usage: "validate the configuration and the configurations of its collectors",
+			UsageText: "Reads the configuration and the configuration of every collector it\n" +
+				"references, and prints their problems with their file and key: missing\n" +
+				"required keys, values of the wrong type, unknown handlers and collectors,\n" +
+				"and unknown keys as warnings. Exits with 1 when there are errors.\n",
+		},
 	}
 	app.Run(os.Args)
 }
@@ -108,12 +217,14 @@ func start(ctx *cli.Context) {
 	quit := make(chan bool)
 	initLogrus(ctx)
 	log.Info("Starting fullerite...")
+	exitOnSignal()
 
 	c, err := config.ReadConfig(ctx.String("config"))
 	if err != nil {
 		return
 	}
 	handlers := createHandlers(c)
+	routes = parseRoutes(c)
 	hook := NewLogErrorHook(handlers)
 	log.Logger.Hooks.Add(hook)
 
@@ -122,9 +233,12 @@ func start(ctx *cli.Context) {
 
 	collectorStatChan := make(chan metric.CollectorEmission)
 
+	collectorStats := readCollectorStat(collectorStatChan, collectors)
 	internalServer := internalserver.New(c,
 		handlerStatFunc(handlers),
-		readCollectorStat(collectorStatChan))
+		collectorStats)
+	internalServer.HandleFunc("/tee", teeRequestHandler(handlers))
+	internalServer.SetAdmin(fulleriteAdmin{config: c, handlers: handlers, collectorStats: collectorStats})
 
 	go internalServer.Run()
 
@@ -143,7 +257,26 @@ func handlerStatFunc(handlers []handler.Handler) internalserver.InternalStatFunc
 	}
 }
 
-func readCollectorStat(collectorStatChan <-chan metric.CollectorEmission) internalserver.InternalStatFunc {
+// teeRequestHandler serves the samples of the handlers with a tee, by
+// handler, or those of the handler named by the handler parameter
+func teeRequestHandler(handlers []handler.Handler) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("handler")
+		samples := map[string][]handler.TeeSample{}
+		for _, inst := range handlers {
+			if name != "" && inst.CanonicalName() != name {
+				continue
+			}
+			if s := inst.TeeSamples(); s != nil {
+				samples[inst.CanonicalName()] = s
+			}
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(samples)
+	}
+}
+
+func readCollectorStat(collectorStatChan <-chan metric.CollectorEmission, collectors []collector.Collector) internalserver.InternalStatFunc {
 	collectorMetrics := map[string]uint64{}
 	go func() {
 		for collectorMetric := range collectorStatChan {
@@ -162,10 +295,37 @@ func readCollectorStat(collectorStatChan <-chan metric.CollectorEmission) intern
 			}
 			metricStats[k] = m
 		}
+		mergeCollectorInternalMetrics(metricStats, collectors)
+		mergeCollectorCardinality(metricStats)
+		mergeCollectorRunStats(metricStats)
 		return metricStats
 	}
 }
 
+// mergeCollectorInternalMetrics adds the internal metrics kept by the
+// collectors themselves to the stats
+func mergeCollectorInternalMetrics(stats map[string]metric.InternalMetrics, collectors []collector.Collector) {
+	for _, c := range collectors {
+		inst, ok := c.(collector.InternalMetricsCollector)
+		if !ok {
+			continue
+		}
+		for name, m := range inst.InternalMetrics() {
+			merged, exists := stats[name]
+			if !exists {
+				merged = metric.InternalMetrics{Counters: map[string]float64{}, Gauges: map[string]float64{}}
+			}
+			for k, v := range m.Counters {
+				merged.Counters[k] = v
+			}
+			for k, v := range m.Gauges {
+				merged.Gauges[k] = v
+			}
+			stats[name] = merged
+		}
+	}
+}
+
 func visualize(ctx *cli.Context) {
 	initLogrus(ctx)
 	log.Info("Visualizing fullerite...")
@@ -0,0 +1,238 @@
+package metric
+
+import (
+	"fullerite/config"
+
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statistics an Aggregator can emit for each group
+const (
+	AggregateSum   = "sum"
+	AggregateCount = "count"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateAvg   = "avg"
+
+	// DefaultAggregationWindow is how often aggregates are emitted
+	DefaultAggregationWindow = 10 * time.Second
+)
+
+var defaultAggregateStats = []string{AggregateSum, AggregateCount, AggregateMin, AggregateMax, AggregateAvg}
+
+// AggregationConfig configures an Aggregator
+type AggregationConfig struct {
+	// Only the metrics whose name matches are aggregated, all when nil
+	Match *regexp.Regexp
+	// The dimensions kept, the others are aggregated over
+	GroupBy     []string
+	Window      time.Duration
+	Stats       []string
+	Percentiles []float64
+}
+
+// ParseAggregationConfig reads the aggregation section of a collector or
+// handler configuration, for example:
+//
+//	"aggregation": {
+//		"metrics": "^nerve\\.",
+//		"groupBy": ["service_name", "port"],
+//		"window": 10,
+//		"stats": ["sum", "max", "avg"],
+//		"percentiles": [50, 99]
+//	}
+//
+// stats defaults to sum, count, min, max and avg, window to 10 seconds.
+func ParseAggregationConfig(value interface{}) (AggregationConfig, error) {
+	cfg := AggregationConfig{Window: DefaultAggregationWindow, Stats: defaultAggregateStats}
+	configMap, ok := value.(map[string]interface{})
+	if !ok {
+		return cfg, fmt.Errorf("aggregation should be an object, not %v", value)
+	}
+
+	if expr, exists := configMap["metrics"]; exists {
+		re, err := regexp.Compile(fmt.Sprint(expr))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Match = re
+	}
+	if groupBy, exists := configMap["groupBy"]; exists {
+		cfg.GroupBy = config.GetAsSlice(groupBy)
+	}
+	if window, exists := configMap["window"]; exists {
+		cfg.Window = time.Duration(config.GetAsInt(window, int(DefaultAggregationWindow.Seconds()))) * time.Second
+	}
+	if stats, exists := configMap["stats"]; exists {
+		cfg.Stats = config.GetAsSlice(stats)
+		for _, stat := range cfg.Stats {
+			switch stat {
+			case AggregateSum, AggregateCount, AggregateMin, AggregateMax, AggregateAvg:
+			default:
+				return cfg, fmt.Errorf("unknown aggregation stat %q", stat)
+			}
+		}
+	}
+	if percentiles, exists := configMap["percentiles"]; exists {
+		list, ok := percentiles.([]interface{})
+		if !ok {
+			return cfg, fmt.Errorf("percentiles should be a list, not %v", percentiles)
+		}
+		for _, p := range list {
+			percentile := config.GetAsFloat(p, -1)
+			if percentile <= 0 || percentile > 100 {
+				return cfg, fmt.Errorf("percentile %v should be in ]0, 100]", p)
+			}
+			cfg.Percentiles = append(cfg.Percentiles, percentile)
+		}
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultAggregationWindow
+	}
+	return cfg, nil
+}
+
+// Aggregator groups metrics by name and the GroupBy dimensions, and
+// emits statistics of each group instead of the individual metrics.
+// The aggregates are named after the metric with the statistic appended,
+// like nerve.requests.sum or nerve.requests.p99. Sums keep the type of
+// the metrics, the other statistics are gauges.
+type Aggregator struct {
+	config AggregationConfig
+
+	mu     sync.Mutex
+	groups map[string]*aggregateGroup
+}
+
+type aggregateGroup struct {
+	name       string
+	metricType string
+	dimensions map[string]string
+	count      int
+	sum        float64
+	min        float64
+	max        float64
+	values     []float64
+}
+
+// NewAggregator returns an aggregator
+func NewAggregator(cfg AggregationConfig) *Aggregator {
+	return &Aggregator{
+		config: cfg,
+		groups: map[string]*aggregateGroup{},
+	}
+}
+
+// Window returns how often the aggregates should be flushed
+func (a *Aggregator) Window() time.Duration {
+	return a.config.Window
+}
+
+// Add aggregates m and returns true, or returns false when m isn't to be
+// aggregated and should be emitted as it is
+func (a *Aggregator) Add(m Metric) bool {
+	if a.config.Match != nil && !a.config.Match.MatchString(m.Name) {
+		return false
+	}
+
+	dimensions := map[string]string{}
+	for _, dimension := range a.config.GroupBy {
+		if value, exists := m.Dimensions[dimension]; exists {
+			dimensions[dimension] = value
+		}
+	}
+	grouped := Metric{Name: m.Name, Dimensions: dimensions}
+	key := grouped.SeriesKey()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	group, exists := a.groups[key]
+	if !exists {
+		group = &aggregateGroup{
+			name:       m.Name,
+			metricType: m.MetricType,
+			dimensions: dimensions,
+			min:        math.Inf(1),
+			max:        math.Inf(-1),
+		}
+		a.groups[key] = group
+	}
+	group.count++
+	group.sum += m.Value
+	group.min = math.Min(group.min, m.Value)
+	group.max = math.Max(group.max, m.Value)
+	if len(a.config.Percentiles) > 0 {
+		group.values = append(group.values, m.Value)
+	}
+	return true
+}
+
+// Flush returns the aggregates of the metrics added since the last flush
+func (a *Aggregator) Flush() []Metric {
+	a.mu.Lock()
+	groups := a.groups
+	a.groups = map[string]*aggregateGroup{}
+	a.mu.Unlock()
+
+	metrics := []Metric{}
+	for _, group := range groups {
+		for _, stat := range a.config.Stats {
+			metrics = append(metrics, group.metric(stat))
+		}
+		if len(a.config.Percentiles) > 0 {
+			sort.Float64s(group.values)
+			for _, p := range a.config.Percentiles {
+				m := group.newMetric(percentileName(p), Gauge)
+				m.Value = Percentile(group.values, p)
+				metrics = append(metrics, m)
+			}
+		}
+	}
+	return metrics
+}
+
+func (group *aggregateGroup) metric(stat string) Metric {
+	m := group.newMetric(stat, Gauge)
+	switch stat {
+	case AggregateSum:
+		m.MetricType = group.metricType
+		m.Value = group.sum
+	case AggregateCount:
+		m.Value = float64(group.count)
+	case AggregateMin:
+		m.Value = group.min
+	case AggregateMax:
+		m.Value = group.max
+	case AggregateAvg:
+		m.Value = group.sum / float64(group.count)
+	}
+	return m
+}
+
+func (group *aggregateGroup) newMetric(suffix, metricType string) Metric {
+	m := New(group.name + "." + suffix)
+	m.MetricType = metricType
+	m.AddDimensions(group.dimensions)
+	return m
+}
+
+// percentileName is p99 for 99, p99_9 for 99.9
+func percentileName(p float64) string {
+	return "p" + strings.Replace(fmt.Sprint(p), ".", "_", -1)
+}
+
+// Percentile returns the nearest-rank percentile p of sorted values
+func Percentile(values []float64, p float64) float64 {
+	rank := int(math.Ceil(p/100*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
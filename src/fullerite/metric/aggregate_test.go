@@ -0,0 +1,113 @@
+package metric_test
+
+import (
+	"fullerite/metric"
+
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func workerMetric(name string, value float64, worker, service string) metric.Metric {
+	m := metric.WithValue(name, value)
+	m.AddDimension("worker", worker)
+	m.AddDimension("service", service)
+	return m
+}
+
+func aggregatesByName(metrics []metric.Metric) map[string]metric.Metric {
+	byName := map[string]metric.Metric{}
+	for _, m := range metrics {
+		byName[m.Name+"|"+m.Dimensions["service"]] = m
+	}
+	return byName
+}
+
+func TestParseAggregationConfig(t *testing.T) {
+	cfg, err := metric.ParseAggregationConfig(map[string]interface{}{})
+	require.Nil(t, err)
+	assert.Nil(t, cfg.Match)
+	assert.Equal(t, metric.DefaultAggregationWindow, cfg.Window)
+	assert.Equal(t, []string{"sum", "count", "min", "max", "avg"}, cfg.Stats)
+
+	cfg, err = metric.ParseAggregationConfig(map[string]interface{}{
+		"metrics":     "^nerve",
+		"groupBy":     []interface{}{"service"},
+		"window":      30.0,
+		"stats":       []interface{}{"max"},
+		"percentiles": []interface{}{50.0, "99.9"},
+	})
+	require.Nil(t, err)
+	assert.True(t, cfg.Match.MatchString("nerve.requests"))
+	assert.Equal(t, []string{"service"}, cfg.GroupBy)
+	assert.Equal(t, 30*time.Second, cfg.Window)
+	assert.Equal(t, []string{"max"}, cfg.Stats)
+	assert.Equal(t, []float64{50, 99.9}, cfg.Percentiles)
+}
+
+func TestParseAggregationConfigErrors(t *testing.T) {
+	for _, value := range []interface{}{
+		"sum",
+		map[string]interface{}{"metrics": "("},
+		map[string]interface{}{"stats": []interface{}{"median"}},
+		map[string]interface{}{"percentiles": []interface{}{0.0}},
+		map[string]interface{}{"percentiles": 99.0},
+	} {
+		_, err := metric.ParseAggregationConfig(value)
+		assert.NotNil(t, err, "%v", value)
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	cfg, _ := metric.ParseAggregationConfig(map[string]interface{}{
+		"metrics":     "^requests$",
+		"groupBy":     []interface{}{"service"},
+		"percentiles": []interface{}{50.0, 99.0},
+	})
+	aggregator := metric.NewAggregator(cfg)
+
+	assert.False(t, aggregator.Add(metric.New("cpu.idle")), "only matching metrics are aggregated")
+	for i, value := range []float64{1, 2, 3, 6} {
+		assert.True(t, aggregator.Add(workerMetric("requests", value, string('a'+rune(i)), "api")))
+	}
+	counter := workerMetric("requests", 10, "a", "web")
+	counter.MetricType = metric.Counter
+	aggregator.Add(counter)
+
+	aggregates := aggregator.Flush()
+	assert.Equal(t, 14, len(aggregates))
+	byName := aggregatesByName(aggregates)
+
+	assert.Equal(t, 12.0, byName["requests.sum|api"].Value)
+	assert.Equal(t, 4.0, byName["requests.count|api"].Value)
+	assert.Equal(t, 1.0, byName["requests.min|api"].Value)
+	assert.Equal(t, 6.0, byName["requests.max|api"].Value)
+	assert.Equal(t, 3.0, byName["requests.avg|api"].Value)
+	assert.Equal(t, 2.0, byName["requests.p50|api"].Value)
+	assert.Equal(t, 6.0, byName["requests.p99|api"].Value)
+	assert.Equal(t, map[string]string{"service": "api"}, byName["requests.max|api"].Dimensions)
+
+	assert.Equal(t, metric.Counter, byName["requests.sum|web"].MetricType, "sums keep the metric type")
+	assert.Equal(t, metric.Gauge, byName["requests.count|web"].MetricType)
+
+	assert.Empty(t, aggregator.Flush(), "flushing starts a new window")
+}
+
+func TestAggregatorPercentileNames(t *testing.T) {
+	cfg, _ := metric.ParseAggregationConfig(map[string]interface{}{
+		"stats":       []interface{}{},
+		"percentiles": []interface{}{99.9},
+	})
+	aggregator := metric.NewAggregator(cfg)
+	aggregator.Add(metric.WithValue("latency", 5))
+
+	names := []string{}
+	for _, m := range aggregator.Flush() {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"latency.p99_9"}, names)
+}
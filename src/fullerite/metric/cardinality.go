@@ -0,0 +1,232 @@
+package metric
+
+import (
+	"fullerite/config"
+
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+)
+
+// What happens to new series once the cardinality limit is reached
+const (
+	CardinalityDrop      = "drop"
+	CardinalityAggregate = "aggregate"
+
+	// DefaultCardinalityWindow is how long a series counts towards the limit
+	// after it was last seen
+	DefaultCardinalityWindow = time.Hour
+
+	// CardinalityExceeded is the counter of series over the limit
+	CardinalityExceeded = "fullerite.cardinality_exceeded"
+)
+
+// Parts of metric names that look like identifiers: UUIDs, long hex
+// strings and numbers
+var cardinalityIDREs = []*regexp.Regexp{
+	regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`),
+	regexp.MustCompile(`[0-9a-fA-F]{8,}`),
+	regexp.MustCompile(`[0-9]+`),
+}
+
+// CardinalityConfig configures a CardinalityLimiter. A zero Limit means
+// no limit.
+type CardinalityConfig struct {
+	Limit    int
+	Window   time.Duration
+	Overflow string
+}
+
+// CardinalitySchema declares the configuration keys ParseCardinalityConfig reads
+var CardinalitySchema = config.Schema{
+	{Key: "cardinalityLimit", Type: config.Int, Default: 0, Description: "Most unique series emitted per cardinalityWindow, 0 for no limit"},
+	{Key: "cardinalityWindow", Type: config.Int, Default: int(DefaultCardinalityWindow.Seconds()), Description: "Seconds a series counts towards the cardinality limit"},
+	{Key: "cardinalityOverflow", Type: config.String, Default: CardinalityDrop, Choices: []string{CardinalityDrop, CardinalityAggregate}, Description: "Whether the series over the limit are dropped or aggregated"},
+}
+
+// ParseCardinalityConfig reads cardinalityLimit, cardinalityWindow (in
+// seconds) and cardinalityOverflow ("drop" or "aggregate") from a
+// collector or handler configuration
+func ParseCardinalityConfig(configMap map[string]interface{}) CardinalityConfig {
+	c := CardinalityConfig{Window: DefaultCardinalityWindow, Overflow: CardinalityDrop}
+	if value, exists := configMap["cardinalityLimit"]; exists {
+		c.Limit = config.GetAsInt(value, 0)
+	}
+	if value, exists := configMap["cardinalityWindow"]; exists {
+		c.Window = time.Duration(config.GetAsInt(value, int(DefaultCardinalityWindow.Seconds()))) * time.Second
+	}
+	if value, exists := configMap["cardinalityOverflow"]; exists {
+		if value == CardinalityAggregate {
+			c.Overflow = CardinalityAggregate
+		}
+	}
+	return c
+}
+
+// CardinalityLimiter keeps track of the unique series, a name and its
+// dimensions, seen within a sliding window. Once there are as many as the
+// limit, new series are either dropped or aggregated: their points are
+// summed by name pattern, with what looks like identifiers replaced by
+// "*", into a series with the dimension cardinality_overflow=true, taken
+// with TakeOverflow once an interval.
+type CardinalityLimiter struct {
+	config CardinalityConfig
+	owner  string
+	log    *l.Entry
+
+	mu         sync.Mutex
+	series     map[string]time.Time
+	warned     map[string]time.Time
+	exceeded   uint64
+	lastExpire time.Time
+	// overflow are the sums of the points over the limit, by name
+	// pattern and type
+	overflow map[string]*Metric
+}
+
+// NewCardinalityLimiter returns a limiter, or nil when config has no limit.
+// owner names the collector or handler in the logs.
+func NewCardinalityLimiter(cfg CardinalityConfig, owner string, log *l.Entry) *CardinalityLimiter {
+	if cfg.Limit <= 0 {
+		return nil
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultCardinalityWindow
+	}
+	return &CardinalityLimiter{
+		config: cfg,
+		owner:  owner,
+		log:    log,
+		series:   map[string]time.Time{},
+		warned:   map[string]time.Time{},
+		overflow: map[string]*Metric{},
+	}
+}
+
+// Check returns the metric to publish in place of m, and false when it is
+// over the limit, dropped or added to the overflow
+func (c *CardinalityLimiter) Check(m Metric) (Metric, bool) {
+	key := m.SeriesKey()
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.series[key]; exists || len(c.series) < c.config.Limit || c.expire(now) {
+		c.series[key] = now
+		return m, true
+	}
+
+	c.exceeded++
+	pattern := NamePattern(m.Name)
+	if last, warned := c.warned[pattern]; !warned || now.Sub(last) > c.config.Window {
+		c.warned[pattern] = now
+		c.log.Warn(c.owner, " has more than ", c.config.Limit, " series, ", c.config.Overflow, " new series like ", pattern)
+	}
+
+	if c.config.Overflow == CardinalityAggregate {
+		c.addOverflow(pattern, m)
+	}
+	return m, false
+}
+
+// addOverflow sums m into the overflow series of its pattern, which keeps
+// the time of the latest point
+func (c *CardinalityLimiter) addOverflow(pattern string, m Metric) {
+	key := pattern + "|" + m.MetricType
+	sum, exists := c.overflow[key]
+	if !exists {
+		c.overflow[key] = &Metric{
+			Name:       pattern,
+			MetricType: m.MetricType,
+			Value:      m.Value,
+			Dimensions: map[string]string{"cardinality_overflow": "true"},
+			Timestamp:  m.Time(),
+		}
+		return
+	}
+	sum.Value += m.Value
+	if t := m.Time(); t.After(sum.Timestamp) {
+		sum.Timestamp = t
+	}
+}
+
+// expire forgets the series not seen within the window and returns true
+// if that made room for a new one. Over the limit it's called for every
+// new series, so it only looks at the series once a second.
+func (c *CardinalityLimiter) expire(now time.Time) bool {
+	if now.Sub(c.lastExpire) < time.Second {
+		return false
+	}
+	c.lastExpire = now
+	for key, seen := range c.series {
+		if now.Sub(seen) > c.config.Window {
+			delete(c.series, key)
+		}
+	}
+	for pattern, warned := range c.warned {
+		if now.Sub(warned) > c.config.Window {
+			delete(c.warned, pattern)
+		}
+	}
+	return len(c.series) < c.config.Limit
+}
+
+// Series returns the number of unique series in the window
+func (c *CardinalityLimiter) Series() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	series := 0
+	for _, seen := range c.series {
+		if now.Sub(seen) <= c.config.Window {
+			series++
+		}
+	}
+	return series
+}
+
+// Limit returns the maximum number of unique series
+func (c *CardinalityLimiter) Limit() int {
+	return c.config.Limit
+}
+
+// TakeExceeded returns how many metrics were over the limit since it was
+// last called
+func (c *CardinalityLimiter) TakeExceeded() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exceeded := c.exceeded
+	c.exceeded = 0
+	return exceeded
+}
+
+// TakeOverflow returns the sums of the points over the limit since it was
+// last called, by name pattern
+func (c *CardinalityLimiter) TakeOverflow() []Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	overflow := make([]Metric, 0, len(c.overflow))
+	for _, m := range c.overflow {
+		overflow = append(overflow, *m)
+	}
+	c.overflow = map[string]*Metric{}
+	sort.Slice(overflow, func(i, j int) bool {
+		if overflow[i].Name != overflow[j].Name {
+			return overflow[i].Name < overflow[j].Name
+		}
+		return overflow[i].MetricType < overflow[j].MetricType
+	})
+	return overflow
+}
+
+// NamePattern replaces what looks like identifiers in a metric name by "*"
+func NamePattern(name string) string {
+	for _, re := range cardinalityIDREs {
+		name = re.ReplaceAllString(name, "*")
+	}
+	return name
+}
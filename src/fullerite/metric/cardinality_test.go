@@ -0,0 +1,120 @@
+package metric_test
+
+import (
+	"fullerite/metric"
+
+	"testing"
+	"time"
+
+	l "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCardinalityLog = l.WithFields(l.Fields{"testing": "cardinality"})
+
+func seriesMetric(name, host string) metric.Metric {
+	m := metric.New(name)
+	m.AddDimension("host", host)
+	return m
+}
+
+func TestParseCardinalityConfig(t *testing.T) {
+	cfg := metric.ParseCardinalityConfig(map[string]interface{}{})
+	assert.Equal(t, 0, cfg.Limit)
+	assert.Equal(t, metric.DefaultCardinalityWindow, cfg.Window)
+	assert.Equal(t, metric.CardinalityDrop, cfg.Overflow)
+
+	cfg = metric.ParseCardinalityConfig(map[string]interface{}{
+		"cardinalityLimit":    "100",
+		"cardinalityWindow":   60,
+		"cardinalityOverflow": "aggregate",
+	})
+	assert.Equal(t, 100, cfg.Limit)
+	assert.Equal(t, time.Minute, cfg.Window)
+	assert.Equal(t, metric.CardinalityAggregate, cfg.Overflow)
+}
+
+func TestNewCardinalityLimiterWithoutLimit(t *testing.T) {
+	assert.Nil(t, metric.NewCardinalityLimiter(metric.CardinalityConfig{}, "test", testCardinalityLog))
+}
+
+func TestCardinalityLimiterDrops(t *testing.T) {
+	limiter := metric.NewCardinalityLimiter(metric.CardinalityConfig{Limit: 2}, "test", testCardinalityLog)
+
+	for _, host := range []string{"a", "b"} {
+		_, ok := limiter.Check(seriesMetric("cpu.idle", host))
+		assert.True(t, ok)
+	}
+	_, ok := limiter.Check(seriesMetric("cpu.idle", "c"))
+	assert.False(t, ok, "a new series over the limit is dropped")
+	_, ok = limiter.Check(seriesMetric("cpu.idle", "a"))
+	assert.True(t, ok, "known series are still published")
+
+	assert.Equal(t, 2, limiter.Series())
+	assert.Equal(t, uint64(1), limiter.TakeExceeded())
+	assert.Equal(t, uint64(0), limiter.TakeExceeded())
+}
+
+func TestCardinalityLimiterAggregates(t *testing.T) {
+	cfg := metric.CardinalityConfig{Limit: 1, Overflow: metric.CardinalityAggregate}
+	limiter := metric.NewCardinalityLimiter(cfg, "test", testCardinalityLog)
+
+	limiter.Check(seriesMetric("requests.user1234", "a"))
+	for i, name := range []string{"requests.user5678", "requests.user9012", "requests.user5678"} {
+		m := metric.WithValue(name, float64(i+1))
+		m.Timestamp = time.Unix(int64(100+i), 0)
+		_, ok := limiter.Check(m)
+		assert.False(t, ok, "the points over the limit go to the overflow")
+	}
+	counter := metric.WithValue("latency.host42", 7)
+	counter.MetricType = metric.Counter
+	counter.Timestamp = time.Unix(50, 0)
+	limiter.Check(counter)
+
+	overflow := limiter.TakeOverflow()
+	assert.Equal(t, []metric.Metric{
+		{
+			Name:       "latency.host*",
+			MetricType: metric.Counter,
+			Value:      7,
+			Dimensions: map[string]string{"cardinality_overflow": "true"},
+			Timestamp:  time.Unix(50, 0),
+		},
+		{
+			Name:       "requests.user*",
+			MetricType: metric.Gauge,
+			Value:      6,
+			Dimensions: map[string]string{"cardinality_overflow": "true"},
+			Timestamp:  time.Unix(102, 0),
+		},
+	}, overflow, "summed by pattern and type, at the time of the latest point")
+	assert.Equal(t, uint64(4), limiter.TakeExceeded())
+	assert.Empty(t, limiter.TakeOverflow())
+
+	limiter = metric.NewCardinalityLimiter(metric.CardinalityConfig{Limit: 1}, "test", testCardinalityLog)
+	limiter.Check(seriesMetric("requests.user1234", "a"))
+	limiter.Check(seriesMetric("requests.user5678", "a"))
+	assert.Empty(t, limiter.TakeOverflow(), "dropped without aggregation")
+}
+
+func TestCardinalityLimiterWindow(t *testing.T) {
+	cfg := metric.CardinalityConfig{Limit: 1, Window: 500 * time.Millisecond}
+	limiter := metric.NewCardinalityLimiter(cfg, "test", testCardinalityLog)
+
+	_, ok := limiter.Check(seriesMetric("cpu.idle", "a"))
+	assert.True(t, ok)
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, 0, limiter.Series())
+
+	_, ok = limiter.Check(seriesMetric("cpu.idle", "b"))
+	assert.True(t, ok, "the first series left the window")
+	_, ok = limiter.Check(seriesMetric("cpu.idle", "c"))
+	assert.False(t, ok)
+}
+
+func TestNamePattern(t *testing.T) {
+	assert.Equal(t, "cpu.idle", metric.NamePattern("cpu.idle"))
+	assert.Equal(t, "cpu*.idle", metric.NamePattern("cpu12.idle"))
+	assert.Equal(t, "container.*.memory", metric.NamePattern("container.deadbeefcafe.memory"))
+	assert.Equal(t, "request.*.time", metric.NamePattern("request.123e4567-e89b-12d3-a456-426614174000.time"))
+}
@@ -1,5 +1,11 @@
 package metric
 
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
 // The different types of metrics that are supported
 const (
 	Gauge             = "gauge"
@@ -14,6 +20,10 @@ type Metric struct {
 	MetricType string            `json:"type"`
 	Value      float64           `json:"value"`
 	Dimensions map[string]string `json:"dimensions"`
+
+	// Timestamp is when the metric was measured, when it isn't now, as
+	// for metrics replayed from files
+	Timestamp time.Time `json:"-"`
 }
 
 // New returns a new metric with name. Default metric type is "gauge"
@@ -92,6 +102,25 @@ func (m *Metric) Sentinel() bool {
 	return (m.Name == "fullerite.emit_now")
 }
 
+// Time returns the timestamp of the metric, now if it has none
+func (m *Metric) Time() time.Time {
+	if m.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return m.Timestamp
+}
+
+// SeriesKey identifies the series of a metric: its name with its sorted
+// dimensions
+func (m *Metric) SeriesKey() string {
+	dimensions := make([]string, 0, len(m.Dimensions))
+	for k, v := range m.Dimensions {
+		dimensions = append(dimensions, k+"="+v)
+	}
+	sort.Strings(dimensions)
+	return m.Name + "|" + strings.Join(dimensions, ",")
+}
+
 // AddToAll adds a map of dimensions to a list of metrics
 func AddToAll(metrics *[]Metric, dims map[string]string) {
 	for _, m := range *metrics {
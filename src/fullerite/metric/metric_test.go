@@ -5,6 +5,7 @@ import (
 	"fullerite/metric"
 
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -101,3 +102,14 @@ func TestAddDimensions(t *testing.T) {
 
 	assert.Equal(t, m1, m2)
 }
+
+func TestMetricTime(t *testing.T) {
+	m := metric.New("TestMetric")
+	assert.WithinDuration(t, time.Now(), m.Time(), time.Second, "metrics without a timestamp are from now")
+
+	m.Timestamp = time.Unix(1465839830, 0)
+	assert.Equal(t, time.Unix(1465839830, 0), m.Time())
+
+	out, _ := json.Marshal(m)
+	assert.NotContains(t, string(out), "1465839830", "the timestamp isn't part of the JSON of a metric")
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fullerite/config"
+	"fullerite/handler"
+	"fullerite/metric"
+
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+// Formats of the files replay reads
+const (
+	replayFormatAuto     = "auto"
+	replayFormatJSON     = "json"
+	replayFormatGraphite = "graphite"
+)
+
+// replayJSONMetric is a line written by the File handler in the JSON format
+type replayJSONMetric struct {
+	Name       string            `json:"name"`
+	MetricType string            `json:"type"`
+	Value      float64           `json:"value"`
+	Dimensions map[string]string `json:"dimensions"`
+	Timestamp  int64             `json:"timestamp"`
+}
+
+// replayOptions select the metrics replayed
+type replayOptions struct {
+	format string
+	from   time.Time
+	to     time.Time
+	// prefix the files were written with, stripped so that the handlers
+	// don't add theirs on top of it
+	prefix string
+}
+
+// replay reads metrics from files, as written by the File handler, and
+// sends them to the configured handlers, keeping their timestamps
+func replay(ctx *cli.Context) {
+	initLogrus(ctx)
+
+	if len(ctx.Args()) == 0 {
+		log.Error("You need files to replay, see 'fullerite help replay'")
+		return
+	}
+	opts, err := replayOptionsFromContext(ctx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	c, err := config.ReadConfig(ctx.String("config"))
+	if err != nil {
+		return
+	}
+	configured := createHandlers(c)
+	if ctx.IsSet("prefix") {
+		opts.prefix = ctx.String("prefix")
+	} else {
+		opts.prefix = filePrefix(configured)
+	}
+	handlers := selectHandlers(configured, ctx.StringSlice("handler"))
+	if len(handlers) == 0 {
+		log.Error("There are no handlers to replay the metrics to")
+		return
+	}
+
+	send := func(m metric.Metric) {
+		for _, h := range handlers {
+			fmt.Printf("%s: %s\n", h.CanonicalName(), strings.TrimRight(h.Payload(m), "\n"))
+		}
+	}
+	if !ctx.Bool("dry-run") {
+		startHandlers(handlers)
+		send = func(m metric.Metric) {
+			writeToHandlers(handlers, m)
+		}
+	}
+	if rate := ctx.Int("rate"); rate > 0 {
+		send = throttle(send, rate)
+	}
+
+	replayed := 0
+	for _, path := range ctx.Args() {
+		sent, err := replayPath(path, opts, send)
+		replayed += sent
+		if err != nil {
+			log.Error("Failed to replay ", path, ": ", err)
+		}
+	}
+	log.Info("Replayed ", replayed, " metrics")
+
+	if !ctx.Bool("dry-run") {
+		waitForEmission(handlers, replayed, time.Duration(ctx.Int("wait"))*time.Second)
+	}
+}
+
+func replayOptionsFromContext(ctx *cli.Context) (replayOptions, error) {
+	opts := replayOptions{format: ctx.String("format")}
+	switch opts.format {
+	case replayFormatAuto, replayFormatJSON, replayFormatGraphite:
+	default:
+		return opts, fmt.Errorf("unknown format %q", opts.format)
+	}
+
+	var err error
+	if opts.from, err = parseReplayTime(ctx.String("from")); err != nil {
+		return opts, err
+	}
+	opts.to, err = parseReplayTime(ctx.String("to"))
+	return opts, err
+}
+
+// parseReplayTime reads a time as Unix seconds or RFC 3339
+func parseReplayTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// selectHandlers returns the handlers named, all of them when names is
+// empty
+func selectHandlers(handlers []handler.Handler, names []string) []handler.Handler {
+	selected := []handler.Handler{}
+	for _, h := range handlers {
+		if h != nil && (len(names) == 0 || handlerInSlice(h, names)) {
+			selected = append(selected, h)
+		}
+	}
+	return selected
+}
+
+// filePrefix returns the prefix the File handler writes the metrics with
+func filePrefix(handlers []handler.Handler) string {
+	for _, h := range handlers {
+		if h != nil && h.Name() == "File" {
+			return h.Prefix()
+		}
+	}
+	return ""
+}
+
+// throttle limits send to rate metrics per second
+func throttle(send func(metric.Metric), rate int) func(metric.Metric) {
+	interval := time.Second / time.Duration(rate)
+	next := time.Now()
+	return func(m metric.Metric) {
+		if wait := next.Sub(time.Now()); wait > 0 {
+			time.Sleep(wait)
+		}
+		next = next.Add(interval)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		send(m)
+	}
+}
+
+// replayPath replays a file, gzipped when it ends with .gz, or the
+// standard input for "-"
+func replayPath(path string, opts replayOptions, send func(metric.Metric)) (int, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+		if strings.HasSuffix(path, ".gz") {
+			zipped, err := gzip.NewReader(f)
+			if err != nil {
+				return 0, err
+			}
+			defer zipped.Close()
+			r = zipped
+		}
+	}
+	return replayReader(r, opts, send)
+}
+
+// replayReader sends the metrics of r in the time range and returns how
+// many were sent. Lines that can't be parsed are skipped.
+func replayReader(r io.Reader, opts replayOptions, send func(metric.Metric)) (int, error) {
+	sent := 0
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		m, err := parseReplayLine(line, opts.format)
+		if err != nil {
+			log.Warn("Skipping line ", lineNumber, ": ", err)
+			continue
+		}
+		if !opts.inRange(m) {
+			continue
+		}
+		m.Name = strings.TrimPrefix(m.Name, opts.prefix)
+		send(m)
+		sent++
+	}
+	return sent, scanner.Err()
+}
+
+func (opts replayOptions) inRange(m metric.Metric) bool {
+	if opts.from.IsZero() && opts.to.IsZero() {
+		return true
+	}
+	if m.Timestamp.IsZero() {
+		return false
+	}
+	if !opts.from.IsZero() && m.Timestamp.Before(opts.from) {
+		return false
+	}
+	return opts.to.IsZero() || !m.Timestamp.After(opts.to)
+}
+
+// parseReplayLine reads a JSON line or a Graphite plaintext line; auto
+// tells them apart by their first character
+func parseReplayLine(line, format string) (metric.Metric, error) {
+	if format == replayFormatJSON || (format == replayFormatAuto && strings.HasPrefix(line, "{")) {
+		return parseReplayJSON(line)
+	}
+	return parseReplayGraphite(line)
+}
+
+func parseReplayJSON(line string) (metric.Metric, error) {
+	var parsed replayJSONMetric
+	if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+		return metric.Metric{}, err
+	}
+	if parsed.Name == "" {
+		return metric.Metric{}, fmt.Errorf("no metric name")
+	}
+	m := metric.WithValue(parsed.Name, parsed.Value)
+	if parsed.MetricType != "" {
+		m.MetricType = parsed.MetricType
+	}
+	m.AddDimensions(parsed.Dimensions)
+	if parsed.Timestamp > 0 {
+		m.Timestamp = time.Unix(parsed.Timestamp, 0)
+	}
+	return m, nil
+}
+
+// parseReplayGraphite reads "name value [timestamp]". The dimensions
+// Graphite folds into the name aren't recovered.
+func parseReplayGraphite(line string) (metric.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return metric.Metric{}, fmt.Errorf("expected name value [timestamp], got %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return metric.Metric{}, err
+	}
+	m := metric.WithValue(fields[0], value)
+	if len(fields) == 3 {
+		seconds, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return metric.Metric{}, err
+		}
+		m.Timestamp = time.Unix(seconds, 0)
+	}
+	return m, nil
+}
+
+// waitForEmission flushes the handlers and waits until they have handled
+// the replayed metrics, sent, dropped, filtered out or absorbed by the
+// counter conversion, the aggregation or the cardinality limit, or for at
+// most timeout
+func waitForEmission(handlers []handler.Handler, replayed int, timeout time.Duration) {
+	writeToHandlers(handlers, metric.Sentinel())
+
+	deadline := time.Now().Add(timeout)
+	for _, h := range handlers {
+		for {
+			counters := h.InternalMetrics().Counters
+			handled := counters["metricsSent"] + counters["metricsDropped"] +
+				counters["metricsFiltered"] + counters["metricsAbsorbed"]
+			if handled >= float64(replayed) {
+				break
+			}
+			if time.Now().After(deadline) {
+				log.Warn(h.CanonicalName(), " handled ", handled, " of the ", replayed, " metrics replayed")
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
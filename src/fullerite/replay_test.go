@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fullerite/handler"
+	"fullerite/metric"
+
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testReplayLines = `{"name":"cpu.idle","type":"gauge","value":97.5,"dimensions":{"host":"a"},"timestamp":1465839830}
+not a metric
+{"name":"requests","type":"counter","value":3,"dimensions":{},"timestamp":1465839900}
+
+servers.b.load 1.5 1465840000
+`
+
+func TestParseReplayLine(t *testing.T) {
+	m, err := parseReplayLine(`{"name":"cpu.idle","type":"counter","value":2,"dimensions":{"host":"a"},"timestamp":10}`, replayFormatAuto)
+	require.Nil(t, err)
+	assert.Equal(t, "cpu.idle", m.Name)
+	assert.Equal(t, metric.Counter, m.MetricType)
+	assert.Equal(t, 2.0, m.Value)
+	assert.Equal(t, map[string]string{"host": "a"}, m.Dimensions)
+	assert.Equal(t, time.Unix(10, 0), m.Timestamp)
+
+	m, err = parseReplayLine("servers.a.load 1.5 20", replayFormatAuto)
+	require.Nil(t, err)
+	assert.Equal(t, "servers.a.load", m.Name)
+	assert.Equal(t, metric.Gauge, m.MetricType)
+	assert.Equal(t, 1.5, m.Value)
+	assert.Equal(t, time.Unix(20, 0), m.Timestamp)
+
+	m, err = parseReplayLine("servers.a.load 1.5", replayFormatGraphite)
+	require.Nil(t, err)
+	assert.True(t, m.Timestamp.IsZero())
+
+	for _, line := range []string{"servers.a.load", "servers.a.load x 20", "a 1 x", "a 1 2 3"} {
+		_, err := parseReplayLine(line, replayFormatAuto)
+		assert.NotNil(t, err, line)
+	}
+	_, err = parseReplayLine("servers.a.load 1.5 20", replayFormatJSON)
+	assert.NotNil(t, err)
+	_, err = parseReplayLine(`{"value":1}`, replayFormatJSON)
+	assert.NotNil(t, err)
+}
+
+func TestReplayReader(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	replayed := []metric.Metric{}
+	send := func(m metric.Metric) { replayed = append(replayed, m) }
+
+	sent, err := replayReader(strings.NewReader(testReplayLines), replayOptions{format: replayFormatAuto}, send)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, sent)
+	assert.Equal(t, 3, len(replayed))
+
+	replayed = replayed[:0]
+	opts := replayOptions{format: replayFormatAuto, from: time.Unix(1465839900, 0), to: time.Unix(1465839999, 0)}
+	sent, _ = replayReader(strings.NewReader(testReplayLines+"untimed 1\n"), opts, send)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, "requests", replayed[0].Name)
+
+	replayed = replayed[:0]
+	opts = replayOptions{format: replayFormatAuto, prefix: "servers."}
+	replayReader(strings.NewReader(testReplayLines), opts, send)
+	require.Equal(t, 3, len(replayed))
+	assert.Equal(t, "b.load", replayed[2].Name, "the prefix of the File handler is stripped")
+}
+
+func TestFilePrefix(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	file := handler.New("File")
+	file.SetPrefix("written.")
+	handlers := []handler.Handler{handler.New("Log"), nil, file}
+
+	assert.Equal(t, "written.", filePrefix(handlers))
+	assert.Equal(t, "", filePrefix(handlers[:2]))
+}
+
+func TestReplayPathGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fullerite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log.1.gz")
+
+	f, _ := os.Create(path)
+	zipped := gzip.NewWriter(f)
+	zipped.Write([]byte(testReplayLines))
+	zipped.Close()
+	f.Close()
+
+	sent, err := replayPath(path, replayOptions{format: replayFormatAuto}, func(metric.Metric) {})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, sent)
+
+	_, err = replayPath(filepath.Join(dir, "missing"), replayOptions{}, func(metric.Metric) {})
+	assert.NotNil(t, err)
+}
+
+func TestParseReplayTime(t *testing.T) {
+	parsed, err := parseReplayTime("")
+	assert.Nil(t, err)
+	assert.True(t, parsed.IsZero())
+
+	parsed, err = parseReplayTime("1465839830")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1465839830, 0), parsed)
+
+	parsed, err = parseReplayTime("2016-06-13T17:43:50Z")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1465839830), parsed.Unix())
+
+	_, err = parseReplayTime("yesterday")
+	assert.NotNil(t, err)
+}
+
+func TestThrottle(t *testing.T) {
+	sent := 0
+	send := throttle(func(metric.Metric) { sent++ }, 20)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		send(metric.New("test"))
+	}
+	assert.Equal(t, 5, sent)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond, "5 metrics at 20 per second take 200ms")
+}
+
+func TestSelectHandlers(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	handlers := []handler.Handler{handler.New("Log"), handler.New("Log second"), nil}
+
+	assert.Equal(t, 2, len(selectHandlers(handlers, nil)))
+	selected := selectHandlers(handlers, []string{"Log second"})
+	require.Equal(t, 1, len(selected))
+	assert.Equal(t, "Log second", selected[0].CanonicalName())
+}
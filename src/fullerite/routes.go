@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fullerite/config"
+	"fullerite/handler"
+	"fullerite/metric"
+
+	"fmt"
+	"regexp"
+)
+
+// route is a compiled config.Route
+type route struct {
+	name       *regexp.Regexp
+	dimensions map[string]*regexp.Regexp
+	handlers   []string
+}
+
+// routes are the routing rules of the configuration. The first route a
+// metric matches picks the handlers it goes to; metrics that match none
+// go to every handler listening to their collector.
+var routes []route
+
+// parseRoutes compiles the routes of the configuration, skipping the
+// invalid ones
+func parseRoutes(c config.Config) []route {
+	parsed := []route{}
+	for i, r := range c.Routes {
+		compiled, err := parseRoute(r)
+		if err != nil {
+			log.Error("Ignoring route ", i, ": ", err)
+			continue
+		}
+		for _, name := range r.Handlers {
+			if _, exists := c.Handlers[name]; !exists {
+				log.Warn("Route ", i, " sends metrics to ", name, " which isn't a configured handler")
+			}
+		}
+		parsed = append(parsed, compiled)
+	}
+	return parsed
+}
+
+func parseRoute(r config.Route) (route, error) {
+	compiled := route{dimensions: map[string]*regexp.Regexp{}, handlers: r.Handlers}
+	if len(r.Handlers) == 0 {
+		return compiled, fmt.Errorf("no handlers")
+	}
+	if r.Name != "" {
+		re, err := regexp.Compile(r.Name)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.name = re
+	}
+	for dimension, expr := range r.Dimensions {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.dimensions[dimension] = re
+	}
+	return compiled, nil
+}
+
+func (r route) matches(m metric.Metric) bool {
+	if r.name != nil && !r.name.MatchString(m.Name) {
+		return false
+	}
+	for dimension, re := range r.dimensions {
+		value, exists := m.Dimensions[dimension]
+		if !exists || !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// routeHandlers returns the handlers of the first route matching m, and
+// false when there is none
+func routeHandlers(m metric.Metric) ([]string, bool) {
+	for _, r := range routes {
+		if r.matches(m) {
+			return r.handlers, true
+		}
+	}
+	return nil, false
+}
+
+// sendToHandlers sends a metric of collector c to the handlers of the
+// route it matches, or to the handlers that listen to c. A route only
+// narrows the handlers, it doesn't lift their collector blacklist or
+// whitelist. Handlers picked by a route get the metric on the endpoint of c
+// if they have one, on their main channel otherwise.
+func sendToHandlers(c string, m metric.Metric, handlers []handler.Handler) {
+	targets, routed := routeHandlers(m)
+	for i := range handlers {
+		if routed && !handlerInSlice(handlers[i], targets) {
+			continue
+		}
+		if endpoint, listening := handlers[i].CollectorEndpoints()[c]; listening {
+			endpoint.Channel <- m
+		} else if routed && handlers[i].IsCollectorAllowed(c) {
+			handlers[i].Channel() <- m
+		}
+	}
+}
+
+func handlerInSlice(h handler.Handler, names []string) bool {
+	for _, name := range names {
+		if h.CanonicalName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fullerite/config"
+	"fullerite/handler"
+	"fullerite/metric"
+
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRoutes(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	parsed := parseRoutes(config.Config{Routes: []config.Route{
+		{Name: "^cpu", Handlers: []string{"Graphite"}},
+		{Name: "(", Handlers: []string{"Graphite"}},
+		{Dimensions: map[string]string{"service": "("}, Handlers: []string{"Graphite"}},
+		{Name: "^cpu"},
+	}})
+	assert.Equal(t, 1, len(parsed), "invalid routes are skipped")
+}
+
+func TestRouteMatches(t *testing.T) {
+	r, err := parseRoute(config.Route{
+		Name:       "^nerve\\.",
+		Dimensions: map[string]string{"service": "^payments$"},
+		Handlers:   []string{"Wavefront"},
+	})
+	assert.Nil(t, err)
+
+	m := metric.New("nerve.requests")
+	assert.False(t, r.matches(m), "needs the dimension")
+	m.AddDimension("service", "payments")
+	assert.True(t, r.matches(m))
+	m.Name = "cpu.idle"
+	assert.False(t, r.matches(m))
+
+	catchAll, _ := parseRoute(config.Route{Handlers: []string{"SignalFx"}})
+	assert.True(t, catchAll.matches(m))
+}
+
+func TestSendToHandlersWithRoutes(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	defer func() { routes = nil }()
+	routes = parseRoutes(config.Config{Routes: []config.Route{
+		{Dimensions: map[string]string{"service": "^payments$"}, Handlers: []string{"Log payments"}},
+	}})
+
+	payments := handler.New("Log payments")
+	payments.SetCollectorEndpoints(map[string]handler.CollectorEnd{})
+	other := handler.New("Log")
+	otherEndpoint := handler.CollectorEnd{Channel: make(chan metric.Metric, 1), BufferSize: 1}
+	other.SetCollectorEndpoints(map[string]handler.CollectorEnd{"Test": otherEndpoint})
+	handlers := []handler.Handler{payments, other}
+
+	assert.Equal(t, "Log payments", payments.CanonicalName())
+	assert.Equal(t, "Log", payments.Name())
+
+	m := metric.New("requests")
+	m.AddDimension("service", "payments")
+	go sendToHandlers("Test", m, handlers)
+	assert.Equal(t, m, <-payments.Channel(), "routed to the main channel of a handler not listening to the collector")
+
+	m.AddDimension("service", "search")
+	sendToHandlers("Test", m, handlers)
+	assert.Equal(t, m, <-otherEndpoint.Channel, "unrouted metrics go to the handlers listening to the collector")
+}
+
+func TestSendToHandlersWithRoutesKeepsCollectorBlackList(t *testing.T) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	defer func() { routes = nil }()
+	routes = parseRoutes(config.Config{Routes: []config.Route{
+		{Dimensions: map[string]string{"service": "^payments$"}, Handlers: []string{"Log payments"}},
+	}})
+
+	payments := handler.New("Log payments")
+	payments.SetCollectorEndpoints(map[string]handler.CollectorEnd{})
+	payments.SetCollectorBlackList([]string{"Test"})
+	handlers := []handler.Handler{payments}
+
+	m := metric.New("requests")
+	m.AddDimension("service", "payments")
+	sendToHandlers("Test", m, handlers)
+	select {
+	case <-payments.Channel():
+		t.Fatal("routed a metric of a collector the handler blacklists")
+	default:
+	}
+
+	go sendToHandlers("Other", m, handlers)
+	assert.Equal(t, m, <-payments.Channel())
+}